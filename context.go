@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"maps"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Context struct {
@@ -22,7 +26,21 @@ type Context struct {
 
 	UserValues map[string]any
 
+	routeMeta map[string]any
 	tplEngine TemplateEngine
+
+	trustedProxies []netip.Prefix
+	forwarded      *forwarded
+}
+
+// Clone returns a shallow copy of the context,
+// the path params and user values are copied so that the copy can be used in another goroutine
+// after the request is finished.
+func (c *Context) Clone() *Context {
+	cc := *c
+	cc.pathParams = maps.Clone(c.pathParams)
+	cc.UserValues = maps.Clone(c.UserValues)
+	return &cc
 }
 
 // BindJson bind JSON request body to v
@@ -75,6 +93,12 @@ func (c *Context) QueryParam(key string) ParamVal {
 	}
 }
 
+// RouteMeta get the metadata attached to the matched route by its group.
+func (c *Context) RouteMeta(key string) (any, bool) {
+	val, ok := c.routeMeta[key]
+	return val, ok
+}
+
 // RespBytes response with bytes
 func (c *Context) RespBytes(code int, data []byte) error {
 	c.StatusCode = code
@@ -102,6 +126,55 @@ func (c *Context) OkJson(data any) error {
 	return c.RespJson(http.StatusOK, data)
 }
 
+// ClientIP returns the ip of the client, resolved from the forwarded headers if the peer is a trusted proxy,
+// see ServerWithTrustedProxiesOpt.
+func (c *Context) ClientIP() string {
+	return c.getForwarded().clientIP
+}
+
+// Scheme returns the scheme of the request the client sent, http or https.
+func (c *Context) Scheme() string {
+	return c.getForwarded().scheme
+}
+
+// Host returns the host of the request the client sent.
+func (c *Context) Host() string {
+	return c.getForwarded().host
+}
+
+func (c *Context) getForwarded() *forwarded {
+	if c.forwarded == nil {
+		c.forwarded = resolveForwarded(c)
+	}
+	return c.forwarded
+}
+
+// SetCacheControl sets the Cache-Control header of the response by the directives,
+// e.g. ctx.SetCacheControl("public", "max-age=60", "stale-while-revalidate=30").
+func (c *Context) SetCacheControl(directives ...string) {
+	c.Resp.Header().Set("Cache-Control", strings.Join(directives, ", "))
+}
+
+// CacheFor allows the response to be cached for maxAge,
+// by the shared caches ( e.g. CDNs ) as well if public, or only by the browser otherwise.
+func (c *Context) CacheFor(maxAge time.Duration, public bool) {
+	scope := "private"
+	if public {
+		scope = "public"
+	}
+	c.SetCacheControl(scope, "max-age="+strconv.FormatInt(int64(maxAge.Seconds()), 10))
+}
+
+// NoCache requires the caches to revalidate the response before using it, e.g. by ETag.
+func (c *Context) NoCache() {
+	c.SetCacheControl("no-cache")
+}
+
+// NoStore forbids the caches to store the response, e.g. for sensitive data.
+func (c *Context) NoStore() {
+	c.SetCacheControl("no-store")
+}
+
 func (c *Context) Render(tplName string, data any) error {
 	var err error
 	c.Data, err = c.tplEngine.Render(tplName, data)
@@ -249,9 +249,9 @@ func (srh *StaticResourceHandler) cacheFile(ci *cacheItem) {
 }
 
 func (srh *StaticResourceHandler) writeResp(ctx *Context, ci *cacheItem) {
-	ctx.Resp.WriteHeader(http.StatusOK)
 	ctx.Resp.Header().Set("Content-Type", ci.contentType)
 	ctx.Resp.Header().Set("Content-Length", fmt.Sprintf("%d", ci.fileSize))
+	ctx.Resp.WriteHeader(http.StatusOK)
 	_, _ = ctx.Resp.Write(ci.data)
 }
 
@@ -0,0 +1,191 @@
+package easyweb
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/JrMarcco/easy-web/internal/netprefix"
+)
+
+// PrivateNetworks are the loopback and the private networks, where the proxies usually are,
+// e.g. ServerWithTrustedProxiesOpt(PrivateNetworks...).
+var PrivateNetworks = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// ServerWithTrustedProxiesOpt trusts the forwarded headers ( Forwarded, X-Forwarded-For, X-Forwarded-Proto,
+// X-Forwarded-Host and X-Real-IP ) set by the proxies, which are CIDRs or single IPs.
+// It panics on an invalid proxy.
+//
+// No proxy is trusted by default, Context.ClientIP returns the peer address then.
+func ServerWithTrustedProxiesOpt(proxies ...string) ServerOpt {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := netprefix.Parse(proxy)
+		if err != nil {
+			panic(fmt.Errorf("[easy_web] invalid trusted proxy %s: %w", proxy, err))
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return func(s *HttpServer) {
+		s.trustedProxies = prefixes
+	}
+}
+
+// forwarded is what the client facing trusted proxy received.
+type forwarded struct {
+	clientIP string
+	scheme   string
+	host     string
+}
+
+// resolveForwarded walks the proxies of the request from the nearest one,
+// the first address not trusted is the client.
+//
+// Forwarded takes precedence over X-Forwarded-For, which takes precedence over X-Real-IP.
+// The scheme and the host are of the Forwarded element of the client,
+// or the last X-Forwarded-Proto and X-Forwarded-Host, which are set by the nearest proxy.
+func resolveForwarded(c *Context) *forwarded {
+	req := c.Req
+	fwd := &forwarded{
+		clientIP: remoteIP(req.RemoteAddr),
+		scheme:   "http",
+		host:     req.Host,
+	}
+	if req.TLS != nil {
+		fwd.scheme = "https"
+	}
+
+	peer, err := netip.ParseAddr(fwd.clientIP)
+	if err != nil || !trusted(c.trustedProxies, peer) {
+		return fwd
+	}
+
+	if elems := forwardedElems(req.Header.Values("Forwarded")); len(elems) > 0 {
+		idx := -1
+		for i := len(elems) - 1; i >= 0; i-- {
+			addr, ok := parseNode(elems[i]["for"])
+			if !ok {
+				break
+			}
+			idx = i
+			if !trusted(c.trustedProxies, addr) {
+				break
+			}
+		}
+		if idx < 0 {
+			return fwd
+		}
+
+		elem := elems[idx]
+		addr, _ := parseNode(elem["for"])
+		fwd.clientIP = addr.String()
+		if proto := elem["proto"]; proto != "" {
+			fwd.scheme = strings.ToLower(proto)
+		}
+		if host := elem["host"]; host != "" {
+			fwd.host = host
+		}
+		return fwd
+	}
+
+	if addrs := headerList(req.Header.Values("X-Forwarded-For")); len(addrs) > 0 {
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr, ok := parseNode(addrs[i])
+			if !ok {
+				break
+			}
+			fwd.clientIP = addr.String()
+			if !trusted(c.trustedProxies, addr) {
+				break
+			}
+		}
+	} else if addr, ok := parseNode(req.Header.Get("X-Real-IP")); ok {
+		fwd.clientIP = addr.String()
+	}
+
+	if protos := headerList(req.Header.Values("X-Forwarded-Proto")); len(protos) > 0 {
+		fwd.scheme = strings.ToLower(protos[len(protos)-1])
+	}
+	if hosts := headerList(req.Header.Values("X-Forwarded-Host")); len(hosts) > 0 {
+		fwd.host = hosts[len(hosts)-1]
+	}
+	return fwd
+}
+
+func trusted(proxies []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, proxy := range proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// forwardedElems parses the Forwarded headers ( RFC 7239 ) into the elements of lower-cased parameter names.
+func forwardedElems(values []string) []map[string]string {
+	var elems []map[string]string
+	for _, elem := range headerList(values) {
+		params := make(map[string]string)
+		for pair := range strings.SplitSeq(elem, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			params[strings.ToLower(key)] = strings.Trim(val, `"`)
+		}
+		elems = append(elems, params)
+	}
+	return elems
+}
+
+// headerList splits the comma separated values of the headers.
+func headerList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// parseNode parses the address of a node, e.g. 192.0.2.1, 192.0.2.1:8080 or [2001:db8::1]:8080,
+// the obfuscated and unknown nodes are not addresses.
+func parseNode(node string) (netip.Addr, bool) {
+	node = strings.TrimSpace(node)
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end < 0 {
+			return netip.Addr{}, false
+		}
+		node = node[1:end]
+	} else if strings.Count(node, ":") == 1 {
+		node, _, _ = strings.Cut(node, ":")
+	}
+
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
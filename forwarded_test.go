@@ -0,0 +1,150 @@
+package easyweb
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_ClientIP(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"}
+
+	tcs := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		tls        bool
+		header     http.Header
+		wantIP     string
+		wantScheme string
+		wantHost   string
+	}{
+		{
+			name:       "no trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.1"}, "X-Forwarded-Proto": {"https"}},
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		}, {
+			name:       "peer not trusted",
+			proxies:    proxies,
+			remoteAddr: "198.51.100.1:1234",
+			tls:        true,
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.1"}, "X-Forwarded-Host": {"evil.com"}},
+			wantIP:     "198.51.100.1",
+			wantScheme: "https",
+			wantHost:   "example.com",
+		}, {
+			name:       "no forwarded headers",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		}, {
+			name:       "x-forwarded-for",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header: http.Header{
+				// the spoofed address on the left is ignored
+				"X-Forwarded-For":   {"1.1.1.1, 203.0.113.1", "10.0.0.2"},
+				"X-Forwarded-Proto": {"http, HTTPS"},
+				"X-Forwarded-Host":  {"api.example.com"},
+			},
+			wantIP:     "203.0.113.1",
+			wantScheme: "https",
+			wantHost:   "api.example.com",
+		}, {
+			name:       "x-forwarded-for all trusted",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			wantIP:     "10.0.0.3",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		}, {
+			name:       "x-forwarded-for invalid",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.1, garbage"}},
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		}, {
+			name:       "x-real-ip",
+			proxies:    proxies,
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"X-Real-Ip": {"203.0.113.1"}},
+			wantIP:     "203.0.113.1",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		}, {
+			name:       "forwarded",
+			proxies:    proxies,
+			remoteAddr: "[2001:db8::1]:1234",
+			header: http.Header{
+				"Forwarded": {
+					`for=1.1.1.1;proto=http, for="[2606:4700::17]:4711";proto=https;host=api.example.com`,
+					`For=10.0.0.2;proto=http;host=internal`,
+				},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			wantIP:     "2606:4700::17",
+			wantScheme: "https",
+			wantHost:   "api.example.com",
+		}, {
+			name:       "forwarded obfuscated",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for=_hidden, for=10.0.0.2;proto=https`}},
+			wantIP:     "10.0.0.2",
+			wantScheme: "https",
+			wantHost:   "example.com",
+		}, {
+			name:       "forwarded unknown",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for=unknown;proto=https`}},
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := NewHttpServer(ServerWithTrustedProxiesOpt(tc.proxies...))
+
+			var ip, scheme, host string
+			svr.Get("/", func(ctx *Context) {
+				ip, scheme, host = ctx.ClientIP(), ctx.Scheme(), ctx.Host()
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			svr.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tc.wantIP, ip)
+			assert.Equal(t, tc.wantScheme, scheme)
+			assert.Equal(t, tc.wantHost, host)
+		})
+	}
+}
+
+func TestServerWithTrustedProxiesOpt(t *testing.T) {
+	assert.NotPanics(t, func() { ServerWithTrustedProxiesOpt(PrivateNetworks...) })
+	assert.PanicsWithError(t, `[easy_web] invalid trusted proxy 10.0.0.0/33: netip.ParsePrefix("10.0.0.0/33"): prefix length out of range`, func() {
+		ServerWithTrustedProxiesOpt("10.0.0.0/33")
+	})
+	assert.Panics(t, func() { ServerWithTrustedProxiesOpt("localhost") })
+}
@@ -1,35 +1,154 @@
 package easyweb
 
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
 type RouteGroup struct {
 	svr *HttpServer
 
 	basePath string
 	parent   *RouteGroup
 
-	mwChain MiddlewareChain
+	mwChain     MiddlewareChain
+	meta        map[string]any
+	notFoundHdl HandleFunc
+}
+
+func newRouteGroup(svr *HttpServer, path string, mws ...Middleware) *RouteGroup {
+	rg, err := tryNewRouteGroup(svr, path, mws...)
+	if err != nil {
+		panic(err)
+	}
+	return rg
 }
 
-func newRouteGroup(svr *HttpServer, path string) *RouteGroup {
+func tryNewRouteGroup(svr *HttpServer, path string, mws ...Middleware) (*RouteGroup, error) {
 	if path == "" || path[0] != '/' {
-		panic("[easy_web] path must start with '/'")
+		return nil, fmt.Errorf("[easy_web] group path %q must start with '/'", path)
 	}
 
 	return &RouteGroup{
 		svr:      svr,
 		basePath: path,
-	}
+		mwChain:  slices.Clone(mws),
+	}, nil
 }
 
+// Group creates a nested group whose path is prefixed by the parent's path.
+// The middlewares given here run after the parent's middlewares.
 func (rg *RouteGroup) Group(prefix string, mws ...Middleware) *RouteGroup {
-	newRg := newRouteGroup(rg.svr, prefix)
+	newRg := newRouteGroup(rg.svr, prefix, mws...)
 	newRg.parent = rg
 
 	return newRg
 }
 
+// TryGroup creates a nested group like Group, but returns an error instead of panicking.
+func (rg *RouteGroup) TryGroup(prefix string, mws ...Middleware) (*RouteGroup, error) {
+	newRg, err := tryNewRouteGroup(rg.svr, prefix, mws...)
+	if err != nil {
+		return nil, err
+	}
+
+	newRg.parent = rg
+	return newRg, nil
+}
+
 func (rg *RouteGroup) Route(method string, relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
-	mwChain := append(rg.getMwChain(), mws...)
-	rg.svr.Route(method, rg.getAbsPath()+relativePath, hdlFunc, mwChain...)
+	if err := rg.TryRoute(method, relativePath, hdlFunc, mws...); err != nil {
+		panic(err)
+	}
+}
+
+// TryRoute registers the route like Route, but returns a *RouteError instead of panicking.
+func (rg *RouteGroup) TryRoute(method string, relativePath string, hdlFunc HandleFunc, mws ...Middleware) error {
+	mwChain := rg.getMwChain()
+	mwChain = append(mwChain, mws...)
+
+	return rg.svr.tryRoute(method, joinPath(rg.getAbsPath(), relativePath), hdlFunc, rg.getMeta(), mwChain...)
+}
+
+// RemoveRoute unregisters the route registered through the group, see HttpServer.RemoveRoute.
+func (rg *RouteGroup) RemoveRoute(method string, relativePath string) error {
+	return rg.svr.RemoveRoute(method, joinPath(rg.getAbsPath(), relativePath))
+}
+
+// ReplaceRoute replaces the route registered through the group, see HttpServer.ReplaceRoute.
+// The group's middlewares are applied to the new handler as well.
+func (rg *RouteGroup) ReplaceRoute(method string, relativePath string, hdlFunc HandleFunc, mws ...Middleware) error {
+	mwChain := rg.getMwChain()
+	mwChain = append(mwChain, mws...)
+
+	return rg.svr.ReplaceRoute(method, joinPath(rg.getAbsPath(), relativePath), hdlFunc, mwChain...)
+}
+
+func (rg *RouteGroup) Get(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodGet, relativePath, hdlFunc, mws...)
+}
+
+func (rg *RouteGroup) Post(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodPost, relativePath, hdlFunc, mws...)
+}
+
+func (rg *RouteGroup) Put(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodPut, relativePath, hdlFunc, mws...)
+}
+
+func (rg *RouteGroup) Delete(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodDelete, relativePath, hdlFunc, mws...)
+}
+
+func (rg *RouteGroup) Patch(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodPatch, relativePath, hdlFunc, mws...)
+}
+
+func (rg *RouteGroup) Head(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodHead, relativePath, hdlFunc, mws...)
+}
+
+func (rg *RouteGroup) Options(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Route(http.MethodOptions, relativePath, hdlFunc, mws...)
+}
+
+// Any registers the handler for all standard http methods.
+func (rg *RouteGroup) Any(relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	rg.Match(anyMethods, relativePath, hdlFunc, mws...)
+}
+
+// Match registers the handler for each of the given methods.
+// It panics without registering any of the methods if one of them can not be registered.
+func (rg *RouteGroup) Match(methods []string, relativePath string, hdlFunc HandleFunc, mws ...Middleware) {
+	mwChain := rg.getMwChain()
+	mwChain = append(mwChain, mws...)
+
+	err := rg.svr.tryMatch(uniqMethods(methods), joinPath(rg.getAbsPath(), relativePath), hdlFunc, rg.getMeta(), mwChain...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NotFound sets the handler for requests under this group that match no route.
+// The handler runs through the group's middleware chain.
+// The group with the longest matching path wins.
+func (rg *RouteGroup) NotFound(hdlFunc HandleFunc) {
+	rg.notFoundHdl = hdlFunc
+	rg.svr.addGroupNotFound(rg)
+}
+
+// WithMeta attaches metadata to every route registered through this group (and its subgroups)
+// after the call. A subgroup overrides the values of its parent with the same key.
+// Handlers and middlewares read it through Context.RouteMeta.
+func (rg *RouteGroup) WithMeta(key string, val any) *RouteGroup {
+	if rg.meta == nil {
+		rg.meta = make(map[string]any)
+	}
+
+	rg.meta[key] = val
+	return rg
 }
 
 func (rg *RouteGroup) getAbsPath() string {
@@ -37,17 +156,50 @@ func (rg *RouteGroup) getAbsPath() string {
 		return rg.basePath
 	}
 
-	return rg.parent.getAbsPath() + rg.basePath
+	return joinPath(rg.parent.getAbsPath(), rg.basePath)
 }
 
 func (rg *RouteGroup) Use(mw ...Middleware) {
 	rg.mwChain = append(rg.mwChain, mw...)
 }
 
+// getMwChain returns a new slice on every call,
+// so appending to the result never touches the chain of a parent or sibling group.
 func (rg *RouteGroup) getMwChain() MiddlewareChain {
-	if rg.parent == nil {
-		return rg.mwChain
+	var parentChain MiddlewareChain
+	if rg.parent != nil {
+		parentChain = rg.parent.getMwChain()
+	}
+
+	mwChain := make(MiddlewareChain, 0, len(parentChain)+len(rg.mwChain))
+	mwChain = append(mwChain, parentChain...)
+	return append(mwChain, rg.mwChain...)
+}
+
+func (rg *RouteGroup) getMeta() map[string]any {
+	var meta map[string]any
+	if rg.parent != nil {
+		meta = rg.parent.getMeta()
+	}
+
+	if len(rg.meta) == 0 {
+		return meta
+	}
+
+	if meta == nil {
+		meta = make(map[string]any, len(rg.meta))
+	}
+	for k, v := range rg.meta {
+		meta[k] = v
+	}
+	return meta
+}
+
+// joinPath joins the group path and the relative path with exactly one '/' between them.
+func joinPath(base string, relative string) string {
+	if relative == "" {
+		return base
 	}
 
-	return append(rg.parent.getMwChain(), rg.mwChain...)
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(relative, "/")
 }
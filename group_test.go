@@ -2,6 +2,7 @@ package easyweb
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,7 +13,210 @@ func TestRouteGroup_Get(t *testing.T) {
 	rg := svr.Group("/api")
 	rg.Route(http.MethodGet, "/user", func(ctx *Context) {})
 
-	mi := svr.getRoute(http.MethodGet, "/api/user")
+	mi := svr.routes.Load().getRoute(http.MethodGet, "/api/user")
 	assert.NotNil(t, mi.node)
 	assert.NotNil(t, mi.node.handleFunc)
 }
+
+func TestRouteGroup_Verbs(t *testing.T) {
+	svr := NewHttpServer()
+	rg := svr.Group("/api")
+
+	mockHdlFunc := func(ctx *Context) {}
+	rg.Get("/user", mockHdlFunc)
+	rg.Post("/user", mockHdlFunc)
+	rg.Put("/user", mockHdlFunc)
+	rg.Delete("/user", mockHdlFunc)
+	rg.Patch("/user", mockHdlFunc)
+
+	for _, method := range []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch,
+	} {
+		mi := svr.routes.Load().getRoute(method, "/api/user")
+		assert.NotNil(t, mi.node, method)
+		svr.routes.Load().putMatchInfo(mi)
+	}
+}
+
+func TestRouteGroup_Nested(t *testing.T) {
+	svr := NewHttpServer()
+
+	var trace []string
+	mwFunc := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				trace = append(trace, name)
+				next(ctx)
+			}
+		}
+	}
+
+	api := svr.Group("/api", mwFunc("api"))
+	// leave spare capacity in the parent chain,
+	// siblings must not overwrite each other's middlewares through it
+	api.mwChain = append(make(MiddlewareChain, 0, 8), api.mwChain...)
+
+	v1 := api.Group("/v1", mwFunc("v1"))
+	v2 := api.Group("/v2/", mwFunc("v2"))
+
+	v1.Get("/user", func(ctx *Context) { trace = append(trace, "hdl") }, mwFunc("route"))
+	v2.Get("/user", func(ctx *Context) { trace = append(trace, "hdl") })
+
+	tcs := []struct {
+		name      string
+		path      string
+		wantTrace []string
+	}{
+		{
+			name:      "v1",
+			path:      "/api/v1/user",
+			wantTrace: []string{"api", "v1", "route", "hdl"},
+		}, {
+			name:      "v2",
+			path:      "/api/v2/user",
+			wantTrace: []string{"api", "v2", "hdl"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			trace = nil
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.wantTrace, trace)
+		})
+	}
+}
+
+func TestRouteGroup_NotFound(t *testing.T) {
+	svr := NewHttpServer()
+
+	api := svr.Group("/api")
+	api.NotFound(func(ctx *Context) {
+		_ = ctx.RespBytes(http.StatusNotFound, []byte("api not found"))
+	})
+
+	admin := api.Group("/admin", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.Resp.Header().Set("X-Admin", "true")
+			next(ctx)
+		}
+	})
+	admin.NotFound(func(ctx *Context) {
+		_ = ctx.RespBytes(http.StatusNotFound, []byte("admin not found"))
+	})
+
+	tcs := []struct {
+		name       string
+		path       string
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name:     "server",
+			path:     "/apix",
+			wantBody: "Not Found",
+		}, {
+			name:     "group",
+			path:     "/api/user",
+			wantBody: "api not found",
+		}, {
+			name:       "nested group",
+			path:       "/api/admin/user",
+			wantBody:   "admin not found",
+			wantHeader: "true",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantHeader, recorder.Header().Get("X-Admin"))
+		})
+	}
+}
+
+func TestRouteGroup_WithMeta(t *testing.T) {
+	svr := NewHttpServer()
+
+	api := svr.Group("/api").WithMeta("auth", "user").WithMeta("scope", "api")
+	admin := api.Group("/admin").WithMeta("auth", "admin")
+
+	var gotAuth, gotScope any
+	hdlFunc := func(ctx *Context) {
+		gotAuth, _ = ctx.RouteMeta("auth")
+		gotScope, _ = ctx.RouteMeta("scope")
+	}
+	api.Get("/user", hdlFunc)
+	admin.Get("/user", hdlFunc)
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user", nil))
+	assert.Equal(t, "user", gotAuth)
+	assert.Equal(t, "api", gotScope)
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/admin/user", nil))
+	assert.Equal(t, "admin", gotAuth)
+	assert.Equal(t, "api", gotScope)
+
+	// the parent group is not affected by its subgroup
+	_, ok := api.getMeta()["auth"]
+	assert.True(t, ok)
+	assert.Equal(t, "user", api.getMeta()["auth"])
+}
+
+func TestRouteGroup_ReplaceRoute(t *testing.T) {
+	svr := NewHttpServer()
+	rg := svr.Group("/api", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.Resp.Header().Set("X-Group", "api")
+			next(ctx)
+		}
+	})
+	rg.Get("/user", func(ctx *Context) {})
+
+	assert.NoError(t, rg.ReplaceRoute(http.MethodGet, "/user", func(ctx *Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("replaced"))
+	}))
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/user", nil))
+	assert.Equal(t, "replaced", recorder.Body.String())
+	assert.Equal(t, "api", recorder.Header().Get("X-Group"))
+
+	assert.NoError(t, rg.RemoveRoute(http.MethodGet, "/user"))
+	assert.Error(t, rg.RemoveRoute(http.MethodGet, "/user"))
+}
+
+func TestRouteGroup_callerMiddlewares(t *testing.T) {
+	svr := NewHttpServer()
+
+	var trace []string
+	mws := make([]Middleware, 1, 4)
+	mws[0] = func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			trace = append(trace, "group")
+			next(ctx)
+		}
+	}
+
+	rg := svr.Group("/api", mws...)
+
+	// reusing the slice must not change the chain of the group
+	mws[0] = func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			trace = append(trace, "reused")
+			next(ctx)
+		}
+	}
+	rg.Get("/user", func(ctx *Context) {})
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user", nil))
+	assert.Equal(t, []string{"group"}, trace)
+}
@@ -0,0 +1,27 @@
+// Package httpmethod bounds the http methods reported by the observability middlewares.
+package httpmethod
+
+import "net/http"
+
+// Other is reported for the unknown methods, as the OpenTelemetry semantic conventions do.
+const Other = "_OTHER"
+
+// Known reports whether the method is one of the standard http methods.
+func Known(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// Normalize returns the method if it is known, Other otherwise,
+// so that the clients sending arbitrary methods can not blow up the cardinality of the metrics.
+func Normalize(method string) string {
+	if Known(method) {
+		return method
+	}
+	return Other
+}
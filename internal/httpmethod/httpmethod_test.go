@@ -0,0 +1,15 @@
+package httpmethod
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, http.MethodGet, Normalize(http.MethodGet))
+	assert.Equal(t, http.MethodTrace, Normalize(http.MethodTrace))
+	assert.Equal(t, Other, Normalize("PROPFIND"))
+	assert.Equal(t, Other, Normalize("get"))
+}
@@ -0,0 +1,26 @@
+// Package netprefix parses the CIDRs and the single IPs configured for the trusted proxies and the ip filters.
+package netprefix
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Parse parses a CIDR ( masked ) or a single IP as the prefix of its full length, both IPv4 and IPv6.
+// The IPv4-mapped IPv6 addresses are unmapped.
+func Parse(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
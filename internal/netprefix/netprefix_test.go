@@ -0,0 +1,37 @@
+package netprefix
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		name    string
+		s       string
+		want    netip.Prefix
+		wantErr bool
+	}{
+		{name: "cidr", s: "10.1.2.3/8", want: netip.MustParsePrefix("10.0.0.0/8")},
+		{name: "ipv4", s: "192.0.2.1", want: netip.MustParsePrefix("192.0.2.1/32")},
+		{name: "ipv6", s: "2001:db8::1", want: netip.MustParsePrefix("2001:db8::1/128")},
+		{name: "mapped", s: "::ffff:192.0.2.1", want: netip.MustParsePrefix("192.0.2.1/32")},
+		{name: "invalid cidr", s: "10.0.0.0/33", wantErr: true},
+		{name: "invalid ip", s: "localhost", wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			prefix, err := Parse(tc.s)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, prefix)
+		})
+	}
+}
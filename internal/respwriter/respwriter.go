@@ -0,0 +1,68 @@
+// Package respwriter provides the http.ResponseWriter wrappers shared by the middlewares.
+package respwriter
+
+import (
+	"net/http"
+	"slices"
+)
+
+var (
+	_ http.ResponseWriter = (*Counting)(nil)
+	_ http.Flusher        = (*Counting)(nil)
+)
+
+// Counting records what the handler writes to the response directly.
+type Counting struct {
+	http.ResponseWriter
+	// Code is the status code written, 0 if nothing is written.
+	Code int
+	// Written is the number of the body bytes written.
+	Written int64
+}
+
+func (cw *Counting) WriteHeader(code int) {
+	if cw.Code == 0 {
+		cw.Code = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *Counting) Write(bs []byte) (int, error) {
+	if cw.Code == 0 {
+		cw.Code = http.StatusOK
+	}
+
+	n, err := cw.ResponseWriter.Write(bs)
+	cw.Written += int64(n)
+	return n, err
+}
+
+// Direct reports whether the handler has written the response directly,
+// which is then out of the reach of the middlewares replaying Context.Data ( e.g. cache and idempotency ).
+func (cw *Counting) Direct() bool {
+	return cw.Code != 0
+}
+
+func (cw *Counting) Flush() {
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer,
+// e.g. to hijack the connection or to set the deadlines.
+func (cw *Counting) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// ChangedHeader returns the headers set by the handler since the before was cloned, except the skipped ones.
+// The headers of the outer middlewares ( e.g. X-Request-ID ) are unchanged, they belong to the request
+// and must not be replayed for another one.
+func ChangedHeader(before http.Header, after http.Header, skip ...string) http.Header {
+	changed := make(http.Header)
+	for k, v := range after {
+		if slices.Contains(skip, k) || slices.Equal(before[k], v) {
+			continue
+		}
+		changed[k] = v
+	}
+	return changed
+}
@@ -0,0 +1,40 @@
+package respwriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounting(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	cw := &Counting{ResponseWriter: recorder}
+	assert.Zero(t, cw.Code)
+	assert.False(t, cw.Direct())
+
+	_, _ = cw.Write([]byte("hello"))
+	cw.WriteHeader(http.StatusNotFound)
+	_, _ = cw.Write([]byte(" world"))
+	assert.Equal(t, http.StatusOK, cw.Code)
+	assert.Equal(t, int64(11), cw.Written)
+
+	assert.NoError(t, http.NewResponseController(cw).Flush())
+	assert.True(t, recorder.Flushed)
+	assert.Same(t, recorder, cw.Unwrap())
+}
+
+func TestChangedHeader(t *testing.T) {
+	header := http.Header{"X-Request-Id": {"1"}, "Vary": {"Accept-Encoding"}}
+	before := header.Clone()
+
+	header.Set("Content-Type", "application/json")
+	header.Add("Vary", "Accept-Language")
+	header.Set("X-Cache", "MISS")
+
+	assert.Equal(t, http.Header{
+		"Content-Type": {"application/json"},
+		"Vary":         {"Accept-Encoding", "Accept-Language"},
+	}, ChangedHeader(before, header, "X-Cache"))
+}
@@ -1,58 +1,250 @@
 package accesslog
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"time"
 
 	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/internal/respwriter"
+	"github.com/JrMarcco/easy-web/middleware/requestid"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// userValueKey is the key of the user-defined fields in Context.UserValues.
+const userValueKey = "_accesslog_fields"
+
+// Entry is the access log record of a request.
+type Entry struct {
+	Time     time.Time
+	Host     string
+	Method   string
+	Path     string
+	URI      string
+	Proto    string
+	Route    string
+	Status   int
+	Latency  time.Duration
+	BytesIn  int64
+	BytesOut int64
+
+	ClientIP  string
+	UserAgent string
+	Referer   string
+	RequestID string
+	TraceID   string
+	SpanID    string
+
+	// Fields are the user-defined fields, see AddField and WithFieldsFunc.
+	Fields map[string]any
+}
+
+// MiddlewareBuilder logs a record for every request after it is handled.
+//
+// The record is formatted by the formatter ( JSON by default ) and passed to the log func or written to the writer,
+// or logged by the slog logger as attributes, whichever is configured last.
+// Wrap the writer by NewAsyncWriter so that logging never blocks the requests.
 type MiddlewareBuilder struct {
-	logFunc func(msg string)
+	formatter  Formatter
+	sink       func(ctx context.Context, e *Entry, formatter Formatter)
+	sampleRate float64
+	skipRoutes []string
+	filter     func(e *Entry) bool
+	fieldsFunc func(ctx *easyweb.Context) map[string]any
 }
 
+// WithLogFunc passes the formatted record to the func.
+// defaults to log.Println.
 func (b *MiddlewareBuilder) WithLogFunc(logFunc func(msg string)) *MiddlewareBuilder {
-	b.logFunc = logFunc
+	b.sink = func(_ context.Context, e *Entry, formatter Formatter) {
+		bs, err := formatter(e)
+		if err != nil {
+			logFunc(fmt.Sprintf("access log format error: %v", err))
+			return
+		}
+		logFunc(string(bs))
+	}
+	return b
+}
+
+// WithWriter writes the formatted records line by line to the writer, see NewAsyncWriter.
+func (b *MiddlewareBuilder) WithWriter(w io.Writer) *MiddlewareBuilder {
+	b.sink = func(_ context.Context, e *Entry, formatter Formatter) {
+		bs, err := formatter(e)
+		if err != nil {
+			bs = fmt.Appendf(nil, "access log format error: %v", err)
+		}
+		_, _ = w.Write(append(bs, '\n'))
+	}
+	return b
+}
+
+// WithSlog logs the records by the logger as attributes, the formatter is not used.
+// The level is Error for 5xx, Warn for 4xx and Info for the others.
+func (b *MiddlewareBuilder) WithSlog(logger *slog.Logger) *MiddlewareBuilder {
+	b.sink = func(ctx context.Context, e *Entry, _ Formatter) {
+		level := slog.LevelInfo
+		switch {
+		case e.Status >= 500:
+			level = slog.LevelError
+		case e.Status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(ctx, level, "access", slogAttrs(e)...)
+	}
+	return b
+}
+
+// WithFormatter formats the records for the log func and the writer.
+// defaults to JSONFormatter, see also CommonFormatter and CombinedFormatter.
+func (b *MiddlewareBuilder) WithFormatter(formatter Formatter) *MiddlewareBuilder {
+	b.formatter = formatter
+	return b
+}
+
+// WithSampleRate logs the successful requests ( status < 400 ) by the rate between 0 and 1,
+// the failed requests are always logged.
+// defaults to 1.
+func (b *MiddlewareBuilder) WithSampleRate(rate float64) *MiddlewareBuilder {
+	b.sampleRate = rate
+	return b
+}
+
+// WithSkipRoutes does not log the routes, the route is the registered pattern ( e.g. /healthz ).
+func (b *MiddlewareBuilder) WithSkipRoutes(routes ...string) *MiddlewareBuilder {
+	b.skipRoutes = routes
+	return b
+}
+
+// WithFilter logs the record only if the filter returns true, e.g. by the status code.
+func (b *MiddlewareBuilder) WithFilter(filter func(e *Entry) bool) *MiddlewareBuilder {
+	b.filter = filter
+	return b
+}
+
+// WithFieldsFunc adds the fields returned by the func to every record, see also AddField.
+func (b *MiddlewareBuilder) WithFieldsFunc(fieldsFunc func(ctx *easyweb.Context) map[string]any) *MiddlewareBuilder {
+	b.fieldsFunc = fieldsFunc
 	return b
 }
 
 func (b *MiddlewareBuilder) Build() easyweb.Middleware {
 	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
 		return func(ctx *easyweb.Context) {
+			start := time.Now()
+
+			var body *countingReader
+			if ctx.Req.Body != nil {
+				body = &countingReader{ReadCloser: ctx.Req.Body}
+				ctx.Req.Body = body
+			}
+
+			resp := ctx.Resp
+			cw := &respwriter.Counting{ResponseWriter: resp}
+			ctx.Resp = cw
+
 			defer func() {
-				al := &accessLog{
-					Host:   ctx.Req.Host,
-					Method: ctx.Req.Method,
-					Path:   ctx.Req.URL.Path,
-					Route:  ctx.MatchedRoute,
-					Status: ctx.StatusCode,
-				}
+				ctx.Resp = resp
 
-				data, err := json.Marshal(al)
-				if err != nil {
-					b.logFunc(fmt.Sprintf("access log marshal error: %v", err))
+				e := b.entry(ctx, start, body, cw)
+				if b.shouldLog(e) {
+					b.sink(ctx.TraceCtx, e, b.formatter)
 				}
-
-				b.logFunc(string(data))
 			}()
+
 			next(ctx)
 		}
 	}
 }
 
+func (b *MiddlewareBuilder) entry(ctx *easyweb.Context, start time.Time, body *countingReader, cw *respwriter.Counting) *Entry {
+	req := ctx.Req
+	e := &Entry{
+		Time:      start,
+		Host:      req.Host,
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		URI:       req.URL.RequestURI(),
+		Proto:     req.Proto,
+		Route:     ctx.MatchedRoute,
+		Status:    ctx.StatusCode,
+		Latency:   time.Since(start),
+		BytesOut:  cw.Written + int64(len(ctx.Data)),
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: req.UserAgent(),
+		Referer:   req.Referer(),
+		RequestID: requestid.Get(ctx),
+	}
+
+	if body != nil {
+		e.BytesIn = body.n
+	}
+
+	if e.Status == 0 {
+		// the handler wrote the response directly, or the response is an implicit 200
+		e.Status = cw.Code
+		if e.Status == 0 {
+			e.Status = 200
+		}
+	}
+
+	if sc := trace.SpanContextFromContext(ctx.TraceCtx); sc.IsValid() {
+		e.TraceID = sc.TraceID().String()
+		e.SpanID = sc.SpanID().String()
+	}
+
+	fields, _ := ctx.UserValues[userValueKey].(map[string]any)
+	if b.fieldsFunc != nil {
+		for k, v := range b.fieldsFunc(ctx) {
+			if fields == nil {
+				fields = make(map[string]any)
+			}
+			fields[k] = v
+		}
+	}
+	e.Fields = fields
+
+	return e
+}
+
+func (b *MiddlewareBuilder) shouldLog(e *Entry) bool {
+	if slices.Contains(b.skipRoutes, e.Route) && e.Route != "" {
+		return false
+	}
+
+	if b.filter != nil && !b.filter(e) {
+		return false
+	}
+
+	return e.Status >= 400 || b.sampleRate >= 1 || rand.Float64() < b.sampleRate
+}
+
 func NewMiddlewareBuilder() *MiddlewareBuilder {
-	return &MiddlewareBuilder{
-		logFunc: func(msg string) {
-			log.Println(msg)
-		},
+	b := &MiddlewareBuilder{
+		formatter:  JSONFormatter,
+		sampleRate: 1,
 	}
+
+	return b.WithLogFunc(func(msg string) {
+		log.Println(msg)
+	})
 }
 
-type accessLog struct {
-	Host   string `json:"host,omitempty"`
-	Method string `json:"method,omitempty"`
-	Path   string `json:"path,omitempty"`
-	Route  string `json:"route,omitempty"`
-	Status int    `json:"status,omitempty"`
+// AddField adds a user-defined field to the record of the request, e.g. the user id.
+func AddField(ctx *easyweb.Context, key string, val any) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+
+	fields, ok := ctx.UserValues[userValueKey].(map[string]any)
+	if !ok {
+		fields = make(map[string]any)
+		ctx.UserValues[userValueKey] = fields
+	}
+	fields[key] = val
 }
@@ -0,0 +1,259 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newServer(mws ...easyweb.Middleware) *easyweb.HttpServer {
+	svr := easyweb.NewHttpServer()
+	svr.Use(mws...)
+
+	svr.Post("/user/:id", func(ctx *easyweb.Context) {
+		_, _ = io.ReadAll(ctx.Req.Body)
+		AddField(ctx, "user_id", 1)
+		_ = ctx.RespBytes(http.StatusCreated, []byte("created"))
+	})
+	svr.Get("/stream", func(ctx *easyweb.Context) {
+		ctx.Resp.WriteHeader(http.StatusAccepted)
+		_, _ = ctx.Resp.Write([]byte("chunk"))
+		http.NewResponseController(ctx.Resp).Flush()
+	})
+	svr.Get("/healthz", func(ctx *easyweb.Context) { _ = ctx.Ok() })
+	svr.Get("/error", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusInternalServerError, nil)
+	})
+	return svr
+}
+
+func newRequest(method string, target string, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:5678"
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set(requestid.DefaultHeader, "req-1")
+	return req
+}
+
+func TestMiddlewareBuilder_Build_json(t *testing.T) {
+	var logged string
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	svr := newServer(
+		func(next easyweb.HandleFunc) easyweb.HandleFunc {
+			return func(ctx *easyweb.Context) {
+				ctx.TraceCtx = trace.ContextWithSpanContext(ctx.TraceCtx, trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID: traceID, SpanID: spanID,
+				}))
+				next(ctx)
+			}
+		},
+		NewMiddlewareBuilder().
+			WithLogFunc(func(msg string) { logged = msg }).
+			WithFieldsFunc(func(ctx *easyweb.Context) map[string]any {
+				return map[string]any{"tenant": "acme"}
+			}).
+			Build(),
+		requestid.NewMiddlewareBuilder().Build(),
+	)
+	svr.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "/user/1?debug=1", "hello"))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal([]byte(logged), &got))
+
+	assert.Contains(t, got, "time")
+	assert.Contains(t, got, "latency_ms")
+	delete(got, "time")
+	delete(got, "latency_ms")
+	assert.Equal(t, map[string]any{
+		"host":       "example.com",
+		"method":     "POST",
+		"path":       "/user/1",
+		"route":      "/user/:id",
+		"proto":      "HTTP/1.1",
+		"status":     float64(201),
+		"bytes_in":   float64(5),
+		"bytes_out":  float64(7),
+		"client_ip":  "10.0.0.1",
+		"user_agent": "curl/8.0",
+		"referer":    "https://example.com/",
+		"request_id": "req-1",
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":    "00f067aa0ba902b7",
+		"user_id":    float64(1),
+		"tenant":     "acme",
+	}, got)
+}
+
+func TestMiddlewareBuilder_Build_formats(t *testing.T) {
+	start := time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+
+	tcs := []struct {
+		name      string
+		formatter Formatter
+		req       *http.Request
+		want      string
+	}{
+		{
+			name:      "common",
+			formatter: CommonFormatter,
+			req:       newRequest(http.MethodPost, "/user/1?debug=1", "hello"),
+			want:      `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "POST /user/1?debug=1 HTTP/1.1" 201 7`,
+		}, {
+			name:      "combined",
+			formatter: CombinedFormatter,
+			req:       newRequest(http.MethodPost, "/user/1", ""),
+			want: `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "POST /user/1 HTTP/1.1" 201 7 ` +
+				`"https://example.com/" "curl/8.0"`,
+		}, {
+			name:      "direct write",
+			formatter: CommonFormatter,
+			req:       newRequest(http.MethodGet, "/stream", ""),
+			want:      `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /stream HTTP/1.1" 202 5`,
+		}, {
+			name:      "no body",
+			formatter: CombinedFormatter,
+			req: func() *http.Request {
+				req := newRequest(http.MethodGet, "/healthz", "")
+				req.Header.Del("Referer")
+				req.Header.Set("User-Agent", "evil\"\n agent")
+				return req
+			}(),
+			want: `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /healthz HTTP/1.1" 200 - "-" "evil\"\x0a agent"`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			svr := newServer(NewMiddlewareBuilder().
+				WithWriter(buf).
+				WithFormatter(func(e *Entry) ([]byte, error) {
+					e.Time = start
+					return tc.formatter(e)
+				}).
+				Build())
+			svr.ServeHTTP(httptest.NewRecorder(), tc.req)
+
+			assert.Equal(t, tc.want+"\n", buf.String())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_slog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+	svr := newServer(NewMiddlewareBuilder().WithSlog(logger).Build())
+	svr.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "/error", ""))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "ERROR", got["level"])
+	assert.Equal(t, "access", got["msg"])
+	assert.Equal(t, "/error", got["route"])
+	assert.Equal(t, float64(500), got["status"])
+	assert.Equal(t, "10.0.0.1", got["client_ip"])
+}
+
+func TestMiddlewareBuilder_Build_filter(t *testing.T) {
+	var logged []string
+	svr := newServer(NewMiddlewareBuilder().
+		WithLogFunc(func(msg string) { logged = append(logged, msg) }).
+		WithFormatter(func(e *Entry) ([]byte, error) { return []byte(e.Path), nil }).
+		WithSampleRate(0).
+		WithSkipRoutes("/healthz").
+		WithFilter(func(e *Entry) bool { return e.Method == http.MethodGet }).
+		Build())
+
+	for _, req := range []*http.Request{
+		newRequest(http.MethodGet, "/healthz", ""),
+		newRequest(http.MethodGet, "/stream", ""),
+		newRequest(http.MethodPost, "/user/1", ""),
+		newRequest(http.MethodGet, "/error", ""),
+		newRequest(http.MethodGet, "/missing", ""),
+	} {
+		svr.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the successful requests are sampled out, the failed ones are always logged
+	assert.Equal(t, []string{"/error", "/missing"}, logged)
+}
+
+func TestMiddlewareBuilder_Build_formatError(t *testing.T) {
+	var logged []string
+	svr := newServer(NewMiddlewareBuilder().
+		WithLogFunc(func(msg string) { logged = append(logged, msg) }).
+		WithFieldsFunc(func(ctx *easyweb.Context) map[string]any {
+			return map[string]any{"bad": make(chan int)}
+		}).
+		Build())
+	svr.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "/healthz", ""))
+
+	require.Len(t, logged, 1)
+	assert.True(t, strings.HasPrefix(logged[0], "access log format error"))
+}
+
+func TestAsyncWriter(t *testing.T) {
+	w := &blockingWriter{entered: make(chan struct{}), unblock: make(chan struct{})}
+	aw := NewAsyncWriter(w, 2)
+
+	// the first write is taken by the goroutine and blocks it, the next two fill the queue
+	_, err := aw.Write([]byte("1\n"))
+	require.NoError(t, err)
+	<-w.entered
+
+	for _, line := range []string{"2\n", "3\n", "4\n"} {
+		n, err := aw.Write([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+	}
+	assert.Equal(t, int64(1), aw.Dropped())
+
+	close(w.unblock)
+	require.NoError(t, aw.Close())
+	assert.Equal(t, "1\n2\n3\n", w.String())
+
+	_, err = aw.Write([]byte("5\n"))
+	assert.ErrorIs(t, err, errWriterClosed)
+}
+
+// blockingWriter blocks the writes until unblock is closed.
+type blockingWriter struct {
+	once    sync.Once
+	entered chan struct{}
+	unblock chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *blockingWriter) Write(bs []byte) (int, error) {
+	w.once.Do(func() { close(w.entered) })
+	<-w.unblock
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(bs)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
@@ -0,0 +1,139 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+)
+
+// Formatter formats the record into a line without the trailing newline.
+type Formatter func(e *Entry) ([]byte, error)
+
+// JSONFormatter formats the record as a JSON object, the empty fields are omitted
+// and the user-defined fields are merged into the object.
+func JSONFormatter(e *Entry) ([]byte, error) {
+	m := make(map[string]any, 16+len(e.Fields))
+	maps.Copy(m, e.Fields)
+
+	m["time"] = e.Time
+	m["method"] = e.Method
+	m["path"] = e.Path
+	m["status"] = e.Status
+	m["latency_ms"] = float64(e.Latency.Microseconds()) / 1000
+	m["bytes_in"] = e.BytesIn
+	m["bytes_out"] = e.BytesOut
+
+	for key, val := range map[string]string{
+		"host":       e.Host,
+		"route":      e.Route,
+		"proto":      e.Proto,
+		"client_ip":  e.ClientIP,
+		"user_agent": e.UserAgent,
+		"referer":    e.Referer,
+		"request_id": e.RequestID,
+		"trace_id":   e.TraceID,
+		"span_id":    e.SpanID,
+	} {
+		if val != "" {
+			m[key] = val
+		}
+	}
+
+	return json.Marshal(m)
+}
+
+// CommonFormatter formats the record in the Apache common log format:
+//
+//	127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 2326
+func CommonFormatter(e *Entry) ([]byte, error) {
+	return appendCommon(make([]byte, 0, 128), e), nil
+}
+
+// CombinedFormatter formats the record in the Apache combined log format,
+// the common log format followed by the referer and the user agent.
+func CombinedFormatter(e *Entry) ([]byte, error) {
+	bs := appendCommon(make([]byte, 0, 256), e)
+	bs = append(bs, ' ')
+	bs = appendQuoted(bs, e.Referer)
+	bs = append(bs, ' ')
+	return appendQuoted(bs, e.UserAgent), nil
+}
+
+func appendCommon(bs []byte, e *Entry) []byte {
+	bs = append(bs, orDash(e.ClientIP)...)
+	bs = append(bs, " - - ["...)
+	bs = e.Time.AppendFormat(bs, "02/Jan/2006:15:04:05 -0700")
+	bs = append(bs, "] "...)
+	bs = appendQuoted(bs, e.Method+" "+e.URI+" "+e.Proto)
+	bs = append(bs, ' ')
+	bs = strconv.AppendInt(bs, int64(e.Status), 10)
+	bs = append(bs, ' ')
+	if e.BytesOut == 0 {
+		return append(bs, '-')
+	}
+	return strconv.AppendInt(bs, e.BytesOut, 10)
+}
+
+// appendQuoted appends the value in double quotes, "-" if empty.
+// The quotes, backslashes and control characters are escaped to keep one record per line.
+func appendQuoted(bs []byte, val string) []byte {
+	if val == "" {
+		return append(bs, `"-"`...)
+	}
+
+	bs = append(bs, '"')
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		switch {
+		case c == '"' || c == '\\':
+			bs = append(bs, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			bs = fmt.Appendf(bs, `\x%02x`, c)
+		default:
+			bs = append(bs, c)
+		}
+	}
+	return append(bs, '"')
+}
+
+func orDash(val string) string {
+	if val == "" {
+		return "-"
+	}
+	return val
+}
+
+func slogAttrs(e *Entry) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 16+len(e.Fields))
+	attrs = append(attrs,
+		slog.String("method", e.Method),
+		slog.String("path", e.Path),
+		slog.Int("status", e.Status),
+		slog.Duration("latency", e.Latency),
+		slog.Int64("bytes_in", e.BytesIn),
+		slog.Int64("bytes_out", e.BytesOut),
+	)
+
+	for _, attr := range []slog.Attr{
+		slog.String("host", e.Host),
+		slog.String("route", e.Route),
+		slog.String("proto", e.Proto),
+		slog.String("client_ip", e.ClientIP),
+		slog.String("user_agent", e.UserAgent),
+		slog.String("referer", e.Referer),
+		slog.String("request_id", e.RequestID),
+		slog.String("trace_id", e.TraceID),
+		slog.String("span_id", e.SpanID),
+	} {
+		if attr.Value.String() != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	for key, val := range e.Fields {
+		attrs = append(attrs, slog.Any(key, val))
+	}
+	return attrs
+}
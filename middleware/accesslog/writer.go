@@ -0,0 +1,101 @@
+package accesslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var errWriterClosed = errors.New("[accesslog] async writer is closed")
+
+var _ io.WriteCloser = (*AsyncWriter)(nil)
+
+// AsyncWriter writes to the underlying writer in its own goroutine through a buffered queue,
+// so a slow disk or pipe never blocks the requests.
+// The writes are dropped when the queue is full, see Dropped.
+type AsyncWriter struct {
+	w     io.Writer
+	queue chan []byte
+	done  chan struct{}
+
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+}
+
+// NewAsyncWriter starts writing to w, the queue holds up to size writes.
+// Close it to flush the queued writes before exiting.
+func NewAsyncWriter(w io.Writer, size int) *AsyncWriter {
+	aw := &AsyncWriter{
+		w:     w,
+		queue: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+
+	go aw.run()
+	return aw
+}
+
+func (aw *AsyncWriter) run() {
+	defer close(aw.done)
+
+	bw := bufio.NewWriter(aw.w)
+	for bs := range aw.queue {
+		_, _ = bw.Write(bs)
+
+		// flush once the burst is written
+		if len(aw.queue) == 0 {
+			_ = bw.Flush()
+		}
+	}
+	_ = bw.Flush()
+}
+
+// Write queues a copy of bs, it never blocks.
+func (aw *AsyncWriter) Write(bs []byte) (int, error) {
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+
+	if aw.closed {
+		return 0, errWriterClosed
+	}
+
+	select {
+	case aw.queue <- append([]byte(nil), bs...):
+	default:
+		aw.dropped.Add(1)
+	}
+	return len(bs), nil
+}
+
+// Dropped returns the number of the writes dropped because the queue was full.
+func (aw *AsyncWriter) Dropped() int64 {
+	return aw.dropped.Load()
+}
+
+// Close flushes the queued writes to the underlying writer, which is not closed.
+func (aw *AsyncWriter) Close() error {
+	aw.mu.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.queue)
+	}
+	aw.mu.Unlock()
+
+	<-aw.done
+	return nil
+}
+
+// countingReader counts the bytes of the request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(bs []byte) (int, error) {
+	n, err := r.ReadCloser.Read(bs)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+var _ Authenticator = (*apiKeyAuthenticator)(nil)
+
+// APIKeyLookup returns the principal owning the key,
+// it returns ErrInvalidCredentials if the key is unknown.
+type APIKeyLookup func(ctx context.Context, key string) (*Principal, error)
+
+// APIKeys looks up the fixed keys.
+func APIKeys(keys map[string]*Principal) APIKeyLookup {
+	// look up by the digest so that the key does not leak by the timing of the map lookup
+	digests := make(map[[32]byte]*Principal, len(keys))
+	for key, p := range keys {
+		digests[sha256.Sum256([]byte(key))] = p
+	}
+
+	return func(ctx context.Context, key string) (*Principal, error) {
+		p, ok := digests[sha256.Sum256([]byte(key))]
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+
+		// the principal is shared by the requests
+		cp := *p
+		return &cp, nil
+	}
+}
+
+type APIKeyOpt func(*apiKeyAuthenticator)
+
+// APIKeyWithHeader the header carrying the key, an empty name disables the header.
+// defaults to "X-API-Key".
+func APIKeyWithHeader(name string) APIKeyOpt {
+	return func(a *apiKeyAuthenticator) {
+		a.header = name
+	}
+}
+
+// APIKeyWithQuery the query param carrying the key, the header wins if both are present.
+// disabled by default, since the query tends to end up in the logs.
+func APIKeyWithQuery(name string) APIKeyOpt {
+	return func(a *apiKeyAuthenticator) {
+		a.query = name
+	}
+}
+
+type apiKeyAuthenticator struct {
+	lookup APIKeyLookup
+	header string
+	query  string
+}
+
+func (a *apiKeyAuthenticator) Authenticate(ctx *easyweb.Context) (*Principal, error) {
+	var key string
+	if a.header != "" {
+		key = ctx.Req.Header.Get(a.header)
+	}
+	if key == "" && a.query != "" {
+		key, _ = ctx.QueryParam(a.query).String()
+	}
+
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	p, err := a.lookup(ctx.Req.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Scheme = SchemeAPIKey
+	return p, nil
+}
+
+func (a *apiKeyAuthenticator) Challenge(error) string {
+	return ""
+}
+
+// NewAPIKeyAuthenticator authenticates by the api key from the header or the query.
+func NewAPIKeyAuthenticator(lookup APIKeyLookup, opts ...APIKeyOpt) Authenticator {
+	a := &apiKeyAuthenticator{
+		lookup: lookup,
+		header: "X-API-Key",
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
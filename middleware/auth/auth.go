@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+const (
+	SchemeBasic  = "basic"
+	SchemeBearer = "bearer"
+	SchemeAPIKey = "apikey"
+)
+
+// userValueKey is the key of the principal in Context.UserValues.
+const userValueKey = "_auth_principal"
+
+var (
+	// ErrNoCredentials means the request carries no credentials of the authenticator's kind.
+	ErrNoCredentials = errors.New("[auth] no credentials")
+	// ErrInvalidCredentials means the credentials are present but rejected.
+	ErrInvalidCredentials = errors.New("[auth] invalid credentials")
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// ID identifies the caller, e.g. the username or the subject of the token.
+	ID string
+	// Scheme is how the caller authenticated, e.g. SchemeBasic.
+	Scheme      string
+	Roles       []string
+	Permissions []string
+	// Claims are the claims of the token, nil for the schemes without token.
+	Claims map[string]any
+}
+
+// Authenticator authenticates the request by one kind of credentials.
+type Authenticator interface {
+	// Authenticate returns ErrNoCredentials if the request carries no credentials of its kind,
+	// the next authenticator is tried in this case.
+	Authenticate(ctx *easyweb.Context) (*Principal, error)
+	// Challenge returns the WWW-Authenticate header value responding to err, empty for none.
+	Challenge(err error) string
+}
+
+// MiddlewareBuilder authenticates the request by the authenticators in order,
+// the first one finding its credentials decides.
+// The principal is stored in the context, see GetPrincipal.
+type MiddlewareBuilder struct {
+	authenticators []Authenticator
+	optional       bool
+	errMsg         string
+	logFunc        func(ctx *easyweb.Context, err error)
+}
+
+// WithOptional lets the requests without any credentials through anonymously,
+// the requests with rejected credentials are still answered with 401.
+func (b *MiddlewareBuilder) WithOptional(optional bool) *MiddlewareBuilder {
+	b.optional = optional
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when unauthenticated.
+// defaults to "Unauthorized"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+// WithLogFunc is called when the credentials are rejected.
+func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context, err error)) *MiddlewareBuilder {
+	b.logFunc = logFunc
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			challenges := make([]string, 0, len(b.authenticators))
+			for _, a := range b.authenticators {
+				p, err := a.Authenticate(ctx)
+				if err == nil {
+					SetPrincipal(ctx, p)
+					next(ctx)
+					return
+				}
+
+				if !errors.Is(err, ErrNoCredentials) {
+					b.logFunc(ctx, err)
+					b.unauthorized(ctx, a.Challenge(err))
+					return
+				}
+
+				challenges = append(challenges, a.Challenge(err))
+			}
+
+			if b.optional {
+				next(ctx)
+				return
+			}
+
+			b.unauthorized(ctx, challenges...)
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) unauthorized(ctx *easyweb.Context, challenges ...string) {
+	for _, challenge := range challenges {
+		if challenge != "" {
+			ctx.Resp.Header().Add("WWW-Authenticate", challenge)
+		}
+	}
+
+	ctx.StatusCode = http.StatusUnauthorized
+	ctx.Data = []byte(b.errMsg)
+}
+
+func NewMiddlewareBuilder(authenticators ...Authenticator) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		authenticators: authenticators,
+		errMsg:         "Unauthorized",
+		logFunc:        func(ctx *easyweb.Context, err error) {},
+	}
+}
+
+// GetPrincipal returns the principal authenticated by the middleware.
+func GetPrincipal(ctx *easyweb.Context) (*Principal, bool) {
+	p, ok := ctx.UserValues[userValueKey].(*Principal)
+	return p, ok
+}
+
+// SetPrincipal stores the principal in the context, e.g. for a custom authentication or in tests.
+func SetPrincipal(ctx *easyweb.Context, p *Principal) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[userValueKey] = p
+}
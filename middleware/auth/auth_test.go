@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	basic := NewBasicAuthenticator(BasicUsers(map[string]string{"tom": "secret"}), BasicWithRealm("admin"))
+	bearer := NewBearerAuthenticator(TokenVerifierFunc(func(ctx context.Context, token string) (*Principal, error) {
+		if token != "good-token" {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{ID: "jerry", Roles: []string{"admin"}}, nil
+	}))
+	apiKey := NewAPIKeyAuthenticator(APIKeys(map[string]*Principal{"key-1": {ID: "svc"}}), APIKeyWithQuery("api_key"))
+
+	tcs := []struct {
+		name           string
+		optional       bool
+		setReq         func(req *http.Request)
+		wantCode       int
+		wantID         string
+		wantScheme     string
+		wantChallenges []string
+	}{
+		{
+			name:     "basic",
+			setReq:   func(req *http.Request) { req.SetBasicAuth("tom", "secret") },
+			wantCode: http.StatusOK, wantID: "tom", wantScheme: SchemeBasic,
+		}, {
+			name:           "basic wrong password",
+			setReq:         func(req *http.Request) { req.SetBasicAuth("tom", "wrong") },
+			wantCode:       http.StatusUnauthorized,
+			wantChallenges: []string{`Basic realm="admin", charset="UTF-8"`},
+		}, {
+			name:           "basic unknown user",
+			setReq:         func(req *http.Request) { req.SetBasicAuth("jerry", "secret") },
+			wantCode:       http.StatusUnauthorized,
+			wantChallenges: []string{`Basic realm="admin", charset="UTF-8"`},
+		}, {
+			name:           "basic malformed",
+			setReq:         func(req *http.Request) { req.Header.Set("Authorization", "Basic !!!") },
+			wantCode:       http.StatusUnauthorized,
+			wantChallenges: []string{`Basic realm="admin", charset="UTF-8"`},
+		}, {
+			name:     "bearer",
+			setReq:   func(req *http.Request) { req.Header.Set("Authorization", "bearer good-token") },
+			wantCode: http.StatusOK, wantID: "jerry", wantScheme: SchemeBearer,
+		}, {
+			name:           "bearer invalid",
+			setReq:         func(req *http.Request) { req.Header.Set("Authorization", "Bearer bad-token") },
+			wantCode:       http.StatusUnauthorized,
+			wantChallenges: []string{`Bearer error="invalid_token"`},
+		}, {
+			name:     "api key header",
+			setReq:   func(req *http.Request) { req.Header.Set("X-API-Key", "key-1") },
+			wantCode: http.StatusOK, wantID: "svc", wantScheme: SchemeAPIKey,
+		}, {
+			name:     "api key query",
+			setReq:   func(req *http.Request) { req.URL.RawQuery = "api_key=key-1" },
+			wantCode: http.StatusOK, wantID: "svc", wantScheme: SchemeAPIKey,
+		}, {
+			name:           "api key invalid",
+			setReq:         func(req *http.Request) { req.Header.Set("X-API-Key", "key-2") },
+			wantCode:       http.StatusUnauthorized,
+			wantChallenges: nil,
+		}, {
+			name:     "no credentials",
+			setReq:   func(req *http.Request) {},
+			wantCode: http.StatusUnauthorized,
+			wantChallenges: []string{
+				`Basic realm="admin", charset="UTF-8"`,
+				"Bearer",
+			},
+		}, {
+			name:     "optional without credentials",
+			optional: true,
+			setReq:   func(req *http.Request) {},
+			wantCode: http.StatusOK,
+		}, {
+			name:           "optional with invalid credentials",
+			optional:       true,
+			setReq:         func(req *http.Request) { req.Header.Set("Authorization", "Bearer bad-token") },
+			wantCode:       http.StatusUnauthorized,
+			wantChallenges: []string{`Bearer error="invalid_token"`},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := easyweb.NewHttpServer()
+
+			var gotID, gotScheme string
+			svr.Get("/", func(ctx *easyweb.Context) {
+				if p, ok := GetPrincipal(ctx); ok {
+					gotID, gotScheme = p.ID, p.Scheme
+				}
+				_ = ctx.Ok()
+			}, NewMiddlewareBuilder(basic, bearer, apiKey).WithOptional(tc.optional).Build())
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tc.setReq(req)
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantID, gotID)
+			assert.Equal(t, tc.wantScheme, gotScheme)
+			assert.Equal(t, tc.wantChallenges, recorder.Header().Values("WWW-Authenticate"))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+var _ Authenticator = (*basicAuthenticator)(nil)
+
+// BasicChecker checks the username and the password,
+// it returns ErrInvalidCredentials if they mismatch.
+type BasicChecker func(ctx context.Context, username string, password string) (*Principal, error)
+
+// BasicUsers checks against the fixed username-password pairs.
+func BasicUsers(users map[string]string) BasicChecker {
+	// compare the digests so that neither the length nor the existence of the user leaks by timing
+	digests := make(map[string][32]byte, len(users))
+	for username, password := range users {
+		digests[username] = sha256.Sum256([]byte(password))
+	}
+
+	return func(ctx context.Context, username string, password string) (*Principal, error) {
+		want, ok := digests[username]
+		got := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(want[:], got[:]) != 1 || !ok {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{ID: username}, nil
+	}
+}
+
+type BasicOpt func(*basicAuthenticator)
+
+// BasicWithRealm the realm of the challenge.
+// defaults to "Restricted".
+func BasicWithRealm(realm string) BasicOpt {
+	return func(a *basicAuthenticator) {
+		a.realm = realm
+	}
+}
+
+type basicAuthenticator struct {
+	checker BasicChecker
+	realm   string
+}
+
+func (a *basicAuthenticator) Authenticate(ctx *easyweb.Context) (*Principal, error) {
+	username, password, ok := ctx.Req.BasicAuth()
+	if !ok {
+		if hasScheme(ctx.Req.Header.Get("Authorization"), "Basic") {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, ErrNoCredentials
+	}
+
+	p, err := a.checker(ctx.Req.Context(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.ID == "" {
+		p.ID = username
+	}
+	p.Scheme = SchemeBasic
+	return p, nil
+}
+
+func (a *basicAuthenticator) Challenge(error) string {
+	return "Basic realm=" + strconv.Quote(a.realm) + `, charset="UTF-8"`
+}
+
+// NewBasicAuthenticator authenticates by the HTTP Basic credentials ( RFC 7617 ).
+func NewBasicAuthenticator(checker BasicChecker, opts ...BasicOpt) Authenticator {
+	a := &basicAuthenticator{
+		checker: checker,
+		realm:   "Restricted",
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// hasScheme reports whether the Authorization header value uses the scheme, case-insensitively.
+func hasScheme(authorization string, scheme string) bool {
+	return len(authorization) > len(scheme) &&
+		strings.EqualFold(authorization[:len(scheme)], scheme) &&
+		authorization[len(scheme)] == ' '
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+var _ Authenticator = (*bearerAuthenticator)(nil)
+
+// TokenVerifier verifies the bearer token and returns the principal it represents,
+// see JWTVerifier.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+// TokenVerifierFunc adapts a function to TokenVerifier, e.g. for opaque tokens.
+type TokenVerifierFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f TokenVerifierFunc) Verify(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+type BearerOpt func(*bearerAuthenticator)
+
+// BearerWithRealm the realm of the challenge.
+// defaults to no realm.
+func BearerWithRealm(realm string) BearerOpt {
+	return func(a *bearerAuthenticator) {
+		a.realm = realm
+	}
+}
+
+type bearerAuthenticator struct {
+	verifier TokenVerifier
+	realm    string
+}
+
+func (a *bearerAuthenticator) Authenticate(ctx *easyweb.Context) (*Principal, error) {
+	authorization := ctx.Req.Header.Get("Authorization")
+	if !hasScheme(authorization, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	token := strings.TrimSpace(authorization[len("Bearer "):])
+	if token == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	p, err := a.verifier.Verify(ctx.Req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Scheme = SchemeBearer
+	return p, nil
+}
+
+// Challenge follows RFC 6750, the error is reported as invalid_token without the detail.
+func (a *bearerAuthenticator) Challenge(err error) string {
+	params := make([]string, 0, 2)
+	if a.realm != "" {
+		params = append(params, "realm="+strconv.Quote(a.realm))
+	}
+	if err != nil && !errors.Is(err, ErrNoCredentials) {
+		params = append(params, `error="invalid_token"`)
+	}
+
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// NewBearerAuthenticator authenticates by the bearer token of the Authorization header ( RFC 6750 ).
+func NewBearerAuthenticator(verifier TokenVerifier, opts ...BearerOpt) Authenticator {
+	a := &bearerAuthenticator{
+		verifier: verifier,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var _ KeySet = (*JWKS)(nil)
+
+// JWKS is a KeySet in the JSON Web Key Set format ( RFC 7517 ) loaded from a file or an url.
+// It supports the "RSA", "EC" ( P-256 ) and "oct" keys, the keys not for signing are ignored.
+//
+// The set is loaded on the first lookup and reloaded when it is older than the refresh interval,
+// or when a token carries an unknown key id, so that rotated keys are picked up.
+// A reload is attempted at most once per minute, whether it succeeds or not.
+// The set is fetched without holding up the lookups, which keep using the last loaded keys,
+// and the last loaded keys are kept if a reload fails.
+type JWKS struct {
+	fetch   func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]any
+	err         error
+	loadedAt    time.Time
+	attemptedAt time.Time
+	// loading is closed once the load in progress is done, nil if none.
+	loading chan struct{}
+}
+
+type JWKSOpt func(*JWKS)
+
+// JWKSWithRefresh the interval to reload the set, a non-positive interval loads it only once.
+// defaults to 1h.
+func JWKSWithRefresh(refresh time.Duration) JWKSOpt {
+	return func(s *JWKS) {
+		s.refresh = refresh
+	}
+}
+
+func (s *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	s.mu.Lock()
+	_, found := s.lookup(kid)
+	if s.loading == nil && s.needLoad(found) {
+		s.loading = make(chan struct{})
+		s.attemptedAt = time.Now()
+		s.mu.Unlock()
+
+		s.load(ctx)
+		s.mu.Lock()
+	}
+
+	if loading := s.loading; loading != nil && s.keys == nil {
+		// nothing to look up until the first load is done
+		s.mu.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		return nil, s.err
+	}
+
+	key, ok := s.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidCredentials, kid)
+	}
+	return key, nil
+}
+
+// needLoad reports whether to load the set, the caller must hold the lock.
+func (s *JWKS) needLoad(found bool) bool {
+	if time.Since(s.attemptedAt) < time.Minute {
+		return false
+	}
+
+	if s.keys == nil || !found {
+		return true
+	}
+	return s.refresh > 0 && time.Since(s.loadedAt) > s.refresh
+}
+
+// lookup finds the key by id, a token without kid is accepted if the set holds a single key.
+func (s *JWKS) lookup(kid string) (any, bool) {
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// load fetches the set without holding the lock and ends the load in progress.
+func (s *JWKS) load(ctx context.Context) {
+	keys, err := s.fetchKeys(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.loading)
+	s.loading = nil
+
+	if err != nil {
+		s.err = err
+		if ctx.Err() != nil {
+			// cut short by the caller, the source is not to blame
+			s.attemptedAt = time.Time{}
+		}
+		return
+	}
+
+	s.keys = keys
+	s.err = nil
+	s.loadedAt = time.Now()
+}
+
+func (s *JWKS) fetchKeys(ctx context.Context) (map[string]any, error) {
+	bs, err := s.fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[auth] load jwks failed: %w", err)
+	}
+	return parseJWKS(bs)
+}
+
+// NewFileJWKS loads the set from the local file.
+func NewFileJWKS(path string, opts ...JWKSOpt) *JWKS {
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}, opts)
+}
+
+// NewURLJWKS loads the set from the url, e.g. the jwks_uri of the identity provider.
+// The client defaults to http.DefaultClient if nil.
+func NewURLJWKS(url string, client *http.Client, opts ...JWKSOpt) *JWKS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}, opts)
+}
+
+func newJWKS(fetch func(ctx context.Context) ([]byte, error), opts []JWKSOpt) *JWKS {
+	s := &JWKS{
+		fetch:   fetch,
+		refresh: time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(bs []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(bs, &set); err != nil {
+		return nil, fmt.Errorf("[auth] invalid jwks: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("[auth] invalid jwk %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// key returns the key of the jwk, nil for the unsupported key types.
+func (k jwk) key() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		exp := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid rsa key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid ec key")
+		}
+
+		// let crypto/ecdh reject the points not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err = ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	default:
+		return nil, nil
+	}
+}
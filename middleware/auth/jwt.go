@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	ErrTokenMalformed   = fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	ErrTokenAlgorithm   = fmt.Errorf("%w: unexpected token algorithm", ErrInvalidCredentials)
+	ErrTokenSignature   = fmt.Errorf("%w: invalid token signature", ErrInvalidCredentials)
+	ErrTokenExpired     = fmt.Errorf("%w: token is expired", ErrInvalidCredentials)
+	ErrTokenNotValidYet = fmt.Errorf("%w: token is not valid yet", ErrInvalidCredentials)
+	ErrTokenIssuer      = fmt.Errorf("%w: unexpected token issuer", ErrInvalidCredentials)
+	ErrTokenAudience    = fmt.Errorf("%w: unexpected token audience", ErrInvalidCredentials)
+)
+
+var _ TokenVerifier = (*JWTVerifier)(nil)
+
+// KeySet looks up the key verifying the token by the key id ( the "kid" header ).
+// The key is a []byte for HS256, a *rsa.PublicKey for RS256 and an *ecdsa.PublicKey for ES256.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (any, error)
+}
+
+// StaticKeys is a fixed KeySet, the key with the empty id is used for the tokens with an unknown kid.
+type StaticKeys map[string]any
+
+func (s StaticKeys) Key(_ context.Context, kid string) (any, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	if key, ok := s[""]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidCredentials, kid)
+}
+
+// JWTVerifier verifies the JSON Web Token ( RFC 7519 ) signed by HS256, RS256 or ES256.
+// The "sub" claim becomes the principal's ID.
+type JWTVerifier struct {
+	keys       KeySet
+	algs       []string
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	rolesClaim string
+	permsClaim string
+	now        func() time.Time
+}
+
+type JWTOpt func(*JWTVerifier)
+
+// JWTWithAlgorithms the accepted algorithms, pin it to the algorithm of your keys.
+// defaults to HS256, RS256 and ES256.
+func JWTWithAlgorithms(algs ...string) JWTOpt {
+	return func(v *JWTVerifier) {
+		v.algs = algs
+	}
+}
+
+// JWTWithIssuer the expected "iss" claim, not checked by default.
+func JWTWithIssuer(issuer string) JWTOpt {
+	return func(v *JWTVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// JWTWithAudience the "aud" claim must contain the audience, not checked by default.
+func JWTWithAudience(audience string) JWTOpt {
+	return func(v *JWTVerifier) {
+		v.audience = audience
+	}
+}
+
+// JWTWithLeeway the clock skew tolerated by the "exp" and "nbf" checks.
+// defaults to 0.
+func JWTWithLeeway(leeway time.Duration) JWTOpt {
+	return func(v *JWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+// JWTWithRolesClaim the claim holding the principal's roles,
+// either an array of strings or a space-separated string.
+// defaults to "roles".
+func JWTWithRolesClaim(claim string) JWTOpt {
+	return func(v *JWTVerifier) {
+		v.rolesClaim = claim
+	}
+}
+
+// JWTWithPermissionsClaim the claim holding the principal's permissions,
+// either an array of strings or a space-separated string ( e.g. "scope" ).
+// defaults to "permissions".
+func JWTWithPermissionsClaim(claim string) JWTOpt {
+	return func(v *JWTVerifier) {
+		v.permsClaim = claim
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	// the algorithm is never trusted from the token alone, e.g. "none"
+	if !slices.Contains(v.algs, header.Alg) {
+		return nil, ErrTokenAlgorithm
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if err = v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &Principal{
+		ID:          sub,
+		Roles:       stringsClaim(claims[v.rolesClaim]),
+		Permissions: stringsClaim(claims[v.permsClaim]),
+		Claims:      claims,
+	}, nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]any) error {
+	now := v.now()
+
+	if exp, ok, err := numericDate(claims["exp"]); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+
+	if nbf, ok, err := numericDate(claims["nbf"]); err != nil {
+		return err
+	} else if ok && now.Add(v.leeway).Before(nbf) {
+		return ErrTokenNotValidYet
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return ErrTokenIssuer
+		}
+	}
+
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return ErrTokenAudience
+	}
+
+	return nil
+}
+
+func NewJWTVerifier(keys KeySet, opts ...JWTOpt) *JWTVerifier {
+	v := &JWTVerifier{
+		keys:       keys,
+		algs:       []string{AlgHS256, AlgRS256, AlgES256},
+		rolesClaim: "roles",
+		permsClaim: "permissions",
+		now:        time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+func decodeSegment(seg string, v any) error {
+	bs, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	if err = dec.Decode(v); err != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
+
+func verifySignature(alg string, key any, signingInput string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case AlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrTokenSignature
+		}
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrTokenAlgorithm
+		}
+
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrTokenSignature
+		}
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrTokenAlgorithm
+		}
+
+		// the signature is r || s, each 32 bytes ( RFC 7518 )
+		if len(sig) != 64 {
+			return ErrTokenSignature
+		}
+
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrTokenSignature
+		}
+	default:
+		return ErrTokenAlgorithm
+	}
+
+	return nil
+}
+
+// numericDate parses the NumericDate claim, ok is false if the claim is absent.
+func numericDate(val any) (t time.Time, ok bool, err error) {
+	if val == nil {
+		return time.Time{}, false, nil
+	}
+
+	num, isNum := val.(json.Number)
+	if !isNum {
+		return time.Time{}, false, ErrTokenMalformed
+	}
+
+	secs, err := num.Float64()
+	if err != nil {
+		return time.Time{}, false, ErrTokenMalformed
+	}
+	return time.UnixMilli(int64(secs * 1000)), true, nil
+}
+
+// stringsClaim reads a claim that is either a string or an array of strings,
+// a string is split by spaces like the "scope" claim.
+func stringsClaim(val any) []string {
+	switch v := val.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+// hasAudience checks the "aud" claim, which is either a string or an array of strings.
+func hasAudience(val any, audience string) bool {
+	if aud, ok := val.(string); ok {
+		return aud == audience
+	}
+	return slices.Contains(stringsClaim(val), audience)
+}
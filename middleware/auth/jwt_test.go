@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	keys := StaticKeys{"hs": secret, "rs": &rsaKey.PublicKey, "es": &ecKey.PublicKey}
+	verifier := NewJWTVerifier(
+		keys, JWTWithIssuer("easy-web"), JWTWithAudience("api"),
+		JWTWithLeeway(2*time.Second), JWTWithPermissionsClaim("scope"),
+	)
+	verifier.now = func() time.Time { return now }
+
+	validClaims := map[string]any{
+		"sub":   "tom",
+		"iss":   "easy-web",
+		"aud":   []string{"web", "api"},
+		"exp":   now.Add(time.Minute).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+		"roles": []string{"admin", "user"},
+		"scope": "order:read order:write",
+	}
+	withClaim := func(key string, val any) map[string]any {
+		claims := make(map[string]any, len(validClaims))
+		for k, v := range validClaims {
+			claims[k] = v
+		}
+		claims[key] = val
+		return claims
+	}
+
+	tcs := []struct {
+		name      string
+		token     string
+		wantErr   error
+		wantID    string
+		wantRoles []string
+		wantPerms []string
+	}{
+		{
+			name:      "HS256",
+			token:     signJWT(t, "HS256", "hs", secret, validClaims),
+			wantID:    "tom",
+			wantRoles: []string{"admin", "user"},
+			wantPerms: []string{"order:read", "order:write"},
+		}, {
+			name:      "RS256",
+			token:     signJWT(t, "RS256", "rs", rsaKey, validClaims),
+			wantID:    "tom",
+			wantRoles: []string{"admin", "user"},
+			wantPerms: []string{"order:read", "order:write"},
+		}, {
+			name:      "ES256",
+			token:     signJWT(t, "ES256", "es", ecKey, validClaims),
+			wantID:    "tom",
+			wantRoles: []string{"admin", "user"},
+			wantPerms: []string{"order:read", "order:write"},
+		}, {
+			name: "string audience and space-separated roles",
+			token: signJWT(t, "HS256", "hs", secret, map[string]any{
+				"sub": "tom", "iss": "easy-web", "aud": "api", "exp": now.Add(time.Minute).Unix(),
+				"roles": "admin user", "scope": "order:read",
+			}),
+			wantID:    "tom",
+			wantRoles: []string{"admin", "user"},
+			wantPerms: []string{"order:read"},
+		}, {
+			name:    "malformed",
+			token:   "a.b",
+			wantErr: ErrTokenMalformed,
+		}, {
+			name:    "none algorithm",
+			token:   signJWT(t, "none", "hs", nil, validClaims),
+			wantErr: ErrTokenAlgorithm,
+		}, {
+			name: "HS256 with the public key",
+			// the RSA public key must never be used as an HMAC secret
+			token:   signJWT(t, "HS256", "rs", []byte("whatever"), validClaims),
+			wantErr: ErrTokenAlgorithm,
+		}, {
+			name:    "wrong secret",
+			token:   signJWT(t, "HS256", "hs", []byte("wrong"), validClaims),
+			wantErr: ErrTokenSignature,
+		}, {
+			name:    "expired",
+			token:   signJWT(t, "HS256", "hs", secret, withClaim("exp", now.Add(-3*time.Second).Unix())),
+			wantErr: ErrTokenExpired,
+		}, {
+			name:      "expired within leeway",
+			token:     signJWT(t, "HS256", "hs", secret, withClaim("exp", now.Add(-time.Second).Unix())),
+			wantID:    "tom",
+			wantRoles: []string{"admin", "user"},
+			wantPerms: []string{"order:read", "order:write"},
+		}, {
+			name:    "not valid yet",
+			token:   signJWT(t, "HS256", "hs", secret, withClaim("nbf", now.Add(time.Minute).Unix())),
+			wantErr: ErrTokenNotValidYet,
+		}, {
+			name:    "wrong issuer",
+			token:   signJWT(t, "HS256", "hs", secret, withClaim("iss", "other")),
+			wantErr: ErrTokenIssuer,
+		}, {
+			name:    "wrong audience",
+			token:   signJWT(t, "HS256", "hs", secret, withClaim("aud", []string{"web"})),
+			wantErr: ErrTokenAudience,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := verifier.Verify(context.Background(), tc.token)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+
+			assert.Equal(t, tc.wantID, p.ID)
+			assert.Equal(t, tc.wantRoles, p.Roles)
+			assert.Equal(t, tc.wantPerms, p.Permissions)
+			assert.Equal(t, "easy-web", p.Claims["iss"])
+		})
+	}
+}
+
+func TestJWKS_Key(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rs", "use": "sig",
+				"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			}, {
+				"kty": "EC", "kid": "es", "crv": "P-256",
+				"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+			}, {
+				"kty": "RSA", "kid": "enc", "use": "enc",
+				"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0o600))
+
+	var hits int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write(jwks)
+	}))
+	defer upstream.Close()
+
+	claims := map[string]any{"sub": "tom", "exp": time.Now().Add(time.Minute).Unix()}
+
+	for name, keySet := range map[string]*JWKS{
+		"file": NewFileJWKS(path),
+		"url":  NewURLJWKS(upstream.URL, upstream.Client()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			verifier := NewJWTVerifier(keySet)
+
+			p, err := verifier.Verify(context.Background(), signJWT(t, "RS256", "rs", rsaKey, claims))
+			require.NoError(t, err)
+			assert.Equal(t, "tom", p.ID)
+
+			p, err = verifier.Verify(context.Background(), signJWT(t, "ES256", "es", ecKey, claims))
+			require.NoError(t, err)
+			assert.Equal(t, "tom", p.ID)
+
+			_, err = verifier.Verify(context.Background(), signJWT(t, "RS256", "enc", rsaKey, claims))
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+
+	// the unknown key id does not reload the fresh set
+	assert.Equal(t, 1, hits)
+}
+
+func TestJWKS_reload(t *testing.T) {
+	secret := []byte("secret")
+	jwks := []byte(`{"keys":[{"kty":"oct","kid":"hs","k":"` + b64(secret) + `"}]}`)
+
+	// a failed load is not retried at once
+	var fails atomic.Int32
+	failing := newJWKS(func(ctx context.Context) ([]byte, error) {
+		fails.Add(1)
+		return nil, errors.New("unavailable")
+	}, nil)
+	for i := 0; i < 10; i++ {
+		_, err := failing.Key(context.Background(), "hs")
+		assert.ErrorContains(t, err, "unavailable")
+	}
+	assert.Equal(t, int32(1), fails.Load())
+
+	// the lookups keep using the loaded keys while reloading
+	var loads atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	keySet := newJWKS(func(ctx context.Context) ([]byte, error) {
+		if loads.Add(1) > 1 {
+			close(started)
+			<-release
+			return nil, errors.New("unavailable")
+		}
+		return jwks, nil
+	}, nil)
+
+	key, err := keySet.Key(context.Background(), "hs")
+	require.NoError(t, err)
+	assert.Equal(t, secret, key)
+
+	keySet.mu.Lock()
+	keySet.attemptedAt = time.Now().Add(-2 * time.Minute)
+	keySet.mu.Unlock()
+
+	done := make(chan error)
+	go func() {
+		_, err := keySet.Key(context.Background(), "rotated")
+		done <- err
+	}()
+	<-started
+
+	key, err = keySet.Key(context.Background(), "hs")
+	require.NoError(t, err)
+	assert.Equal(t, secret, key)
+
+	close(release)
+	assert.ErrorIs(t, <-done, ErrInvalidCredentials)
+
+	// the keys are kept and the unknown key id is not retried at once
+	_, err = keySet.Key(context.Background(), "rotated")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	key, err = keySet.Key(context.Background(), "hs")
+	require.NoError(t, err)
+	assert.Equal(t, secret, key)
+	assert.Equal(t, int32(2), loads.Load())
+}
+
+func signJWT(t *testing.T, alg string, kid string, key any, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signingInput + "." + b64(sig)
+}
+
+func b64(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
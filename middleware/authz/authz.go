@@ -0,0 +1,257 @@
+package authz
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/auth"
+)
+
+// MetaKey is the route metadata key of the routes' Requirement, e.g.
+//
+//	admin := svr.Group("/admin").WithMeta(authz.MetaKey, authz.Requirement{Roles: []string{"admin"}})
+const MetaKey = "authz"
+
+// Requirement is what the principal needs to access a route.
+// The zero value requires an authenticated principal only.
+type Requirement struct {
+	// Public lets the anonymous requests through, the other fields are ignored.
+	Public bool
+	// Roles the principal must have any of.
+	Roles []string
+	// Permissions the principal must have all of.
+	Permissions []string
+	// Policies the names of the attribute-based policies which must all allow,
+	// see MiddlewareBuilder.WithPolicy.
+	Policies []string
+}
+
+// Policy is an attribute-based rule, e.g. the principal owns the requested resource.
+type Policy func(ctx *easyweb.Context, p *auth.Principal) bool
+
+// MiddlewareBuilder enforces the Requirement of the matched route on the principal
+// stored by the auth middleware, so it must run after the auth middleware.
+// It answers 401 if the route is not public and the request is anonymous,
+// and 403 if the principal does not meet the requirement.
+//
+// The requirement of a route is looked up in order from WithRouteRequirement, the route metadata
+// and WithDefault. The requests matching no route are let through to the not found handler.
+type MiddlewareBuilder struct {
+	evaluator         Evaluator
+	policies          map[string]Policy
+	routeRequirements map[string]Requirement
+	defaultReq        Requirement
+	logFunc           func(ctx *easyweb.Context, msg string)
+}
+
+// WithEvaluator decides whether the principal has the roles and permissions.
+// defaults to RBAC(nil), which checks the principal's own roles and permissions.
+func (b *MiddlewareBuilder) WithEvaluator(evaluator Evaluator) *MiddlewareBuilder {
+	b.evaluator = evaluator
+	return b
+}
+
+// WithPolicy registers the policy referred by Requirement.Policies.
+func (b *MiddlewareBuilder) WithPolicy(name string, policy Policy) *MiddlewareBuilder {
+	b.policies[name] = policy
+	return b
+}
+
+// WithRouteRequirement overrides the requirement of the route, the route is the registered pattern ( e.g. /order/:id ).
+func (b *MiddlewareBuilder) WithRouteRequirement(route string, req Requirement) *MiddlewareBuilder {
+	b.routeRequirements[route] = req
+	return b
+}
+
+// WithDefault the requirement of the routes without one.
+// defaults to the zero Requirement, i.e. any authenticated principal.
+func (b *MiddlewareBuilder) WithDefault(req Requirement) *MiddlewareBuilder {
+	b.defaultReq = req
+	return b
+}
+
+// WithLogFunc is called when a requirement refers to an unregistered policy, the request is denied in this case.
+func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context, msg string)) *MiddlewareBuilder {
+	b.logFunc = logFunc
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			if ctx.MatchedRoute == "" {
+				next(ctx)
+				return
+			}
+
+			p, _ := auth.GetPrincipal(ctx)
+			code := b.decide(ctx, p, b.requirement(ctx.MatchedRoute, ctx.RouteMeta))
+			if code != http.StatusOK {
+				ctx.StatusCode = code
+				ctx.Data = []byte(http.StatusText(code))
+				return
+			}
+
+			next(ctx)
+		}
+	}
+}
+
+// decide returns 200 if the principal meets the requirement, 401 or 403 otherwise.
+// p is nil for the anonymous requests.
+func (b *MiddlewareBuilder) decide(ctx *easyweb.Context, p *auth.Principal, req Requirement) int {
+	if req.Public {
+		return http.StatusOK
+	}
+	if p == nil {
+		return http.StatusUnauthorized
+	}
+
+	if !b.evaluator.Evaluate(ctx, p, req) {
+		return http.StatusForbidden
+	}
+
+	for _, name := range req.Policies {
+		policy, ok := b.policies[name]
+		if !ok {
+			b.logFunc(ctx, "unregistered policy "+name)
+			return http.StatusForbidden
+		}
+
+		if !policy(ctx, p) {
+			return http.StatusForbidden
+		}
+	}
+	return http.StatusOK
+}
+
+func (b *MiddlewareBuilder) requirement(route string, routeMeta func(key string) (any, bool)) Requirement {
+	if req, ok := b.routeRequirements[route]; ok {
+		return req
+	}
+
+	if val, ok := routeMeta(MetaKey); ok {
+		if req, ok := val.(Requirement); ok {
+			return req
+		}
+	}
+
+	return b.defaultReq
+}
+
+// Decision is the result of the principal on a route, see Decisions.
+type Decision struct {
+	Method string
+	Route  string
+	// StatusCode is 200 if allowed, 401 or 403 otherwise.
+	StatusCode int
+	// Attached reports whether an authz middleware is in the middleware chain of the route,
+	// the route is open to anyone with the status code 200 otherwise.
+	Attached bool
+}
+
+// Decisions evaluates the principal ( nil for anonymous ) on every route of the server without serving,
+// e.g. to assert the policies of the whole route table in tests, see the authztest package.
+// The policies see a context carrying only the method and the route pattern as the path.
+//
+// The middleware is looked up in the chain of every route as it is passed to Use or the route,
+// a middleware wrapping it is not recognized.
+func (b *MiddlewareBuilder) Decisions(svr *easyweb.HttpServer, p *auth.Principal) []Decision {
+	routes := svr.Routes()
+	res := make([]Decision, 0, len(routes))
+	for _, ri := range routes {
+		if !b.attached(ri.Middlewares) {
+			res = append(res, Decision{Method: ri.Method, Route: ri.Path, StatusCode: http.StatusOK})
+			continue
+		}
+
+		ctx := &easyweb.Context{
+			Req: &http.Request{
+				Method: ri.Method,
+				URL:    &url.URL{Path: ri.Path},
+				Header: make(http.Header),
+			},
+			MatchedRoute: ri.Path,
+		}
+
+		req := b.requirement(ri.Path, func(key string) (any, bool) {
+			val, ok := ri.Meta[key]
+			return val, ok
+		})
+		res = append(res, Decision{Method: ri.Method, Route: ri.Path, StatusCode: b.decide(ctx, p, req), Attached: true})
+	}
+	return res
+}
+
+// attached reports whether an authz middleware is in the chain by comparing the functions,
+// so that nothing of the chain runs.
+func (b *MiddlewareBuilder) attached(chain easyweb.MiddlewareChain) bool {
+	// the middlewares built share the code pointer
+	want := reflect.ValueOf(b.Build()).Pointer()
+	return slices.ContainsFunc(chain, func(mw easyweb.Middleware) bool {
+		return reflect.ValueOf(mw).Pointer() == want
+	})
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		evaluator:         RBAC(nil),
+		policies:          make(map[string]Policy),
+		routeRequirements: make(map[string]Requirement),
+		logFunc: func(ctx *easyweb.Context, msg string) {
+			log.Printf("authorization failed in path %s: %s", ctx.Req.URL.Path, msg)
+		},
+	}
+}
+
+// Evaluator decides whether the principal has the roles and permissions of the requirement.
+type Evaluator interface {
+	Evaluate(ctx *easyweb.Context, p *auth.Principal, req Requirement) bool
+}
+
+// EvaluatorFunc adapts a function to Evaluator.
+type EvaluatorFunc func(ctx *easyweb.Context, p *auth.Principal, req Requirement) bool
+
+func (f EvaluatorFunc) Evaluate(ctx *easyweb.Context, p *auth.Principal, req Requirement) bool {
+	return f(ctx, p, req)
+}
+
+var _ Evaluator = RBAC(nil)
+
+// RBAC is the role table mapping a role to the permissions it grants,
+// the principal has its own permissions plus the ones granted by its roles.
+// The permission "*" grants all the permissions.
+type RBAC map[string][]string
+
+func (r RBAC) Evaluate(_ *easyweb.Context, p *auth.Principal, req Requirement) bool {
+	if len(req.Roles) > 0 && !slices.ContainsFunc(req.Roles, func(role string) bool {
+		return slices.Contains(p.Roles, role)
+	}) {
+		return false
+	}
+
+	for _, perm := range req.Permissions {
+		if !r.hasPermission(p, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r RBAC) hasPermission(p *auth.Principal, perm string) bool {
+	if slices.Contains(p.Permissions, perm) || slices.Contains(p.Permissions, "*") {
+		return true
+	}
+
+	for _, role := range p.Roles {
+		granted := r[role]
+		if slices.Contains(granted, perm) || slices.Contains(granted, "*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package authz_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/auth"
+	"github.com/JrMarcco/easy-web/middleware/authz"
+	"github.com/JrMarcco/easy-web/middleware/authz/authztest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	admin  = &auth.Principal{ID: "admin", Roles: []string{"admin"}}
+	editor = &auth.Principal{ID: "editor", Roles: []string{"editor"}}
+	tom    = &auth.Principal{ID: "tom", Permissions: []string{"order:read"}}
+)
+
+func newServer(b *authz.MiddlewareBuilder) *easyweb.HttpServer {
+	principals := map[string]*auth.Principal{"admin": admin, "editor": editor, "tom": tom}
+	authMw := auth.NewMiddlewareBuilder(auth.NewBearerAuthenticator(
+		auth.TokenVerifierFunc(func(ctx context.Context, token string) (*auth.Principal, error) {
+			p, ok := principals[token]
+			if !ok {
+				return nil, auth.ErrInvalidCredentials
+			}
+			cp := *p
+			return &cp, nil
+		}),
+	)).WithOptional(true).Build()
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(authMw, b.Build())
+
+	hdlFunc := func(ctx *easyweb.Context) { _ = ctx.Ok() }
+
+	svr.Get("/", hdlFunc)
+	svr.Get("/profile", hdlFunc)
+
+	orders := svr.Group("/order").WithMeta(authz.MetaKey, authz.Requirement{Permissions: []string{"order:read"}})
+	orders.Get("/:id", hdlFunc)
+
+	adminGroup := svr.Group("/admin").WithMeta(authz.MetaKey, authz.Requirement{Roles: []string{"admin"}})
+	adminGroup.Get("/user", hdlFunc)
+	// the subgroup overrides the requirement of its parent
+	adminGroup.Group("/user").
+		WithMeta(authz.MetaKey, authz.Requirement{Policies: []string{"self"}}).
+		Delete("/:id", hdlFunc)
+	return svr
+}
+
+func newBuilder() *authz.MiddlewareBuilder {
+	return authz.NewMiddlewareBuilder().
+		WithEvaluator(authz.RBAC{"admin": {"*"}, "editor": {"order:read"}}).
+		WithRouteRequirement("/", authz.Requirement{Public: true}).
+		WithPolicy("self", func(ctx *easyweb.Context, p *auth.Principal) bool {
+			id, _ := ctx.PathParam("id").String()
+			return id == p.ID
+		})
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := newServer(newBuilder())
+
+	tcs := []struct {
+		name     string
+		token    string
+		path     string
+		method   string
+		wantCode int
+	}{
+		{name: "public", path: "/", wantCode: http.StatusOK},
+		{name: "anonymous", path: "/profile", wantCode: http.StatusUnauthorized},
+		{name: "authenticated", token: "tom", path: "/profile", wantCode: http.StatusOK},
+		{name: "own permission", token: "tom", path: "/order/1", wantCode: http.StatusOK},
+		{name: "permission by role", token: "editor", path: "/order/1", wantCode: http.StatusOK},
+		{name: "wildcard permission", token: "admin", path: "/order/1", wantCode: http.StatusOK},
+		{name: "missing role", token: "editor", path: "/admin/user", wantCode: http.StatusForbidden},
+		{name: "role", token: "admin", path: "/admin/user", wantCode: http.StatusOK},
+		{name: "policy allows", token: "tom", method: http.MethodDelete, path: "/admin/user/tom", wantCode: http.StatusOK},
+		{name: "policy denies", token: "tom", method: http.MethodDelete, path: "/admin/user/admin", wantCode: http.StatusForbidden},
+		{name: "not found", path: "/missing", wantCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_unregisteredPolicy(t *testing.T) {
+	var logged string
+	b := newBuilder().
+		WithRouteRequirement("/profile", authz.Requirement{Policies: []string{"unknown"}}).
+		WithLogFunc(func(ctx *easyweb.Context, msg string) { logged = msg })
+
+	authztest.AssertStatus(t, newServer(b), b, tom, map[string]int{"GET /profile": http.StatusForbidden})
+	assert.Equal(t, "unregistered policy unknown", logged)
+}
+
+func TestRouteTable(t *testing.T) {
+	b := newBuilder()
+	svr := newServer(b)
+
+	authztest.AssertAllowed(t, svr, b, nil, "GET /")
+	authztest.AssertAllowed(t, svr, b, tom, "GET /", "GET /profile", "GET /order/:id")
+	authztest.AssertAllowed(t, svr, b, editor, "GET /", "GET /profile", "GET /order/:id")
+	// the "self" policy can not match the pattern as the path param
+	authztest.AssertAllowed(t, svr, b, admin, "GET /", "GET /profile", "GET /order/:id", "GET /admin/user")
+
+	authztest.AssertStatus(t, svr, b, nil, map[string]int{
+		"GET /admin/user": http.StatusUnauthorized,
+	})
+	authztest.AssertStatus(t, svr, b, editor, map[string]int{
+		"GET /admin/user":        http.StatusForbidden,
+		"DELETE /admin/user/:id": http.StatusForbidden,
+	})
+}
+
+func TestAssertAllowed_unprotectedRoute(t *testing.T) {
+	b := newBuilder().WithDefault(authz.Requirement{Public: true})
+	svr := newServer(b)
+	svr.Get("/debug", func(ctx *easyweb.Context) {})
+
+	mockT := &testing.T{}
+	assert.False(t, authztest.AssertAllowed(mockT, svr, b, nil, "GET /"))
+}
+
+func TestAssertAllowed_notAttached(t *testing.T) {
+	b := newBuilder()
+
+	svr := easyweb.NewHttpServer()
+	hdlFunc := func(ctx *easyweb.Context) { _ = ctx.Ok() }
+	svr.Group("/admin", b.Build()).Get("/user", hdlFunc)
+	// registered without the middleware, its chain is not composed by Decisions
+	composed := 0
+	svr.Get("/internal/user", hdlFunc, func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		composed++
+		return next
+	})
+	composed = 0
+
+	decisions := b.Decisions(svr, nil)
+	assert.Equal(t, []authz.Decision{
+		{Method: http.MethodGet, Route: "/admin/user", StatusCode: http.StatusUnauthorized, Attached: true},
+		{Method: http.MethodGet, Route: "/internal/user", StatusCode: http.StatusOK},
+	}, decisions)
+	assert.Zero(t, composed)
+
+	mockT := &testing.T{}
+	assert.False(t, authztest.AssertAllowed(mockT, svr, b, admin, "GET /admin/user", "GET /internal/user"))
+	assert.False(t, authztest.AssertStatus(mockT, svr, b, nil, map[string]int{"GET /internal/user": http.StatusOK}))
+	assert.True(t, authztest.AssertStatus(t, svr, b, nil, map[string]int{"GET /admin/user": http.StatusUnauthorized}))
+}
@@ -0,0 +1,82 @@
+package authztest
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/auth"
+	"github.com/JrMarcco/easy-web/middleware/authz"
+)
+
+// AssertAllowed asserts the principal ( nil for anonymous ) is allowed on exactly the routes,
+// each given as "METHOD /pattern" ( e.g. "GET /order/:id" ), and denied on every other route of the server.
+// So a newly registered route left unprotected fails the test until it is listed,
+// and a route without the middleware attached always fails the test.
+func AssertAllowed(t testing.TB, svr *easyweb.HttpServer, b *authz.MiddlewareBuilder, p *auth.Principal, routes ...string) bool {
+	t.Helper()
+
+	ok := true
+	registered := make([]string, 0, len(routes))
+	for _, d := range b.Decisions(svr, p) {
+		route := d.Method + " " + d.Route
+		registered = append(registered, route)
+
+		if !d.Attached {
+			t.Errorf("%s: the authz middleware is not attached", route)
+			ok = false
+			continue
+		}
+
+		want := slices.Contains(routes, route)
+		if got := d.StatusCode == http.StatusOK; got != want {
+			t.Errorf("%s: want allowed %t, got status %d for %s", route, want, d.StatusCode, principalName(p))
+			ok = false
+		}
+	}
+
+	for _, route := range routes {
+		if !slices.Contains(registered, route) {
+			t.Errorf("%s: route is not registered", route)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertStatus asserts the decision status of the principal ( nil for anonymous ) on each route,
+// the key is "METHOD /pattern" and the value is 200, 401 or 403.
+// The routes without the middleware attached fail the test.
+func AssertStatus(t testing.TB, svr *easyweb.HttpServer, b *authz.MiddlewareBuilder, p *auth.Principal, want map[string]int) bool {
+	t.Helper()
+
+	got := make(map[string]authz.Decision, len(want))
+	for _, d := range b.Decisions(svr, p) {
+		got[d.Method+" "+d.Route] = d
+	}
+
+	ok := true
+	for route, code := range want {
+		d, registered := got[route]
+		switch {
+		case !registered:
+			t.Errorf("%s: route is not registered", route)
+			ok = false
+		case !d.Attached:
+			t.Errorf("%s: the authz middleware is not attached", route)
+			ok = false
+		case d.StatusCode != code:
+			t.Errorf("%s: want status %d, got %d for %s", route, code, d.StatusCode, principalName(p))
+			ok = false
+		}
+	}
+	return ok
+}
+
+func principalName(p *auth.Principal) string {
+	if p == nil {
+		return "anonymous"
+	}
+	return "principal " + p.ID
+}
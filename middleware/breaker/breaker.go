@@ -0,0 +1,110 @@
+package breaker
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MiddlewareBuilder guards every route by its own circuit breaker,
+// the requests to a route whose breaker is open are answered at once with 503 and Retry-After.
+// The requests matching no route are not guarded.
+type MiddlewareBuilder struct {
+	opts          []BreakerOpt
+	failureFunc   func(ctx *easyweb.Context) bool
+	onStateChange func(key string, from State, to State)
+	statusCode    int
+	errMsg        string
+
+	breakers sync.Map
+}
+
+// WithFailureFunc reports whether the request failed.
+// defaults to the 5xx responses.
+func (b *MiddlewareBuilder) WithFailureFunc(failureFunc func(ctx *easyweb.Context) bool) *MiddlewareBuilder {
+	b.failureFunc = failureFunc
+	return b
+}
+
+// WithOnStateChange is called on every state change of the breakers,
+// the key is the method and the route ( e.g. GET /order/:id ).
+func (b *MiddlewareBuilder) WithOnStateChange(fn func(key string, from State, to State)) *MiddlewareBuilder {
+	b.onStateChange = fn
+	return b
+}
+
+// WithStatusCode the code returns to the front end when the breaker is open.
+// defaults to 503.
+func (b *MiddlewareBuilder) WithStatusCode(statusCode int) *MiddlewareBuilder {
+	b.statusCode = statusCode
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when the breaker is open.
+// defaults to "Service Unavailable"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			if ctx.MatchedRoute == "" {
+				next(ctx)
+				return
+			}
+
+			br := b.Breaker(ctx.Req.Method + " " + ctx.MatchedRoute)
+			done, err := br.Allow()
+			if err != nil {
+				retryAfter := int64(math.Ceil(br.RetryAfter().Seconds()))
+				ctx.Resp.Header().Set("Retry-After", strconv.FormatInt(max(retryAfter, 1), 10))
+				ctx.StatusCode = b.statusCode
+				ctx.Data = []byte(b.errMsg)
+				return
+			}
+
+			success := false
+			// a panic is a failure and must not leave a probe pending
+			defer func() {
+				done(success)
+			}()
+
+			next(ctx)
+			success = !b.failureFunc(ctx)
+		}
+	}
+}
+
+// Breaker returns the breaker of the key, the key is the method and the route ( e.g. GET /order/:id ).
+func (b *MiddlewareBuilder) Breaker(key string) *Breaker {
+	if br, ok := b.breakers.Load(key); ok {
+		return br.(*Breaker)
+	}
+
+	opts := b.opts
+	if b.onStateChange != nil {
+		opts = append(opts[:len(opts):len(opts)], BreakerWithOnStateChange(func(from State, to State) {
+			b.onStateChange(key, from, to)
+		}))
+	}
+
+	br, _ := b.breakers.LoadOrStore(key, NewBreaker(opts...))
+	return br.(*Breaker)
+}
+
+// NewMiddlewareBuilder creates the breakers by the options.
+func NewMiddlewareBuilder(opts ...BreakerOpt) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		opts: opts,
+		failureFunc: func(ctx *easyweb.Context) bool {
+			return ctx.StatusCode >= http.StatusInternalServerError
+		},
+		statusCode: http.StatusServiceUnavailable,
+		errMsg:     "Service Unavailable",
+	}
+}
@@ -0,0 +1,153 @@
+package breaker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+
+	var changes []string
+	b := NewBreaker(
+		BreakerWithMinRequests(4),
+		BreakerWithFailureRatio(0.5),
+		BreakerWithOpenTimeout(5*time.Second),
+		BreakerWithProbes(2),
+		BreakerWithOnStateChange(func(from State, to State) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}),
+	)
+	b.now = clock.Now
+
+	call := func(success bool) error {
+		done, err := b.Allow()
+		if err != nil {
+			return err
+		}
+		done(success)
+		return nil
+	}
+
+	// not enough requests to trip
+	require.NoError(t, call(false))
+	require.NoError(t, call(false))
+	require.NoError(t, call(true))
+	assert.Equal(t, StateClosed, b.State())
+
+	// the failures out of the window are forgotten
+	clock.now = clock.now.Add(11 * time.Second)
+	require.NoError(t, call(true))
+	require.NoError(t, call(true))
+	require.NoError(t, call(false))
+	assert.Equal(t, StateClosed, b.State())
+
+	// 2 failures of 4 requests
+	require.NoError(t, call(false))
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, call(true), ErrOpen)
+	assert.Equal(t, 5*time.Second, b.RetryAfter())
+
+	// a failed probe opens the breaker again
+	clock.now = clock.now.Add(5 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	require.NoError(t, call(false))
+	assert.Equal(t, StateOpen, b.State())
+
+	// the probes are limited, all of them must succeed
+	clock.now = clock.now.Add(5 * time.Second)
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	done1(true)
+	done1(false)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done2(true)
+	assert.Equal(t, StateClosed, b.State())
+	assert.Zero(t, b.RetryAfter())
+
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}, changes)
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	var changes []string
+	mb := NewMiddlewareBuilder(BreakerWithMinRequests(2), BreakerWithOpenTimeout(1500*time.Millisecond)).
+		WithOnStateChange(func(key string, from State, to State) {
+			changes = append(changes, key+": "+to.String())
+		})
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(mb.Build())
+
+	status := http.StatusBadGateway
+	svr.Get("/order/:id", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(status, nil)
+	})
+	svr.Get("/panic", func(ctx *easyweb.Context) {
+		panic("boom")
+	})
+	svr.Get("/ok", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+
+	// the breaker is keyed by the route, not the path
+	assert.Equal(t, http.StatusBadGateway, serve("/order/1").Code)
+	assert.Equal(t, http.StatusBadGateway, serve("/order/2").Code)
+
+	recorder := serve("/order/3")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, "Service Unavailable", recorder.Body.String())
+
+	// the other routes are not affected
+	assert.Equal(t, http.StatusOK, serve("/ok").Code)
+
+	// the panics are failures
+	assert.Panics(t, func() { serve("/panic") })
+	assert.Panics(t, func() { serve("/panic") })
+	assert.Equal(t, StateOpen, mb.Breaker("GET /panic").State())
+
+	// recovered
+	br := mb.Breaker("GET /order/:id")
+	br.now = func() time.Time { return time.Now().Add(2 * time.Second) }
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, serve("/order/4").Code)
+	assert.Equal(t, StateClosed, br.State())
+
+	assert.Equal(t, []string{
+		"GET /order/:id: open",
+		"GET /panic: open",
+		"GET /order/:id: half-open",
+		"GET /order/:id: closed",
+	}, changes)
+}
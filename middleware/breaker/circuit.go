@@ -0,0 +1,250 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Breaker.Allow when the breaker rejects the request.
+var ErrOpen = errors.New("[breaker] circuit breaker is open")
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed lets the requests through and counts the failures.
+	StateClosed State = iota
+	// StateOpen rejects the requests until the open timeout elapses.
+	StateOpen
+	// StateHalfOpen lets a few probe requests through to decide whether to close or open again.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a circuit breaker tripping on the failure ratio of a rolling window.
+type Breaker struct {
+	mu    sync.Mutex
+	state State
+
+	window       time.Duration
+	buckets      []bucket
+	minRequests  int
+	failureRatio float64
+	openTimeout  time.Duration
+	probes       int
+
+	openedAt  time.Time
+	probing   int
+	succeeded int
+
+	onStateChange func(from State, to State)
+	now           func() time.Time
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+type BreakerOpt func(*Breaker)
+
+// BreakerWithWindow the rolling window to count the failures in, it is divided into 10 buckets.
+// defaults to 10s.
+func BreakerWithWindow(window time.Duration) BreakerOpt {
+	return func(b *Breaker) {
+		b.window = window
+	}
+}
+
+// BreakerWithMinRequests the number of the requests in the window before the breaker is able to trip.
+// defaults to 20.
+func BreakerWithMinRequests(minRequests int) BreakerOpt {
+	return func(b *Breaker) {
+		b.minRequests = minRequests
+	}
+}
+
+// BreakerWithFailureRatio the ratio of the failed requests in the window to trip the breaker.
+// defaults to 0.5.
+func BreakerWithFailureRatio(ratio float64) BreakerOpt {
+	return func(b *Breaker) {
+		b.failureRatio = ratio
+	}
+}
+
+// BreakerWithOpenTimeout how long the breaker stays open before probing.
+// defaults to 30s.
+func BreakerWithOpenTimeout(timeout time.Duration) BreakerOpt {
+	return func(b *Breaker) {
+		b.openTimeout = timeout
+	}
+}
+
+// BreakerWithProbes the number of the probe requests in the half-open state,
+// the breaker closes if all of them succeed.
+// defaults to 1.
+func BreakerWithProbes(probes int) BreakerOpt {
+	return func(b *Breaker) {
+		b.probes = probes
+	}
+}
+
+// BreakerWithOnStateChange is called on every state change, e.g. to log or count the trips.
+// It is called with the breaker locked and must not call the breaker.
+func BreakerWithOnStateChange(fn func(from State, to State)) BreakerOpt {
+	return func(b *Breaker) {
+		b.onStateChange = fn
+	}
+}
+
+func NewBreaker(opts ...BreakerOpt) *Breaker {
+	b := &Breaker{
+		window:       10 * time.Second,
+		buckets:      make([]bucket, 10),
+		minRequests:  20,
+		failureRatio: 0.5,
+		openTimeout:  30 * time.Second,
+		probes:       1,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Allow reports whether the request is allowed, ErrOpen if not.
+// The done func must be called once with the outcome of the allowed request.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == StateOpen {
+		if now.Sub(b.openedAt) < b.openTimeout {
+			return nil, ErrOpen
+		}
+		b.setState(StateHalfOpen, now)
+	}
+
+	halfOpen := b.state == StateHalfOpen
+	if halfOpen {
+		if b.probing >= b.probes {
+			return nil, ErrOpen
+		}
+		b.probing++
+	}
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { b.done(halfOpen, success) })
+	}, nil
+}
+
+func (b *Breaker) done(probe bool, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch {
+	case probe && b.state == StateHalfOpen:
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+
+		b.succeeded++
+		if b.succeeded >= b.probes {
+			b.setState(StateClosed, now)
+		}
+	case b.state == StateClosed:
+		bkt := b.bucket(now)
+		bkt.total++
+		if !success {
+			bkt.failures++
+		}
+
+		total, failures := b.counts(now)
+		if total >= b.minRequests && float64(failures) >= b.failureRatio*float64(total) {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+// State returns the current state, an open breaker past the open timeout is reported as half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// RetryAfter returns how long until the open breaker probes again, zero if not open.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(b.openTimeout-b.now().Sub(b.openedAt), 0)
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+
+	b.probing, b.succeeded = 0, 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		// start counting from scratch
+		clear(b.buckets)
+	}
+
+	if b.onStateChange != nil && from != state {
+		b.onStateChange(from, state)
+	}
+}
+
+// bucket returns the bucket of the time, it is reset if it belongs to a previous round of the window.
+func (b *Breaker) bucket(now time.Time) *bucket {
+	size := b.window / time.Duration(len(b.buckets))
+	start := now.Truncate(size)
+
+	bkt := &b.buckets[int(start.UnixNano()/int64(size))%len(b.buckets)]
+	if !bkt.start.Equal(start) {
+		*bkt = bucket{start: start}
+	}
+	return bkt
+}
+
+// counts sums up the buckets within the window.
+func (b *Breaker) counts(now time.Time) (total int, failures int) {
+	for _, bkt := range b.buckets {
+		if now.Sub(bkt.start) < b.window {
+			total += bkt.total
+			failures += bkt.failures
+		}
+	}
+	return total, failures
+}
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/internal/respwriter"
+)
+
+// MetaKey is the route metadata key to cache a group's routes,
+// the value must be a time.Duration as the TTL.
+const MetaKey = "cache"
+
+// MiddlewareBuilder caches the successful GET responses buffered in Context.Data on the server side.
+//
+// A response is cached by the host, the route, the path ( so the path params ), the query and the request headers of WithVary.
+// Only the routes with a TTL ( see WithTTL, WithRouteTTL and MetaKey ) are cached,
+// the responses with Set-Cookie, Cache-Control: private / no-store or written to Context.Resp directly are never cached.
+// The requests with Authorization or Cookie neither store nor get a cached response unless it is Cache-Control: public.
+// X-Cache tells whether the response is a HIT or a MISS.
+//
+// Place it inside the etag and compress middlewares, so that the cached responses are tagged and compressed on the way out.
+type MiddlewareBuilder struct {
+	store     Store
+	prefix    string
+	ttl       time.Duration
+	routeTTLs map[string]time.Duration
+	vary      []string
+	logFunc   func(ctx *easyweb.Context, err error)
+}
+
+type entry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// WithPrefix the prefix of the keys in the store.
+// defaults to "cache".
+func (b *MiddlewareBuilder) WithPrefix(prefix string) *MiddlewareBuilder {
+	b.prefix = prefix
+	return b
+}
+
+// WithTTL caches all the routes for the ttl.
+// defaults to 0, only the routes configured are cached.
+func (b *MiddlewareBuilder) WithTTL(ttl time.Duration) *MiddlewareBuilder {
+	b.ttl = ttl
+	return b
+}
+
+// WithRouteTTL caches the route for the ttl, the route is the registered pattern ( e.g. /order/:id ).
+// A non-positive ttl disables the cache of the route.
+func (b *MiddlewareBuilder) WithRouteTTL(route string, ttl time.Duration) *MiddlewareBuilder {
+	b.routeTTLs[route] = ttl
+	return b
+}
+
+// WithVary caches a response per value of the request headers, e.g. Accept-Language.
+func (b *MiddlewareBuilder) WithVary(headers ...string) *MiddlewareBuilder {
+	b.vary = make([]string, 0, len(headers))
+	for _, h := range headers {
+		b.vary = append(b.vary, textproto.CanonicalMIMEHeaderKey(h))
+	}
+	return b
+}
+
+// WithLogFunc is called when the store fails, the request is served without the cache in this case.
+func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context, err error)) *MiddlewareBuilder {
+	b.logFunc = logFunc
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			ttl := b.getTTL(ctx)
+			if ttl <= 0 || ctx.Req.Method != http.MethodGet || ctx.MatchedRoute == "" {
+				next(ctx)
+				return
+			}
+
+			key := b.key(ctx)
+			if b.serveCached(ctx, key) {
+				return
+			}
+
+			header := ctx.Resp.Header()
+			before := header.Clone()
+
+			resp := ctx.Resp
+			cw := &respwriter.Counting{ResponseWriter: resp}
+			ctx.Resp = cw
+
+			header.Set("X-Cache", "MISS")
+			next(ctx)
+			ctx.Resp = resp
+
+			status := ctx.StatusCode
+			if status == 0 && len(ctx.Data) > 0 {
+				status = http.StatusOK
+			}
+			if cw.Direct() || !cacheable(ctx.Req, status, header) {
+				return
+			}
+
+			bs, err := json.Marshal(entry{
+				Status: status,
+				Header: respwriter.ChangedHeader(before, header, "X-Cache"),
+				Body:   ctx.Data,
+			})
+			if err == nil {
+				err = b.store.Set(ctx.Req.Context(), key, bs, ttl)
+			}
+			if err != nil {
+				b.logFunc(ctx, err)
+			}
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) serveCached(ctx *easyweb.Context, key string) bool {
+	bs, err := b.store.Get(ctx.Req.Context(), key)
+	if err != nil {
+		b.logFunc(ctx, err)
+		return false
+	}
+	if bs == nil {
+		return false
+	}
+
+	var e entry
+	if err = json.Unmarshal(bs, &e); err != nil {
+		b.logFunc(ctx, err)
+		return false
+	}
+
+	// the response may be personalized for another principal
+	if credentialed(ctx.Req) && !slices.Contains(cacheControl(e.Header), "public") {
+		return false
+	}
+
+	header := ctx.Resp.Header()
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	header.Set("X-Cache", "HIT")
+
+	ctx.StatusCode = e.Status
+	ctx.Data = e.Body
+	return true
+}
+
+func (b *MiddlewareBuilder) getTTL(ctx *easyweb.Context) time.Duration {
+	if ttl, ok := b.routeTTLs[ctx.MatchedRoute]; ok {
+		return ttl
+	}
+
+	if val, ok := ctx.RouteMeta(MetaKey); ok {
+		if ttl, ok := val.(time.Duration); ok {
+			return ttl
+		}
+	}
+
+	return b.ttl
+}
+
+// key is {prefix}:{route}|{hash of the path}|{hash of the host, the query and the vary headers},
+// so that the responses are able to be invalidated by the route or the path.
+func (b *MiddlewareBuilder) key(ctx *easyweb.Context) string {
+	// the order of the query params does not matter
+	query := ctx.Req.URL.Query().Encode()
+
+	h := sha256.New()
+	h.Write([]byte(ctx.Host()))
+	h.Write([]byte{0})
+	h.Write([]byte(query))
+	for _, name := range b.vary {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(ctx.Req.Header.Values(name), ",")))
+	}
+
+	return b.pathPrefix(ctx.MatchedRoute, ctx.Req.URL.Path) + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func (b *MiddlewareBuilder) routePrefix(route string) string {
+	return b.prefix + ":" + route + "|"
+}
+
+func (b *MiddlewareBuilder) pathPrefix(route string, path string) string {
+	sum := sha256.Sum256([]byte(strings.TrimRight(path, "/")))
+	return b.routePrefix(route) + hex.EncodeToString(sum[:16]) + "|"
+}
+
+// InvalidateRoute deletes the cached responses of the route, e.g. /order/:id.
+func (b *MiddlewareBuilder) InvalidateRoute(ctx context.Context, route string) error {
+	return b.store.DeletePrefix(ctx, b.routePrefix(route))
+}
+
+// InvalidatePath deletes the cached responses of the path of the route, e.g. /order/1 of /order/:id,
+// whatever the query and the vary headers are.
+func (b *MiddlewareBuilder) InvalidatePath(ctx context.Context, route string, path string) error {
+	return b.store.DeletePrefix(ctx, b.pathPrefix(route, path))
+}
+
+// InvalidateAll deletes all the cached responses.
+func (b *MiddlewareBuilder) InvalidateAll(ctx context.Context) error {
+	return b.store.DeletePrefix(ctx, b.prefix+":")
+}
+
+func NewMiddlewareBuilder(store Store) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		store:     store,
+		prefix:    "cache",
+		routeTTLs: make(map[string]time.Duration),
+		logFunc: func(ctx *easyweb.Context, err error) {
+			log.Printf("response cache failed in path %s: %v", ctx.Req.URL.Path, err)
+		},
+	}
+}
+
+func cacheable(req *http.Request, status int, header http.Header) bool {
+	if status != http.StatusOK || header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	directives := cacheControl(header)
+	if slices.Contains(directives, "private") || slices.Contains(directives, "no-store") {
+		return false
+	}
+	return !credentialed(req) || slices.Contains(directives, "public")
+}
+
+// credentialed reports whether the request carries the credentials of a principal.
+func credentialed(req *http.Request) bool {
+	return req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+}
+
+// cacheControl returns the lower-cased directives of Cache-Control without the arguments.
+func cacheControl(header http.Header) []string {
+	var directives []string
+	for directive := range strings.SplitSeq(header.Get("Cache-Control"), ",") {
+		name, _, _ := strings.Cut(directive, "=")
+		directives = append(directives, strings.ToLower(strings.TrimSpace(name)))
+	}
+	return directives
+}
@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	memStore, err := NewMemStore(16)
+	require.NoError(t, err)
+
+	mr := miniredis.RunT(t)
+	rStore := NewRStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	stores := map[string]Store{
+		"memory": memStore,
+		"redis":  rStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testMiddlewareBuilder(t, store)
+		})
+	}
+}
+
+func testMiddlewareBuilder(t *testing.T, store Store) {
+	mb := NewMiddlewareBuilder(store).
+		WithRouteTTL("/order/:id", time.Minute).
+		WithRouteTTL("/private", time.Minute).
+		WithRouteTTL("/direct", time.Minute).
+		WithVary("accept-language")
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			ctx.Resp.Header().Set("X-Request-ID", ctx.Req.URL.RawQuery)
+			next(ctx)
+		}
+	})
+	svr.Use(mb.Build())
+
+	calls := make(map[string]int)
+	handle := func(ctx *easyweb.Context) {
+		calls[ctx.MatchedRoute]++
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		data := ctx.Req.URL.Path + "?" + ctx.Req.URL.RawQuery + " " + ctx.Req.Header.Get("Accept-Language")
+		_ = ctx.RespBytes(http.StatusOK, []byte(data+" #"+strconv.Itoa(calls[ctx.MatchedRoute])))
+	}
+
+	svr.Get("/order/:id", handle)
+	svr.Get("/uncached", handle)
+	svr.Get("/private", func(ctx *easyweb.Context) {
+		ctx.CacheFor(time.Minute, false)
+		handle(ctx)
+	})
+	svr.Get("/direct", func(ctx *easyweb.Context) {
+		calls[ctx.MatchedRoute]++
+		_, _ = ctx.Resp.Write([]byte("direct"))
+	})
+	svr.Group("/group").WithMeta(MetaKey, time.Minute).Get("/x", handle)
+
+	serve := func(target string, lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Language", lang)
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("/order/1?a=1&b=2", "en")
+	assert.Equal(t, "MISS", recorder.Header().Get("X-Cache"))
+	assert.Equal(t, "/order/1?a=1&b=2 en #1", recorder.Body.String())
+
+	// the order of the query params does not matter, the headers of the outer middlewares are not cached
+	recorder = serve("/order/1?b=2&a=1", "en")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "HIT", recorder.Header().Get("X-Cache"))
+	assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "b=2&a=1", recorder.Header().Get("X-Request-ID"))
+	assert.Equal(t, "/order/1?a=1&b=2 en #1", recorder.Body.String())
+
+	// varied by the path, the query and the headers
+	assert.Equal(t, "/order/2?a=1&b=2 en #2", serve("/order/2?a=1&b=2", "en").Body.String())
+	assert.Equal(t, "/order/1?a=2 en #3", serve("/order/1?a=2", "en").Body.String())
+	assert.Equal(t, "/order/1?a=1&b=2 zh #4", serve("/order/1?a=1&b=2", "zh").Body.String())
+
+	// invalidate the path
+	require.NoError(t, mb.InvalidatePath(context.Background(), "/order/:id", "/order/1"))
+	assert.Equal(t, "MISS", serve("/order/1?a=1&b=2", "en").Header().Get("X-Cache"))
+	assert.Equal(t, "/order/2?a=1&b=2 en #2", serve("/order/2?a=1&b=2", "en").Body.String())
+
+	// invalidate the route
+	require.NoError(t, mb.InvalidateRoute(context.Background(), "/order/:id"))
+	assert.Equal(t, "/order/2?a=1&b=2 en #6", serve("/order/2?a=1&b=2", "en").Body.String())
+
+	// the route meta
+	assert.Equal(t, "MISS", serve("/group/x", "en").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve("/group/x", "en").Header().Get("X-Cache"))
+
+	// invalidate all
+	require.NoError(t, mb.InvalidateAll(context.Background()))
+	assert.Equal(t, "MISS", serve("/group/x", "en").Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", serve("/order/2?a=1&b=2", "en").Header().Get("X-Cache"))
+
+	// not cached
+	for _, path := range []string{"/uncached", "/private", "/direct"} {
+		serve(path, "en")
+		serve(path, "en")
+		assert.Equal(t, 2, calls[path], path)
+	}
+}
+
+func TestMiddlewareBuilder_Build_credentials(t *testing.T) {
+	store, err := NewMemStore(16)
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(store).WithTTL(time.Minute).Build())
+	svr.Get("/me", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte(ctx.Req.Header.Get("Authorization")+"@"+ctx.Host()))
+	})
+	svr.Get("/catalog", func(ctx *easyweb.Context) {
+		ctx.CacheFor(time.Minute, true)
+		_ = ctx.RespBytes(http.StatusOK, []byte("catalog for "+ctx.Req.Header.Get("Authorization")))
+	})
+
+	serve := func(target string, header string, val string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if header != "" {
+			req.Header.Set(header, val)
+		}
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// two principals on the same path never share the response
+	assert.Equal(t, "Bearer alice@example.com", serve("/me", "Authorization", "Bearer alice").Body.String())
+	assert.Equal(t, "Bearer bob@example.com", serve("/me", "Authorization", "Bearer bob").Body.String())
+	assert.Equal(t, "MISS", serve("/me", "Authorization", "Bearer bob").Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", serve("/me", "Cookie", "session=bob").Header().Get("X-Cache"))
+
+	// the anonymous response is not served to a principal
+	assert.Equal(t, "MISS", serve("/me", "", "").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve("/me", "", "").Header().Get("X-Cache"))
+	assert.Equal(t, "Bearer bob@example.com", serve("/me", "Authorization", "Bearer bob").Body.String())
+
+	// varied by the host
+	assert.Equal(t, "@other.example.com", serve("http://other.example.com/me", "", "").Body.String())
+
+	// the public response is shared
+	assert.Equal(t, "catalog for Bearer alice", serve("/catalog", "Authorization", "Bearer alice").Body.String())
+	recorder := serve("/catalog", "Authorization", "Bearer bob")
+	assert.Equal(t, "HIT", recorder.Header().Get("X-Cache"))
+	assert.Equal(t, "catalog for Bearer alice", recorder.Body.String())
+}
+
+func TestMiddlewareBuilder_Build_storeFailure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+
+	var errs []error
+	mb := NewMiddlewareBuilder(NewRStore(client)).
+		WithTTL(time.Minute).
+		WithLogFunc(func(ctx *easyweb.Context, err error) {
+			errs = append(errs, err)
+		})
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(mb.Build())
+	svr.Get("/", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("ok"))
+	})
+
+	mr.Close()
+
+	// fail open
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+	assert.Len(t, errs, 2)
+}
+
+func TestMemStore(t *testing.T) {
+	s, err := NewMemStore(2)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, s.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, s.Set(ctx, "b", []byte("2"), -time.Second))
+
+	val, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	// expired
+	val, err = s.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Nil(t, val)
+
+	// evicted
+	require.NoError(t, s.Set(ctx, "c", []byte("3"), time.Minute))
+	require.NoError(t, s.Set(ctx, "d", []byte("4"), time.Minute))
+	val, err = s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, val)
+}
+
+func TestRStore_DeletePrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	ctx := context.Background()
+	for i := 0; i < 250; i++ {
+		require.NoError(t, s.Set(ctx, "cache:/a*|"+strconv.Itoa(i), []byte("1"), time.Minute))
+	}
+	require.NoError(t, s.Set(ctx, "cache:/ab|1", []byte("1"), time.Minute))
+
+	// the glob characters of the prefix are literal
+	require.NoError(t, s.DeletePrefix(ctx, "cache:/a*"))
+	assert.Equal(t, []string{"cache:/ab|1"}, mr.Keys())
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	_ Store = (*MemStore)(nil)
+	_ Store = (*RStore)(nil)
+)
+
+// Store stores the cached responses.
+type Store interface {
+	// Get returns the value of the key, nil if absent or expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
+	// DeletePrefix deletes the keys starting with the prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// MemStore stores the responses in memory, the least recently used ones are evicted beyond the size.
+type MemStore struct {
+	c *lru.Cache
+}
+
+type memItem struct {
+	val      []byte
+	expireAt time.Time
+}
+
+func (s *MemStore) Get(_ context.Context, key string) ([]byte, error) {
+	val, ok := s.c.Get(key)
+	if !ok {
+		return nil, nil
+	}
+
+	item := val.(*memItem)
+	if time.Now().After(item.expireAt) {
+		s.c.Remove(key)
+		return nil, nil
+	}
+	return item.val, nil
+}
+
+func (s *MemStore) Set(_ context.Context, key string, val []byte, ttl time.Duration) error {
+	s.c.Add(key, &memItem{val: val, expireAt: time.Now().Add(ttl)})
+	return nil
+}
+
+func (s *MemStore) DeletePrefix(_ context.Context, prefix string) error {
+	for _, key := range s.c.Keys() {
+		if k, ok := key.(string); ok && strings.HasPrefix(k, prefix) {
+			s.c.Remove(k)
+		}
+	}
+	return nil
+}
+
+// NewMemStore holds up to size responses.
+func NewMemStore(size int) (*MemStore, error) {
+	c, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &MemStore{c: c}, nil
+}
+
+// RStore stores the responses in redis, so that they are shared by the instances of the service.
+type RStore struct {
+	client redis.Cmdable
+}
+
+func (s *RStore) Get(ctx context.Context, key string) ([]byte, error) {
+	val, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (s *RStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, val, ttl).Err()
+}
+
+// DeletePrefix scans the keys by the prefix, which is fine for the occasional invalidations.
+func (s *RStore) DeletePrefix(ctx context.Context, prefix string) error {
+	iter := s.client.Scan(ctx, 0, escapeGlob(prefix)+"*", 100).Iterator()
+
+	keys := make([]string, 0, 100)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			if err := s.client.Unlink(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		return s.client.Unlink(ctx, keys...).Err()
+	}
+	return nil
+}
+
+func NewRStore(client redis.Cmdable) *RStore {
+	return &RStore{client: client}
+}
+
+// escapeGlob escapes the glob characters of the redis patterns.
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,210 @@
+package compress
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MiddlewareBuilder compresses the responses by the encoding the client accepts.
+// Both the response buffered in Context.Data and the response written to Context.Resp directly
+// ( e.g. the file handlers ) are compressed.
+type MiddlewareBuilder struct {
+	encodings    []string
+	minSize      int
+	contentTypes []string
+}
+
+// WithEncodings the supported encodings in the order of preference,
+// used when the client accepts several encodings equally.
+// defaults to zstd, br, gzip, deflate.
+func (b *MiddlewareBuilder) WithEncodings(encodings ...string) *MiddlewareBuilder {
+	b.encodings = encodings
+	return b
+}
+
+// WithMinSize responses smaller than minSize bytes are not compressed.
+// defaults to 1024.
+func (b *MiddlewareBuilder) WithMinSize(minSize int) *MiddlewareBuilder {
+	b.minSize = minSize
+	return b
+}
+
+// WithContentTypes the compressible content types, a type ending with '/' matches all its subtypes ( e.g. text/ ).
+// defaults to text/, JSON, javascript, XML and SVG.
+func (b *MiddlewareBuilder) WithContentTypes(contentTypes ...string) *MiddlewareBuilder {
+	b.contentTypes = contentTypes
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			ctx.Resp.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiate(ctx.Req.Header.Get("Accept-Encoding"), b.encodings)
+			if encoding == "" || ctx.Req.Method == http.MethodHead {
+				next(ctx)
+				return
+			}
+
+			resp := ctx.Resp
+			cw := &compressWriter{
+				ResponseWriter: resp,
+				encoding:       encoding,
+				shouldCompress: b.shouldCompress,
+			}
+
+			ctx.Resp = cw
+			defer func() {
+				ctx.Resp = resp
+			}()
+
+			next(ctx)
+
+			if cw.enc != nil {
+				// the handler has started a compressed stream, the buffered data must follow it
+				if len(ctx.Data) > 0 {
+					_, _ = cw.Write(ctx.Data)
+					ctx.Data = nil
+				}
+				_ = cw.Close()
+				return
+			}
+
+			// nothing is written directly, forward the status code held back by the writer
+			if cw.code != 0 && !cw.wroteHeader {
+				ctx.StatusCode = cw.code
+			}
+
+			b.compressData(ctx, resp.Header(), encoding)
+		}
+	}
+}
+
+// compressData compresses the response buffered in Context.Data.
+func (b *MiddlewareBuilder) compressData(ctx *easyweb.Context, header http.Header, encoding string) {
+	if !bodyAllowed(ctx.StatusCode) || header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	contentType := header.Get("Content-Type")
+	detected := contentType == ""
+	if detected {
+		contentType = http.DetectContentType(ctx.Data)
+	}
+
+	if !b.shouldCompress(header, contentType, len(ctx.Data)) {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	enc := getEncoder(encoding, buf)
+	_, err := enc.Write(ctx.Data)
+	// the encoder goes back to the pool even if the write fails
+	if closeErr := putEncoder(encoding, enc); err == nil {
+		err = closeErr
+	}
+	if err != nil || buf.Len() >= len(ctx.Data) {
+		return
+	}
+
+	// net/http no longer sniffs the content type once Content-Encoding is set
+	if detected {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Encoding", encoding)
+	header.Del("Content-Length")
+	weakenETag(header)
+	ctx.Data = buf.Bytes()
+}
+
+// weakenETag turns the strong ETag into a weak one,
+// the compressed response is no longer byte-for-byte identical to the tagged one.
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// shouldCompress reports whether a response of the content type and size is worth compressing,
+// a negative size means unknown.
+func (b *MiddlewareBuilder) shouldCompress(header http.Header, contentType string, size int) bool {
+	if header.Get("Content-Encoding") != "" || (size >= 0 && size < b.minSize) {
+		return false
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, ct := range b.contentTypes {
+		if mediaType == ct || (strings.HasSuffix(ct, "/") && strings.HasPrefix(mediaType, ct)) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		encodings: []string{EncodingZstd, EncodingBrotli, EncodingGzip, EncodingDeflate},
+		minSize:   1024,
+		contentTypes: []string{
+			"text/",
+			"application/json",
+			"application/problem+json",
+			"application/javascript",
+			"application/xml",
+			"application/xhtml+xml",
+			"image/svg+xml",
+		},
+	}
+}
+
+// negotiate returns the supported encoding with the highest quality in the Accept-Encoding header,
+// the order of the supported encodings breaks the ties.
+func negotiate(acceptEncoding string, encodings []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if key, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		if _, ok := encoderPools[encoding]; !ok {
+			continue
+		}
+
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func bodyAllowed(code int) bool {
+	return !(code >= 100 && code < 200) && code != http.StatusNoContent &&
+		code != http.StatusNotModified && code != http.StatusPartialContent
+}
@@ -0,0 +1,254 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var payload = strings.Repeat(`{"name":"easy-web","desc":"compress me"}`, 64)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().Build())
+
+	svr.Get("/json", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Content-Type", "application/json")
+		_ = ctx.RespBytes(http.StatusOK, []byte(payload))
+	})
+	svr.Get("/tagged", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("ETag", `"v1"`)
+		_ = ctx.RespBytes(http.StatusOK, []byte(payload))
+	})
+	svr.Get("/small", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("small"))
+	})
+	svr.Get("/encoded", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Content-Encoding", "gzip")
+		_ = ctx.RespBytes(http.StatusOK, []byte(payload))
+	})
+	svr.Get("/image", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Content-Type", "image/png")
+		_ = ctx.RespBytes(http.StatusOK, []byte(payload))
+	})
+	svr.Get("/direct", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Content-Length", "2560")
+		ctx.Resp.WriteHeader(http.StatusCreated)
+		_, _ = ctx.Resp.Write([]byte(payload[:1280]))
+		_, _ = ctx.Resp.Write([]byte(payload[1280:2560]))
+	})
+	svr.Get("/stream", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			_, _ = ctx.Resp.Write([]byte("data: event\n\n"))
+			ctx.Resp.(http.Flusher).Flush()
+		}
+	})
+
+	tcs := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantCode       int
+		wantEncoding   string
+		wantBody       string
+		wantETag       string
+	}{
+		{
+			name:           "gzip",
+			path:           "/json",
+			acceptEncoding: "gzip",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "gzip",
+			wantBody:       payload,
+		}, {
+			name:           "deflate",
+			path:           "/json",
+			acceptEncoding: "deflate",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "deflate",
+			wantBody:       payload,
+		}, {
+			name:           "brotli",
+			path:           "/json",
+			acceptEncoding: "gzip;q=0.5, br",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "br",
+			wantBody:       payload,
+		}, {
+			name:           "zstd preferred",
+			path:           "/json",
+			acceptEncoding: "gzip, deflate, br, zstd",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "zstd",
+			wantBody:       payload,
+		}, {
+			name:           "weakened etag",
+			path:           "/tagged",
+			acceptEncoding: "gzip",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "gzip",
+			wantBody:       payload,
+			wantETag:       `W/"v1"`,
+		}, {
+			name:           "not acceptable",
+			path:           "/json",
+			acceptEncoding: "identity, gzip;q=0",
+			wantCode:       http.StatusOK,
+			wantBody:       payload,
+		}, {
+			name:           "too small",
+			path:           "/small",
+			acceptEncoding: "gzip",
+			wantCode:       http.StatusOK,
+			wantBody:       "small",
+		}, {
+			name:           "already encoded",
+			path:           "/encoded",
+			acceptEncoding: "br",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "gzip",
+			wantBody:       payload,
+		}, {
+			name:           "not compressible",
+			path:           "/image",
+			acceptEncoding: "gzip",
+			wantCode:       http.StatusOK,
+			wantBody:       payload,
+		}, {
+			name:           "direct write",
+			path:           "/direct",
+			acceptEncoding: "gzip",
+			wantCode:       http.StatusCreated,
+			wantEncoding:   "gzip",
+			wantBody:       payload[:2560],
+		}, {
+			name:           "stream",
+			path:           "/stream",
+			acceptEncoding: "*",
+			wantCode:       http.StatusOK,
+			wantEncoding:   "zstd",
+			wantBody:       strings.Repeat("data: event\n\n", 3),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"))
+			assert.Equal(t, tc.wantEncoding, recorder.Header().Get("Content-Encoding"))
+			assert.Equal(t, tc.wantETag, recorder.Header().Get("ETag"))
+
+			body := recorder.Body.Bytes()
+			if tc.wantEncoding != "" && tc.path != "/encoded" {
+				assert.Empty(t, recorder.Header().Get("Content-Length"))
+				body = decode(t, tc.wantEncoding, body)
+			}
+			assert.Equal(t, tc.wantBody, string(body))
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_contentType(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().Build())
+	svr.Get("/json", func(ctx *easyweb.Context) {
+		_ = ctx.OkJson(map[string]string{"payload": payload})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/json", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	// detected from the uncompressed data
+	assert.Equal(t, "text/plain; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, string(decode(t, "gzip", recorder.Body.Bytes())), `{"payload":`)
+}
+
+func TestMiddlewareBuilder_Build_staticResource(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte(payload), 0o644))
+	srh := easyweb.NewStaticResourceHandler(easyweb.StaticResourceHandlerWithFilePath(dir))
+	svr.Get("/static/:file", srh.Handle(), NewMiddlewareBuilder().Build())
+
+	req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/javascript", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, payload, string(decode(t, "gzip", recorder.Body.Bytes())))
+}
+
+func TestNegotiate(t *testing.T) {
+	encodings := []string{EncodingZstd, EncodingBrotli, EncodingGzip, EncodingDeflate}
+
+	tcs := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "identity", want: ""},
+		{acceptEncoding: "gzip, deflate", want: "gzip"},
+		{acceptEncoding: "GZIP;q=0.8, deflate;q=0.9", want: "deflate"},
+		{acceptEncoding: "*;q=0.1, gzip", want: "gzip"},
+		{acceptEncoding: "*, zstd;q=0", want: "br"},
+		{acceptEncoding: "compress, x-custom", want: ""},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, tc.want, negotiate(tc.acceptEncoding, encodings))
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, bs []byte) []byte {
+	var r io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(bs))
+		require.NoError(t, err)
+		r = gr
+	case EncodingDeflate:
+		zr, err := zlib.NewReader(bytes.NewReader(bs))
+		require.NoError(t, err)
+		r = zr
+	case EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(bs))
+	case EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(bs))
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return res
+}
@@ -0,0 +1,67 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingZstd    = "zstd"
+	EncodingBrotli  = "br"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// encoder is implemented by the writers of all the supported encodings,
+// Reset makes the encoder reusable through the pool.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {
+		New: func() any {
+			// one goroutine per encoder, the concurrency comes from the requests
+			enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return enc
+		},
+	},
+	EncodingBrotli: {
+		New: func() any {
+			return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+		},
+	},
+	EncodingGzip: {
+		New: func() any {
+			return gzip.NewWriter(nil)
+		},
+	},
+	// deflate means the zlib format in http, not the raw deflate stream
+	EncodingDeflate: {
+		New: func() any {
+			return zlib.NewWriter(nil)
+		},
+	},
+}
+
+// getEncoder returns a pooled encoder writing to w.
+func getEncoder(encoding string, w io.Writer) encoder {
+	enc := encoderPools[encoding].Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// putEncoder closes the encoder and returns it to the pool.
+func putEncoder(encoding string, enc encoder) error {
+	err := enc.Close()
+	// drop the reference to the destination
+	enc.Reset(nil)
+	encoderPools[encoding].Put(enc)
+	return err
+}
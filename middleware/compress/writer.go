@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"net/http"
+	"strconv"
+)
+
+var (
+	_ http.ResponseWriter = (*compressWriter)(nil)
+	_ http.Flusher        = (*compressWriter)(nil)
+)
+
+// compressWriter compresses what the handler writes to the response directly.
+// The status code is held back until the first write, when the headers are complete
+// and it is known whether the response is to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding       string
+	shouldCompress func(header http.Header, contentType string, size int) bool
+
+	code        int
+	wroteHeader bool
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader || cw.code != 0 {
+		return
+	}
+	cw.code = code
+}
+
+func (cw *compressWriter) Write(bs []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.start(bs)
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(bs)
+	}
+	return cw.ResponseWriter.Write(bs)
+}
+
+// start decides whether to compress by the headers and the first bytes of the response,
+// then writes the headers.
+func (cw *compressWriter) start(bs []byte) {
+	cw.wroteHeader = true
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+
+	header := cw.Header()
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(bs) > 0 {
+		// set it as net/http would do, the sniffing does not work on compressed data
+		contentType = http.DetectContentType(bs)
+		header.Set("Content-Type", contentType)
+	}
+
+	size := -1
+	if cl, err := strconv.Atoi(header.Get("Content-Length")); err == nil {
+		size = cl
+	}
+
+	if bodyAllowed(cw.code) && header.Get("Content-Range") == "" && cw.shouldCompress(header, contentType, size) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		weakenETag(header)
+		cw.enc = getEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+}
+
+// Flush flushes the compressed data to the client, so that streaming responses keep streaming.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.start(nil)
+	}
+
+	if cw.enc != nil {
+		if f, ok := cw.enc.(interface{ Flush() error }); ok {
+			_ = f.Flush()
+		}
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the compressed stream.
+func (cw *compressWriter) Close() error {
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := putEncoder(cw.encoding, cw.enc)
+	cw.enc = nil
+	return err
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
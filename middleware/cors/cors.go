@@ -0,0 +1,209 @@
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MiddlewareBuilder handles cross-origin resource sharing.
+// Preflight requests are answered by the middleware itself, so it should be registered
+// by HttpServer.Use to also see the OPTIONS requests which match no route.
+type MiddlewareBuilder struct {
+	allowOrigins     []string
+	allowOriginFunc  func(origin string) bool
+	allowMethods     []string
+	allowHeaders     []string
+	exposeHeaders    []string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// WithAllowOrigins the origins allowed to access the resources.
+// An origin is either exact ( e.g. https://example.com ), a wildcard subdomain ( e.g. https://*.example.com )
+// or "*" for any origin.
+// defaults to "*".
+func (b *MiddlewareBuilder) WithAllowOrigins(origins ...string) *MiddlewareBuilder {
+	b.allowOrigins = origins
+	return b
+}
+
+// WithAllowOriginFunc allows the origin if the func returns true,
+// it is checked after the origins given by WithAllowOrigins.
+func (b *MiddlewareBuilder) WithAllowOriginFunc(allowOriginFunc func(origin string) bool) *MiddlewareBuilder {
+	b.allowOriginFunc = allowOriginFunc
+	return b
+}
+
+// WithAllowMethods the methods allowed in the preflight requests.
+// defaults to GET, HEAD, POST, PUT, PATCH and DELETE.
+func (b *MiddlewareBuilder) WithAllowMethods(methods ...string) *MiddlewareBuilder {
+	b.allowMethods = methods
+	return b
+}
+
+// WithAllowHeaders the request headers allowed in the preflight requests, "*" allows any header.
+// defaults to Origin, Accept, Content-Type and Authorization.
+func (b *MiddlewareBuilder) WithAllowHeaders(headers ...string) *MiddlewareBuilder {
+	b.allowHeaders = headers
+	return b
+}
+
+// WithExposeHeaders the response headers the browser exposes to the scripts.
+func (b *MiddlewareBuilder) WithExposeHeaders(headers ...string) *MiddlewareBuilder {
+	b.exposeHeaders = headers
+	return b
+}
+
+// WithAllowCredentials allows the requests with cookies or authorization headers.
+// The request origin is echoed instead of "*" in this case, as required by the browsers,
+// so the origins must be given explicitly, Build panics if "*" is allowed.
+func (b *MiddlewareBuilder) WithAllowCredentials(allowCredentials bool) *MiddlewareBuilder {
+	b.allowCredentials = allowCredentials
+	return b
+}
+
+// WithMaxAge how long the browser caches the preflight result.
+func (b *MiddlewareBuilder) WithMaxAge(maxAge time.Duration) *MiddlewareBuilder {
+	b.maxAge = maxAge
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	if b.allowCredentials && slices.Contains(b.allowOrigins, "*") {
+		panic(`[cors] allowing credentials requires explicit origins instead of "*"`)
+	}
+
+	allowMethods := strings.Join(b.allowMethods, ", ")
+	allowAnyHeader := slices.Contains(b.allowHeaders, "*")
+	allowHeaders := make(map[string]struct{}, len(b.allowHeaders))
+	for _, h := range b.allowHeaders {
+		allowHeaders[strings.ToLower(h)] = struct{}{}
+	}
+	exposeHeaders := strings.Join(b.exposeHeaders, ", ")
+
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			origin := ctx.Req.Header.Get("Origin")
+			if origin == "" {
+				next(ctx)
+				return
+			}
+
+			header := ctx.Resp.Header()
+			header.Add("Vary", "Origin")
+
+			preflight := ctx.Req.Method == http.MethodOptions && ctx.Req.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if b.allowOrigin(origin) {
+					b.setOrigin(header, origin)
+					if exposeHeaders != "" {
+						header.Set("Access-Control-Expose-Headers", exposeHeaders)
+					}
+				}
+
+				next(ctx)
+				return
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+
+			reqMethod := ctx.Req.Header.Get("Access-Control-Request-Method")
+			reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers")
+			if !b.allowOrigin(origin) ||
+				!slices.Contains(b.allowMethods, reqMethod) ||
+				!(allowAnyHeader || containsHeaders(allowHeaders, reqHeaders)) {
+				ctx.StatusCode = http.StatusForbidden
+				return
+			}
+
+			b.setOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if reqHeaders != "" {
+				if allowAnyHeader {
+					header.Set("Access-Control-Allow-Headers", reqHeaders)
+				} else {
+					header.Set("Access-Control-Allow-Headers", strings.Join(b.allowHeaders, ", "))
+				}
+			}
+			if b.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(b.maxAge.Seconds())))
+			}
+
+			ctx.StatusCode = http.StatusNoContent
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) allowOrigin(origin string) bool {
+	for _, allowed := range b.allowOrigins {
+		if allowed == "*" || allowed == origin || matchWildcard(allowed, origin) {
+			return true
+		}
+	}
+
+	return b.allowOriginFunc != nil && b.allowOriginFunc(origin)
+}
+
+func (b *MiddlewareBuilder) setOrigin(header http.Header, origin string) {
+	if b.allowCredentials {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+
+	if slices.Contains(b.allowOrigins, "*") {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+}
+
+// matchWildcard matches the origin against a pattern like https://*.example.com,
+// the wildcard stands for one or more subdomain labels.
+func matchWildcard(pattern string, origin string) bool {
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return false
+	}
+
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix) &&
+		strings.HasPrefix(suffix, ".")
+}
+
+// containsHeaders reports whether every header of the comma-separated list is allowed.
+func containsHeaders(allowHeaders map[string]struct{}, headers string) bool {
+	for h := range strings.SplitSeq(headers, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+
+		if _, ok := allowHeaders[h]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		allowOrigins: []string{"*"},
+		allowMethods: []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		allowHeaders: []string{"Origin", "Accept", "Content-Type", "Authorization"},
+	}
+}
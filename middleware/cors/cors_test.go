@@ -0,0 +1,181 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().
+		WithAllowOrigins("https://example.com", "https://*.example.org").
+		WithAllowOriginFunc(func(origin string) bool {
+			return strings.HasSuffix(origin, ".internal")
+		}).
+		WithAllowMethods(http.MethodGet, http.MethodPost).
+		WithAllowHeaders("Content-Type", "X-Token").
+		WithExposeHeaders("X-Request-Id").
+		WithAllowCredentials(true).
+		WithMaxAge(10 * time.Minute).
+		Build())
+
+	svr.Post("/user", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusCreated, []byte("created"))
+	})
+
+	tcs := []struct {
+		name       string
+		method     string
+		reqHeader  map[string]string
+		wantCode   int
+		wantHeader map[string]string
+	}{
+		{
+			name:     "no origin",
+			method:   http.MethodPost,
+			wantCode: http.StatusCreated,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		}, {
+			name:      "exact origin",
+			method:    http.MethodPost,
+			reqHeader: map[string]string{"Origin": "https://example.com"},
+			wantCode:  http.StatusCreated,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-Id",
+				"Vary":                             "Origin",
+			},
+		}, {
+			name:      "wildcard subdomain",
+			method:    http.MethodPost,
+			reqHeader: map[string]string{"Origin": "https://a.b.example.org"},
+			wantCode:  http.StatusCreated,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "https://a.b.example.org",
+			},
+		}, {
+			name:      "wildcard does not match apex",
+			method:    http.MethodPost,
+			reqHeader: map[string]string{"Origin": "https://example.org"},
+			wantCode:  http.StatusCreated,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		}, {
+			name:      "origin func",
+			method:    http.MethodPost,
+			reqHeader: map[string]string{"Origin": "http://svc.internal"},
+			wantCode:  http.StatusCreated,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "http://svc.internal",
+			},
+		}, {
+			name:   "preflight",
+			method: http.MethodOptions,
+			reqHeader: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "content-type, x-token",
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "https://example.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-Token",
+				"Access-Control-Max-Age":       "600",
+			},
+		}, {
+			name:   "preflight method not allowed",
+			method: http.MethodOptions,
+			reqHeader: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			wantCode: http.StatusForbidden,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		}, {
+			name:   "preflight header not allowed",
+			method: http.MethodOptions,
+			reqHeader: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "X-Other",
+			},
+			wantCode: http.StatusForbidden,
+		}, {
+			name:   "preflight origin not allowed",
+			method: http.MethodOptions,
+			reqHeader: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantCode: http.StatusForbidden,
+		}, {
+			name:      "options without preflight falls through",
+			method:    http.MethodOptions,
+			reqHeader: map[string]string{"Origin": "https://example.com"},
+			wantCode:  http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/user", nil)
+			for k, v := range tc.reqHeader {
+				req.Header.Set(k, v)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, recorder.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_anyOrigin(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().WithAllowHeaders("*").Build())
+	svr.Get("/user", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Origin", "https://any.com")
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest(http.MethodOptions, "/user", nil)
+	req.Header.Set("Origin", "https://any.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "X-Anything")
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "X-Anything", recorder.Header().Get("Access-Control-Allow-Headers"))
+}
+
+func TestMiddlewareBuilder_Build_credentialsAnyOrigin(t *testing.T) {
+	// any origin would be echoed with credentials
+	assert.Panics(t, func() {
+		NewMiddlewareBuilder().WithAllowCredentials(true).Build()
+	})
+	assert.Panics(t, func() {
+		NewMiddlewareBuilder().WithAllowOrigins("https://example.com", "*").WithAllowCredentials(true).Build()
+	})
+}
@@ -0,0 +1,342 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/session"
+)
+
+// userValueKey is the key of the token in Context.UserValues.
+const userValueKey = "_csrf"
+
+var (
+	errTokenNotFound = errors.New("[csrf] token not found")
+	errTokenInvalid  = errors.New("[csrf] token invalid")
+)
+
+// MiddlewareBuilder protects the unsafe requests against cross-site request forgery.
+// The token bound to the client must be submitted with every unsafe request,
+// either by the header or by the form field.
+//
+// Two modes are supported:
+//   - synchronizer token, the token is stored in the session, see WithSessionManager.
+//   - double-submit cookie, the token is stored in a cookie, this is the default mode.
+//     The token is signed by the secret and bound to the cookie given by WithBindCookie.
+type MiddlewareBuilder struct {
+	sessionMgr   *session.Manager
+	cookieName   string
+	cookieOpt    func(*http.Cookie)
+	secret       []byte
+	bindCookie   string
+	headerName   string
+	fieldName    string
+	safeMethods  []string
+	exemptRoutes []string
+	statusCode   int
+	errMsg       string
+}
+
+// WithSessionManager stores the token in the session ( synchronizer token mode ).
+// Requests without a session get no token, and their unsafe requests are rejected.
+func (b *MiddlewareBuilder) WithSessionManager(m *session.Manager) *MiddlewareBuilder {
+	b.sessionMgr = m
+	return b
+}
+
+// WithCookieName the cookie of the double-submit cookie mode.
+// defaults to "_csrf".
+func (b *MiddlewareBuilder) WithCookieName(cookieName string) *MiddlewareBuilder {
+	b.cookieName = cookieName
+	return b
+}
+
+// WithCookieOpt customizes the cookie of the double-submit cookie mode ( e.g. Secure, Domain ).
+func (b *MiddlewareBuilder) WithCookieOpt(cookieOpt func(*http.Cookie)) *MiddlewareBuilder {
+	b.cookieOpt = cookieOpt
+	return b
+}
+
+// WithSecret the key signing the token of the double-submit cookie mode,
+// share it among the instances behind a load balancer.
+// defaults to a random key, the tokens are invalidated on restart.
+func (b *MiddlewareBuilder) WithSecret(secret []byte) *MiddlewareBuilder {
+	b.secret = secret
+	return b
+}
+
+// WithBindCookie binds the token of the double-submit cookie mode to the value of the cookie
+// identifying the client ( e.g. the session id ), so the token of another client is rejected.
+// The token is reissued once the value changes.
+func (b *MiddlewareBuilder) WithBindCookie(cookieName string) *MiddlewareBuilder {
+	b.bindCookie = cookieName
+	return b
+}
+
+// WithHeaderName the header carrying the token.
+// defaults to "X-CSRF-Token".
+func (b *MiddlewareBuilder) WithHeaderName(headerName string) *MiddlewareBuilder {
+	b.headerName = headerName
+	return b
+}
+
+// WithFieldName the form field carrying the token.
+// defaults to "_csrf".
+func (b *MiddlewareBuilder) WithFieldName(fieldName string) *MiddlewareBuilder {
+	b.fieldName = fieldName
+	return b
+}
+
+// WithSafeMethods the methods which are not checked.
+// defaults to GET, HEAD, OPTIONS and TRACE.
+func (b *MiddlewareBuilder) WithSafeMethods(methods ...string) *MiddlewareBuilder {
+	b.safeMethods = methods
+	return b
+}
+
+// WithExemptRoutes the routes which are not checked, the route is the registered pattern ( e.g. /webhook/:id ).
+func (b *MiddlewareBuilder) WithExemptRoutes(routes ...string) *MiddlewareBuilder {
+	b.exemptRoutes = routes
+	return b
+}
+
+// WithStatusCode the code returns to the front end when the token mismatches.
+// defaults to 403.
+func (b *MiddlewareBuilder) WithStatusCode(statusCode int) *MiddlewareBuilder {
+	b.statusCode = statusCode
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when the token mismatches.
+// defaults to "Forbidden"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	var store tokenStore = &cookieStore{
+		cookieName: b.cookieName,
+		cookieOpt:  b.cookieOpt,
+		secret:     b.secret,
+		bindCookie: b.bindCookie,
+	}
+	if b.sessionMgr != nil {
+		store = &sessionStore{m: b.sessionMgr, key: "_csrf_token"}
+	}
+
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			if slices.Contains(b.exemptRoutes, ctx.MatchedRoute) {
+				next(ctx)
+				return
+			}
+
+			if slices.Contains(b.safeMethods, ctx.Req.Method) {
+				// issue the token for the forms rendered by the safe requests
+				if token, err := store.load(ctx, true); err == nil {
+					b.setToken(ctx, token)
+				}
+
+				next(ctx)
+				return
+			}
+
+			token, err := store.load(ctx, false)
+			if err != nil || !b.verify(ctx, token) {
+				ctx.StatusCode = b.statusCode
+				ctx.Data = []byte(b.errMsg)
+				return
+			}
+
+			b.setToken(ctx, token)
+			next(ctx)
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) verify(ctx *easyweb.Context, token string) bool {
+	submitted := ctx.Req.Header.Get(b.headerName)
+	if submitted == "" {
+		submitted, _ = ctx.FormParam(b.fieldName).String()
+	}
+
+	return submitted != "" && subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) == 1
+}
+
+// FuncMap returns the template funcs to emit the token,
+// register it by template.Funcs before parsing the templates of the GoTemplateEngine:
+//
+//	{{ csrfField .CSRFToken }}
+func (b *MiddlewareBuilder) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func(token string) template.HTML {
+			return hiddenField(b.fieldName, token)
+		},
+	}
+}
+
+func (b *MiddlewareBuilder) setToken(ctx *easyweb.Context, token string) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[userValueKey] = tokenInfo{token: token, fieldName: b.fieldName}
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+
+	return &MiddlewareBuilder{
+		cookieName: "_csrf",
+		cookieOpt:  func(c *http.Cookie) {},
+		secret:     secret,
+		headerName: "X-CSRF-Token",
+		fieldName:  "_csrf",
+		safeMethods: []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodOptions,
+			http.MethodTrace,
+		},
+		statusCode: http.StatusForbidden,
+		errMsg:     "Forbidden",
+	}
+}
+
+type tokenInfo struct {
+	token     string
+	fieldName string
+}
+
+// Token returns the token of the request, empty if the middleware did not issue one.
+func Token(ctx *easyweb.Context) string {
+	info, _ := ctx.UserValues[userValueKey].(tokenInfo)
+	return info.token
+}
+
+// TemplateField returns the hidden form field carrying the token of the request,
+// pass it to the template data and put it in the form, e.g. {{ .CSRFField }}.
+func TemplateField(ctx *easyweb.Context) template.HTML {
+	info, ok := ctx.UserValues[userValueKey].(tokenInfo)
+	if !ok {
+		return ""
+	}
+	return hiddenField(info.fieldName, info.token)
+}
+
+func hiddenField(name string, token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(name) +
+		`" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+func newToken() (string, error) {
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// tokenStore keeps the token bound to the client.
+type tokenStore interface {
+	// load returns the token of the client, creates one if absent and create is true.
+	load(ctx *easyweb.Context, create bool) (string, error)
+}
+
+type sessionStore struct {
+	m   *session.Manager
+	key string
+}
+
+func (s *sessionStore) load(ctx *easyweb.Context, create bool) (string, error) {
+	sess, err := s.m.GetSession(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if val, err := sess.Get(ctx.Req.Context(), s.key); err == nil {
+		if token, ok := val.(string); ok && token != "" {
+			return token, nil
+		}
+	}
+
+	if !create {
+		return "", errTokenNotFound
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	return token, sess.Set(ctx.Req.Context(), s.key, token)
+}
+
+type cookieStore struct {
+	cookieName string
+	cookieOpt  func(*http.Cookie)
+	secret     []byte
+	bindCookie string
+}
+
+func (c *cookieStore) load(ctx *easyweb.Context, create bool) (string, error) {
+	err := errTokenNotFound
+	if cookie, cookieErr := ctx.Req.Cookie(c.cookieName); cookieErr == nil && cookie.Value != "" {
+		if c.valid(ctx, cookie.Value) {
+			return cookie.Value, nil
+		}
+		err = errTokenInvalid
+	}
+
+	if !create {
+		return "", err
+	}
+
+	nonce, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	token := c.sign(ctx, nonce)
+
+	cookie := &http.Cookie{
+		Name:     c.cookieName,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+	}
+	c.cookieOpt(cookie)
+
+	http.SetCookie(ctx.Resp, cookie)
+	return token, nil
+}
+
+// sign returns the token in the form of nonce.mac,
+// the mac covers the nonce and the value of the bind cookie.
+func (c *cookieStore) sign(ctx *easyweb.Context, nonce string) string {
+	var bound string
+	if c.bindCookie != "" {
+		if cookie, err := ctx.Req.Cookie(c.bindCookie); err == nil {
+			bound = cookie.Value
+		}
+	}
+
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(bound))
+	mac.Write([]byte{0})
+	mac.Write([]byte(nonce))
+	return nonce + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *cookieStore) valid(ctx *easyweb.Context, token string) bool {
+	nonce, _, ok := strings.Cut(token, ".")
+	return ok && hmac.Equal([]byte(c.sign(ctx, nonce)), []byte(token))
+}
@@ -0,0 +1,226 @@
+package csrf
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/session"
+	"github.com/JrMarcco/easy-web/session/cookie"
+	"github.com/JrMarcco/easy-web/session/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build_doubleSubmit(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	mw := NewMiddlewareBuilder().WithExemptRoutes("/webhook/:id").Build()
+	svr.Get("/form", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte(TemplateField(ctx)))
+	}, mw)
+	svr.Post("/form", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("submitted"))
+	}, mw)
+	svr.Post("/webhook/:id", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	}, mw)
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/form", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	csrfCookie := cookies[0]
+	assert.Equal(t, "_csrf", csrfCookie.Name)
+	assert.Equal(t, http.SameSiteLaxMode, csrfCookie.SameSite)
+	assert.Equal(t,
+		`<input type="hidden" name="_csrf" value="`+csrfCookie.Value+`">`,
+		recorder.Body.String(),
+	)
+
+	// the token issued by another server
+	other := easyweb.NewHttpServer()
+	other.Get("/form", func(ctx *easyweb.Context) {}, NewMiddlewareBuilder().Build())
+	recorder = httptest.NewRecorder()
+	other.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/form", nil))
+	forged := recorder.Result().Cookies()[0]
+
+	tcs := []struct {
+		name     string
+		path     string
+		cookie   *http.Cookie
+		header   string
+		form     string
+		wantCode int
+	}{
+		{
+			name:     "header",
+			path:     "/form",
+			cookie:   csrfCookie,
+			header:   csrfCookie.Value,
+			wantCode: http.StatusOK,
+		}, {
+			name:     "form field",
+			path:     "/form",
+			cookie:   csrfCookie,
+			form:     csrfCookie.Value,
+			wantCode: http.StatusOK,
+		}, {
+			name:     "mismatch",
+			path:     "/form",
+			cookie:   csrfCookie,
+			header:   "forged",
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "unsigned cookie",
+			path:     "/form",
+			cookie:   &http.Cookie{Name: "_csrf", Value: "forged"},
+			header:   "forged",
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "signed by another secret",
+			path:     "/form",
+			cookie:   &http.Cookie{Name: "_csrf", Value: forged.Value},
+			header:   forged.Value,
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "missing cookie",
+			path:     "/form",
+			header:   csrfCookie.Value,
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "missing token",
+			path:     "/form",
+			cookie:   csrfCookie,
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "exempt route",
+			path:     "/webhook/1",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(url.Values{"_csrf": {tc.form}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_bindCookie(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	mw := NewMiddlewareBuilder().WithSecret([]byte("secret")).WithBindCookie("sid").Build()
+	svr.Get("/form", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte(Token(ctx)))
+	}, mw)
+	svr.Post("/form", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	}, mw)
+
+	serve := func(method string, sid string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/form", nil)
+		req.AddCookie(&http.Cookie{Name: "sid", Value: sid})
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "_csrf", Value: token})
+			req.Header.Set("X-CSRF-Token", token)
+		}
+
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	alice := serve(http.MethodGet, "alice", "").Body.String()
+	require.NotEmpty(t, alice)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "alice", alice).Code)
+
+	// the token of alice is rejected for bob, and reissued
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "bob", alice).Code)
+	bob := serve(http.MethodGet, "bob", alice).Body.String()
+	assert.NotEqual(t, alice, bob)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "bob", bob).Code)
+}
+
+func TestMiddlewareBuilder_Build_synchronizer(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	m := session.NewManager(memory.NewMemStore(), cookie.NewCPropagator())
+
+	builder := NewMiddlewareBuilder().WithSessionManager(m).WithFieldName("token")
+	tpl := template.Must(template.New("form").Funcs(builder.FuncMap()).Parse(`<form>{{ csrfField .Token }}</form>`))
+
+	svr.Get("/login", func(ctx *easyweb.Context) {
+		_, err := m.NewSession(ctx)
+		require.NoError(t, err)
+	})
+
+	mw := builder.Build()
+	svr.Get("/form", func(ctx *easyweb.Context) {
+		bs := &bytes.Buffer{}
+		require.NoError(t, tpl.Execute(bs, map[string]any{"Token": Token(ctx)}))
+		_ = ctx.RespBytes(http.StatusOK, bs.Bytes())
+	}, mw)
+	svr.Put("/form", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	}, mw)
+
+	// no session, no token
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Equal(t, `<form><input type="hidden" name="token" value=""></form>`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login", nil))
+	sessionCookie := recorder.Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(sessionCookie)
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+
+	body := recorder.Body.String()
+	prefix := `<form><input type="hidden" name="token" value="`
+	require.True(t, strings.HasPrefix(body, prefix), body)
+	token := strings.TrimSuffix(strings.TrimPrefix(body, prefix), `"></form>`)
+	assert.NotEmpty(t, token)
+
+	// the token is kept in the session
+	req = httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(sessionCookie)
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	assert.Equal(t, body, recorder.Body.String())
+
+	req = httptest.NewRequest(http.MethodPut, "/form", nil)
+	req.AddCookie(sessionCookie)
+	req.Header.Set("X-CSRF-Token", token)
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// the token of the session can not be used without the session
+	req = httptest.NewRequest(http.MethodPut, "/form", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "Forbidden", recorder.Body.String())
+}
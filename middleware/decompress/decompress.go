@@ -0,0 +1,140 @@
+package decompress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/compress"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decoderFunc returns the decoder of r, maxSize is the max size of the decoded body.
+type decoderFunc func(r io.Reader, maxSize int64) (io.ReadCloser, error)
+
+var decoders = map[string]decoderFunc{
+	compress.EncodingGzip: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	compress.EncodingDeflate: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+	compress.EncodingBrotli: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	compress.EncodingZstd: func(r io.Reader, maxSize int64) (io.ReadCloser, error) {
+		// the window declared by the frame is allocated up front, so it is capped by the max size as well
+		dec, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(uint64(max(maxSize, zstd.MinWindowSize))),
+			zstd.WithDecoderMaxMemory(uint64(max(maxSize, 1))),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	},
+}
+
+// MiddlewareBuilder decodes the request body by its Content-Encoding,
+// so that Context.BindJson and Context.FormParam read the decoded body.
+//
+// Reading beyond the max size fails with *http.MaxBytesError,
+// the handler should answer 413 in this case.
+type MiddlewareBuilder struct {
+	encodings []string
+	maxSize   int64
+}
+
+// WithEncodings the accepted encodings.
+// defaults to gzip, deflate, br and zstd.
+func (b *MiddlewareBuilder) WithEncodings(encodings ...string) *MiddlewareBuilder {
+	b.encodings = encodings
+	return b
+}
+
+// WithMaxSize the max size of the decoded body, which protects against the decompression bombs.
+// defaults to 10MB.
+func (b *MiddlewareBuilder) WithMaxSize(maxSize int64) *MiddlewareBuilder {
+	b.maxSize = maxSize
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			encodings := parseEncodings(ctx.Req.Header.Get("Content-Encoding"))
+			if len(encodings) == 0 || ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+				next(ctx)
+				return
+			}
+
+			for _, encoding := range encodings {
+				if _, ok := decoders[encoding]; !ok || !slices.Contains(b.encodings, encoding) {
+					// RFC 7694, tell the client the acceptable encodings
+					ctx.Resp.Header().Set("Accept-Encoding", strings.Join(b.encodings, ", "))
+					ctx.StatusCode = http.StatusUnsupportedMediaType
+					ctx.Data = []byte("Unsupported Content-Encoding")
+					return
+				}
+			}
+
+			// the encodings are listed in the order they are applied
+			body := ctx.Req.Body
+			for i := len(encodings) - 1; i >= 0; i-- {
+				dec, err := decoders[encodings[i]](body, b.maxSize)
+				if err != nil {
+					ctx.StatusCode = http.StatusBadRequest
+					ctx.Data = []byte("Malformed request body")
+					return
+				}
+				defer func() {
+					_ = dec.Close()
+				}()
+				body = dec
+			}
+
+			req := ctx.Req.Clone(ctx.Req.Context())
+			req.Body = http.MaxBytesReader(ctx.Resp, body, b.maxSize)
+			req.ContentLength = -1
+			req.Header.Del("Content-Encoding")
+			req.Header.Del("Content-Length")
+
+			ctx.Req = req
+			next(ctx)
+		}
+	}
+}
+
+// parseEncodings returns the encodings except identity in the header.
+func parseEncodings(contentEncoding string) []string {
+	var encodings []string
+	for encoding := range strings.SplitSeq(contentEncoding, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "x-gzip" {
+			encoding = compress.EncodingGzip
+		}
+
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		encodings: []string{
+			compress.EncodingGzip,
+			compress.EncodingDeflate,
+			compress.EncodingBrotli,
+			compress.EncodingZstd,
+		},
+		maxSize: 10 << 20,
+	}
+}
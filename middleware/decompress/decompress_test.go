@@ -0,0 +1,187 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/compress"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	mw := NewMiddlewareBuilder().WithMaxSize(1024).Build()
+
+	svr.Post("/json", func(ctx *easyweb.Context) {
+		var user struct {
+			Name string `json:"name"`
+		}
+
+		err := ctx.BindJson(&user)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			_ = ctx.RespBytes(http.StatusRequestEntityTooLarge, nil)
+			return
+		}
+		if err != nil {
+			_ = ctx.RespBytes(http.StatusBadRequest, []byte(err.Error()))
+			return
+		}
+
+		_ = ctx.RespBytes(http.StatusOK, []byte(user.Name))
+	}, mw)
+	svr.Post("/form", func(ctx *easyweb.Context) {
+		name, _ := ctx.FormParam("name").String()
+		_ = ctx.RespBytes(http.StatusOK, []byte(name))
+	}, mw)
+
+	tcs := []struct {
+		name            string
+		path            string
+		contentEncoding string
+		contentType     string
+		body            []byte
+		wantCode        int
+		wantBody        string
+	}{
+		{
+			name:     "identity",
+			path:     "/json",
+			body:     []byte(`{"name":"tom"}`),
+			wantCode: http.StatusOK,
+			wantBody: "tom",
+		}, {
+			name:            "gzip",
+			path:            "/json",
+			contentEncoding: "gzip",
+			body:            gzipBytes(t, []byte(`{"name":"tom"}`)),
+			wantCode:        http.StatusOK,
+			wantBody:        "tom",
+		}, {
+			name:            "zstd",
+			path:            "/json",
+			contentEncoding: "zstd",
+			body:            zstdBytes(t, []byte(`{"name":"jerry"}`)),
+			wantCode:        http.StatusOK,
+			wantBody:        "jerry",
+		}, {
+			name:            "gzip then zstd",
+			path:            "/json",
+			contentEncoding: "gzip, zstd",
+			body:            zstdBytes(t, gzipBytes(t, []byte(`{"name":"tom"}`))),
+			wantCode:        http.StatusOK,
+			wantBody:        "tom",
+		}, {
+			name:            "form",
+			path:            "/form",
+			contentEncoding: "gzip",
+			contentType:     "application/x-www-form-urlencoded",
+			body:            gzipBytes(t, []byte(url.Values{"name": {"tom"}}.Encode())),
+			wantCode:        http.StatusOK,
+			wantBody:        "tom",
+		}, {
+			name:            "unsupported",
+			path:            "/json",
+			contentEncoding: "compress",
+			body:            []byte(`{"name":"tom"}`),
+			wantCode:        http.StatusUnsupportedMediaType,
+			wantBody:        "Unsupported Content-Encoding",
+		}, {
+			name:            "malformed",
+			path:            "/json",
+			contentEncoding: "gzip",
+			body:            []byte(`{"name":"tom"}`),
+			wantCode:        http.StatusBadRequest,
+			wantBody:        "Malformed request body",
+		}, {
+			name:            "bomb",
+			path:            "/json",
+			contentEncoding: "gzip",
+			body:            gzipBytes(t, []byte(`{"name":"`+strings.Repeat("a", 1<<20)+`"}`)),
+			wantCode:        http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader(tc.body))
+			if tc.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tc.contentEncoding)
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_encodings(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Post("/", func(ctx *easyweb.Context) {
+		bs, _ := io.ReadAll(ctx.Req.Body)
+		_ = ctx.RespBytes(http.StatusOK, bs)
+	}, NewMiddlewareBuilder().WithEncodings("gzip").Build())
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(zstdBytes(t, []byte("data"))))
+	req.Header.Set("Content-Encoding", "zstd")
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+	assert.Equal(t, "gzip", recorder.Header().Get("Accept-Encoding"))
+}
+
+func gzipBytes(t *testing.T, bs []byte) []byte {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write(bs)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, bs []byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	return enc.EncodeAll(bs, nil)
+}
+
+func TestDecoders_zstdWindow(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc, err := zstd.NewWriter(buf, zstd.WithWindowSize(1<<20))
+	require.NoError(t, err)
+	_, err = enc.Write(bytes.Repeat([]byte("data"), 64<<10))
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	// the window is larger than the max size
+	dec, err := decoders[compress.EncodingZstd](bytes.NewReader(buf.Bytes()), 64<<10)
+	require.NoError(t, err)
+	_, err = io.ReadAll(dec)
+	assert.ErrorIs(t, err, zstd.ErrWindowSizeExceeded)
+	_ = dec.Close()
+
+	dec, err = decoders[compress.EncodingZstd](bytes.NewReader(buf.Bytes()), 1<<20)
+	require.NoError(t, err)
+	bs, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Len(t, bs, 256<<10)
+	_ = dec.Close()
+}
@@ -0,0 +1,127 @@
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MiddlewareBuilder sets the ETag of the responses buffered in Context.Data
+// and answers the conditional requests ( If-None-Match, If-Modified-Since ) with 304 Not Modified.
+//
+// The ETag set by the handler is kept, so is the Last-Modified.
+// Only the successful GET and HEAD responses are tagged, the responses written to Context.Resp directly
+// ( e.g. the file handlers, which handle the conditional requests themselves ) are left untouched.
+type MiddlewareBuilder struct {
+	weak bool
+}
+
+// WithWeak generates weak ETags ( W/"..." ), which only claim the responses are semantically equivalent.
+// defaults to false.
+func (b *MiddlewareBuilder) WithWeak(weak bool) *MiddlewareBuilder {
+	b.weak = weak
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			next(ctx)
+
+			method := ctx.Req.Method
+			if method != http.MethodGet && method != http.MethodHead {
+				return
+			}
+
+			status := ctx.StatusCode
+			if status == 0 && len(ctx.Data) > 0 {
+				status = http.StatusOK
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			header := ctx.Resp.Header()
+			etag := header.Get("ETag")
+			if etag == "" {
+				etag = Generate(ctx.Data, b.weak)
+				header.Set("ETag", etag)
+			}
+
+			if notModified(ctx.Req, etag, header.Get("Last-Modified")) {
+				writeNotModified(ctx)
+			}
+		}
+	}
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{}
+}
+
+// Generate returns the ETag of the data, a quoted hash of it.
+func Generate(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// notModified evaluates the conditional headers, If-Modified-Since is ignored if If-None-Match is present.
+func notModified(req *http.Request, etag string, lastModified string) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return matchWeak(inm, etag)
+	}
+
+	ims := req.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	// the HTTP dates are of second precision
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// matchWeak reports whether any of the list of ETags matches the ETag by the weak comparison,
+// which is used by If-None-Match.
+func matchWeak(list string, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for candidate := range strings.SplitSeq(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified drops the body and the headers describing it, the validators and the caching headers are kept.
+func writeNotModified(ctx *easyweb.Context) {
+	header := ctx.Resp.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	if header.Get("ETag") != "" {
+		header.Del("Last-Modified")
+	}
+
+	ctx.StatusCode = http.StatusNotModified
+	ctx.Data = nil
+}
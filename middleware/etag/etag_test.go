@@ -0,0 +1,161 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().Build())
+
+	body := []byte(`{"name":"easy-web"}`)
+	etag := Generate(body, false)
+	lastModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	svr.Get("/user", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Content-Type", "application/json")
+		_ = ctx.RespBytes(http.StatusOK, body)
+	})
+	svr.Get("/custom", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("ETag", `W/"v1"`)
+		_ = ctx.RespBytes(http.StatusOK, body)
+	})
+	svr.Get("/modified", func(ctx *easyweb.Context) {
+		ctx.Resp.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_ = ctx.RespBytes(http.StatusOK, body)
+	})
+	svr.Get("/created", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusCreated, body)
+	})
+	svr.Post("/user", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, body)
+	})
+
+	tcs := []struct {
+		name     string
+		method   string
+		path     string
+		header   map[string]string
+		wantCode int
+		wantETag string
+		wantBody string
+	}{
+		{
+			name:     "tagged",
+			method:   http.MethodGet,
+			path:     "/user",
+			wantCode: http.StatusOK,
+			wantETag: etag,
+			wantBody: string(body),
+		}, {
+			name:     "not modified",
+			method:   http.MethodGet,
+			path:     "/user",
+			header:   map[string]string{"If-None-Match": `"other", ` + etag},
+			wantCode: http.StatusNotModified,
+			wantETag: etag,
+		}, {
+			name:     "weak comparison",
+			method:   http.MethodGet,
+			path:     "/user",
+			header:   map[string]string{"If-None-Match": "W/" + etag},
+			wantCode: http.StatusNotModified,
+			wantETag: etag,
+		}, {
+			name:     "any",
+			method:   http.MethodGet,
+			path:     "/user",
+			header:   map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusNotModified,
+			wantETag: etag,
+		}, {
+			name:     "modified",
+			method:   http.MethodGet,
+			path:     "/user",
+			header:   map[string]string{"If-None-Match": `"other"`},
+			wantCode: http.StatusOK,
+			wantETag: etag,
+			wantBody: string(body),
+		}, {
+			name:     "etag of handler",
+			method:   http.MethodGet,
+			path:     "/custom",
+			header:   map[string]string{"If-None-Match": `"v1"`},
+			wantCode: http.StatusNotModified,
+			wantETag: `W/"v1"`,
+		}, {
+			name:   "if-modified-since ignored with if-none-match",
+			method: http.MethodGet,
+			path:   "/modified",
+			header: map[string]string{
+				"If-None-Match":     `"other"`,
+				"If-Modified-Since": lastModified.Format(http.TimeFormat),
+			},
+			wantCode: http.StatusOK,
+			wantETag: etag,
+			wantBody: string(body),
+		}, {
+			name:     "not modified since",
+			method:   http.MethodGet,
+			path:     "/modified",
+			header:   map[string]string{"If-Modified-Since": lastModified.Add(time.Hour).Format(http.TimeFormat)},
+			wantCode: http.StatusNotModified,
+			wantETag: etag,
+		}, {
+			name:     "modified since",
+			method:   http.MethodGet,
+			path:     "/modified",
+			header:   map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+			wantCode: http.StatusOK,
+			wantETag: etag,
+			wantBody: string(body),
+		}, {
+			name:     "not ok",
+			method:   http.MethodGet,
+			path:     "/created",
+			header:   map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusCreated,
+			wantBody: string(body),
+		}, {
+			name:     "not get",
+			method:   http.MethodPost,
+			path:     "/user",
+			header:   map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusOK,
+			wantBody: string(body),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantETag, recorder.Header().Get("ETag"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			if tc.wantCode == http.StatusNotModified {
+				assert.Empty(t, recorder.Header().Get("Content-Type"))
+				assert.Empty(t, recorder.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	strong := Generate([]byte("easy-web"), false)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, strong)
+	assert.Equal(t, "W/"+strong, Generate([]byte("easy-web"), true))
+	assert.NotEqual(t, strong, Generate([]byte("easy_web"), false))
+}
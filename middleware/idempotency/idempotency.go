@@ -0,0 +1,295 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/internal/respwriter"
+)
+
+// ErrLockLost is returned by Store.Save when the key is no longer locked by the caller,
+// e.g. the lock has expired and the key is taken by a retry.
+var ErrLockLost = errors.New("[idempotency] the lock of the key is lost")
+
+// Store locks the idempotency keys and keeps the responses of them.
+//
+// A lock is owned by the token of its Record, a retry of the same request has the same fingerprint
+// but a different token, so that a request outliving its lock never releases or overwrites the lock of the retry.
+type Store interface {
+	// Lock takes the key with the lock record until the ttl expires.
+	// It returns the record of the key if the key is already taken, nil if it is taken by this call.
+	Lock(ctx context.Context, key string, lock *Record, ttl time.Duration) (*Record, error)
+	// Save replaces the lock of the token with the response, which is kept for the ttl.
+	// It returns ErrLockLost if the key is not locked by the token.
+	Save(ctx context.Context, key string, token string, rec *Record, ttl time.Duration) error
+	// Unlock releases the key if it is still locked by the token, so that the request is able to be retried.
+	Unlock(ctx context.Context, key string, token string) error
+}
+
+// Record is the state of an idempotency key.
+type Record struct {
+	// Fingerprint identifies the request which takes the key.
+	Fingerprint string `json:"fingerprint"`
+	// Token identifies the owner of the lock, it is empty once the request is completed.
+	Token string `json:"token,omitempty"`
+	// Completed is false while the request is in flight.
+	Completed  bool        `json:"completed,omitempty"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Data       []byte      `json:"data,omitempty"`
+}
+
+// ScopeFunc returns the scope of the idempotency keys of the request, e.g. the user id,
+// so that the same keys of different clients do not collide.
+type ScopeFunc func(ctx *easyweb.Context) string
+
+// MiddlewareBuilder makes the unsafe requests carrying an idempotency key safe to retry.
+//
+// The first request of a key is handled and its response ( the status code, the headers set by the handler
+// and Context.Data ) is stored, the duplicates get the stored response replayed with Idempotent-Replayed: true.
+// A duplicate arriving while the first request is in flight is rejected with 409,
+// a request reusing the key with a different method, path or body is rejected with 422.
+// The body is buffered to fingerprint the request, a body larger than WithMaxBodySize is rejected with 413.
+//
+// The 5xx responses, the panics and the responses written to Context.Resp directly are not stored,
+// the key is released for a retry instead.
+type MiddlewareBuilder struct {
+	store     Store
+	header    string
+	methods   []string
+	required  bool
+	scopeFunc ScopeFunc
+	ttl       time.Duration
+	lockTTL   time.Duration
+	maxBody   int64
+	logFunc   func(ctx *easyweb.Context, err error)
+}
+
+// WithHeader the request header carrying the idempotency key.
+// defaults to "Idempotency-Key".
+func (b *MiddlewareBuilder) WithHeader(header string) *MiddlewareBuilder {
+	b.header = header
+	return b
+}
+
+// WithMethods the methods to make idempotent.
+// defaults to POST and PATCH.
+func (b *MiddlewareBuilder) WithMethods(methods ...string) *MiddlewareBuilder {
+	b.methods = methods
+	return b
+}
+
+// WithRequired rejects the requests without the idempotency key with 400.
+// defaults to false, the requests without the key are handled as usual.
+func (b *MiddlewareBuilder) WithRequired(required bool) *MiddlewareBuilder {
+	b.required = required
+	return b
+}
+
+// WithScopeFunc scopes the idempotency keys.
+// defaults to nil, the keys are global.
+func (b *MiddlewareBuilder) WithScopeFunc(scopeFunc ScopeFunc) *MiddlewareBuilder {
+	b.scopeFunc = scopeFunc
+	return b
+}
+
+// WithTTL how long the responses are kept for the duplicates.
+// defaults to 24 hours.
+func (b *MiddlewareBuilder) WithTTL(ttl time.Duration) *MiddlewareBuilder {
+	b.ttl = ttl
+	return b
+}
+
+// WithLockTTL how long a key is locked at most by the request in flight,
+// which releases the key if the instance crashes. It should be longer than the timeout of the requests.
+// defaults to 1 minute.
+func (b *MiddlewareBuilder) WithLockTTL(lockTTL time.Duration) *MiddlewareBuilder {
+	b.lockTTL = lockTTL
+	return b
+}
+
+// WithMaxBodySize the max size of the request body buffered to fingerprint the request.
+// defaults to 10MB.
+func (b *MiddlewareBuilder) WithMaxBodySize(maxBodySize int64) *MiddlewareBuilder {
+	b.maxBody = maxBodySize
+	return b
+}
+
+// WithLogFunc is called when the store fails, the request is handled without the idempotency guarantee in this case.
+func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context, err error)) *MiddlewareBuilder {
+	b.logFunc = logFunc
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			if !slices.Contains(b.methods, ctx.Req.Method) {
+				next(ctx)
+				return
+			}
+
+			idempotencyKey := ctx.Req.Header.Get(b.header)
+			if idempotencyKey == "" {
+				if b.required {
+					respond(ctx, http.StatusBadRequest)
+					return
+				}
+				next(ctx)
+				return
+			}
+
+			fingerprint, err := b.fingerprint(ctx)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					respond(ctx, http.StatusRequestEntityTooLarge)
+					return
+				}
+				respond(ctx, http.StatusBadRequest)
+				return
+			}
+
+			key := idempotencyKey
+			if b.scopeFunc != nil {
+				key = b.scopeFunc(ctx) + ":" + key
+			}
+
+			// the client going away must not stop the response from being stored
+			storeCtx := context.WithoutCancel(ctx.Req.Context())
+			token := newToken()
+			rec, err := b.store.Lock(storeCtx, key, &Record{Fingerprint: fingerprint, Token: token}, b.lockTTL)
+			if err != nil {
+				b.logFunc(ctx, err)
+				next(ctx)
+				return
+			}
+
+			if rec != nil {
+				b.replay(ctx, rec, fingerprint)
+				return
+			}
+
+			b.handle(ctx, next, storeCtx, key, fingerprint, token)
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) handle(ctx *easyweb.Context, next easyweb.HandleFunc, storeCtx context.Context, key string, fingerprint string, token string) {
+	header := ctx.Resp.Header()
+	before := header.Clone()
+
+	resp := ctx.Resp
+	cw := &respwriter.Counting{ResponseWriter: resp}
+	ctx.Resp = cw
+
+	saved := false
+	defer func() {
+		ctx.Resp = resp
+		if saved {
+			return
+		}
+		// also on panics
+		if err := b.store.Unlock(storeCtx, key, token); err != nil {
+			b.logFunc(ctx, err)
+		}
+	}()
+
+	next(ctx)
+
+	status := ctx.StatusCode
+	if status == 0 && len(ctx.Data) > 0 {
+		status = http.StatusOK
+	}
+	if cw.Direct() || status == 0 || status >= http.StatusInternalServerError {
+		return
+	}
+
+	err := b.store.Save(storeCtx, key, token, &Record{
+		Fingerprint: fingerprint,
+		Completed:   true,
+		StatusCode:  status,
+		Header:      respwriter.ChangedHeader(before, header),
+		Data:        ctx.Data,
+	}, b.ttl)
+	if err != nil {
+		b.logFunc(ctx, err)
+		return
+	}
+	saved = true
+}
+
+func (b *MiddlewareBuilder) replay(ctx *easyweb.Context, rec *Record, fingerprint string) {
+	if rec.Fingerprint != fingerprint {
+		respond(ctx, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !rec.Completed {
+		ctx.Resp.Header().Set("Retry-After", "1")
+		respond(ctx, http.StatusConflict)
+		return
+	}
+
+	header := ctx.Resp.Header()
+	for k, v := range rec.Header {
+		header[k] = v
+	}
+	header.Set("Idempotent-Replayed", "true")
+
+	ctx.StatusCode = rec.StatusCode
+	ctx.Data = rec.Data
+}
+
+// fingerprint hashes the method, the path and the body of the request, the body is restored for the handler.
+func (b *MiddlewareBuilder) fingerprint(ctx *easyweb.Context) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(ctx.Req.Method + " " + ctx.Req.URL.Path + "\n"))
+
+	if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody {
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Resp, ctx.Req.Body, b.maxBody))
+		_ = ctx.Req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		ctx.Req.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func NewMiddlewareBuilder(store Store) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		store:   store,
+		header:  "Idempotency-Key",
+		methods: []string{http.MethodPost, http.MethodPatch},
+		ttl:     24 * time.Hour,
+		lockTTL: time.Minute,
+		maxBody: 10 << 20,
+		logFunc: func(ctx *easyweb.Context, err error) {
+			log.Printf("idempotency store failed in path %s: %v", ctx.Req.URL.Path, err)
+		},
+	}
+}
+
+func newToken() string {
+	bs := make([]byte, 16)
+	_, _ = rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+func respond(ctx *easyweb.Context, statusCode int) {
+	ctx.StatusCode = statusCode
+	ctx.Data = []byte(http.StatusText(statusCode))
+}
@@ -0,0 +1,278 @@
+package idempotency
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	stores := map[string]Store{
+		"memory": NewMemStore(),
+		"redis":  NewRStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testMiddlewareBuilder(t, store)
+		})
+	}
+}
+
+func testMiddlewareBuilder(t *testing.T, store Store) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(store).
+		WithScopeFunc(func(ctx *easyweb.Context) string {
+			return ctx.Req.Header.Get("X-User")
+		}).
+		Build())
+
+	var calls atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	svr.Post("/pay", func(ctx *easyweb.Context) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(ctx.Req.Body)
+		ctx.Resp.Header().Set("Location", "/pay/"+strconv.Itoa(int(n)))
+		_ = ctx.RespBytes(http.StatusCreated, []byte(string(body)+" #"+strconv.Itoa(int(n))))
+	})
+	svr.Post("/slow", func(ctx *easyweb.Context) {
+		entered <- struct{}{}
+		<-release
+		_ = ctx.Ok()
+	})
+	status := http.StatusBadGateway
+	svr.Post("/flaky", func(ctx *easyweb.Context) {
+		calls.Add(1)
+		_ = ctx.RespBytes(status, nil)
+	})
+	svr.Post("/panic", func(ctx *easyweb.Context) {
+		calls.Add(1)
+		panic("boom")
+	})
+
+	serve := func(path string, key string, user string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		req.Header.Set("X-User", user)
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("/pay", "k1", "u1", "100")
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "100 #1", recorder.Body.String())
+	assert.Empty(t, recorder.Header().Get("Idempotent-Replayed"))
+
+	// replayed
+	recorder = serve("/pay", "k1", "u1", "100")
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "100 #1", recorder.Body.String())
+	assert.Equal(t, "/pay/1", recorder.Header().Get("Location"))
+	assert.Equal(t, "true", recorder.Header().Get("Idempotent-Replayed"))
+
+	// the keys are scoped
+	assert.Equal(t, "100 #2", serve("/pay", "k1", "u2", "100").Body.String())
+
+	// without the key
+	assert.Equal(t, "100 #3", serve("/pay", "", "u1", "100").Body.String())
+	assert.Equal(t, "100 #4", serve("/pay", "", "u1", "100").Body.String())
+
+	// a different body
+	recorder = serve("/pay", "k1", "u1", "200")
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, "Unprocessable Entity", recorder.Body.String())
+
+	// a different path
+	assert.Equal(t, http.StatusUnprocessableEntity, serve("/flaky", "k1", "u1", "100").Code)
+
+	// a concurrent duplicate
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve("/slow", "k2", "u1", "")
+	}()
+	<-entered
+
+	recorder = serve("/slow", "k2", "u1", "")
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+	assert.Equal(t, "true", serve("/slow", "k2", "u1", "").Header().Get("Idempotent-Replayed"))
+
+	// the 5xx responses and the panics release the key
+	calls.Store(0)
+	assert.Equal(t, http.StatusBadGateway, serve("/flaky", "k3", "u1", "").Code)
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, serve("/flaky", "k3", "u1", "").Code)
+	assert.Equal(t, http.StatusOK, serve("/flaky", "k3", "u1", "").Code)
+	assert.Equal(t, int32(2), calls.Load())
+
+	assert.Panics(t, func() { serve("/panic", "k4", "u1", "") })
+	assert.Panics(t, func() { serve("/panic", "k4", "u1", "") })
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestMiddlewareBuilder_Build_options(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(NewMemStore()).
+		WithHeader("X-Request-Key").
+		WithMethods(http.MethodPut).
+		WithRequired(true).
+		WithTTL(time.Minute).
+		Build())
+
+	var calls int
+	hdl := func(ctx *easyweb.Context) {
+		calls++
+		_ = ctx.Ok()
+	}
+	svr.Put("/order", hdl)
+	svr.Post("/order", hdl)
+
+	serve := func(method string, key string) int {
+		req := httptest.NewRequest(method, "/order", nil)
+		if key != "" {
+			req.Header.Set("X-Request-Key", key)
+		}
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "k1"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "k1"))
+	assert.Equal(t, 1, calls)
+
+	// not an idempotent method
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, ""))
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddlewareBuilder_Build_maxBodySize(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(NewMemStore()).WithMaxBodySize(8).Build())
+
+	var calls int
+	svr.Post("/order", func(ctx *easyweb.Context) {
+		calls++
+		_ = ctx.Ok()
+	})
+
+	serve := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "k1")
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(`{"id":123}`))
+	assert.Zero(t, calls)
+	assert.Equal(t, http.StatusOK, serve(`{"id":1}`))
+	assert.Equal(t, 1, calls)
+}
+
+func TestMiddlewareBuilder_Build_storeFailure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+
+	var errs []error
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(NewRStore(client)).
+		WithLogFunc(func(ctx *easyweb.Context, err error) {
+			errs = append(errs, err)
+		}).
+		Build())
+	svr.Post("/", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	})
+
+	mr.Close()
+
+	// fail open
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Idempotency-Key", "k1")
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, errs, 1)
+}
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mem := NewMemStore()
+
+	tcs := []struct {
+		name   string
+		store  Store
+		expire func()
+	}{
+		{
+			name:   "memory",
+			store:  mem,
+			expire: func() { mem.c.Delete("k1") },
+		}, {
+			name:   "redis",
+			store:  NewRStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), RStoreWithPrefix("idem")),
+			expire: func() { mr.FastForward(time.Minute) },
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.store
+			ctx := t.Context()
+
+			rec, err := s.Lock(ctx, "k1", &Record{Fingerprint: "f1", Token: "a"}, time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, rec)
+
+			rec, err = s.Lock(ctx, "k1", &Record{Fingerprint: "f2", Token: "b"}, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, &Record{Fingerprint: "f1", Token: "a"}, rec)
+
+			// the lock of a expires and the key is taken by the retry b of the same request
+			tc.expire()
+			rec, err = s.Lock(ctx, "k1", &Record{Fingerprint: "f1", Token: "b"}, time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, rec)
+
+			// a neither releases nor overwrites the lock of b
+			require.NoError(t, s.Unlock(ctx, "k1", "a"))
+			assert.ErrorIs(t, s.Save(ctx, "k1", "a", &Record{Fingerprint: "f1", Completed: true}, time.Hour), ErrLockLost)
+			rec, err = s.Lock(ctx, "k1", &Record{Fingerprint: "f1", Token: "c"}, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, &Record{Fingerprint: "f1", Token: "b"}, rec)
+
+			saved := &Record{Fingerprint: "f1", Completed: true, StatusCode: http.StatusOK}
+			require.NoError(t, s.Save(ctx, "k1", "b", saved, time.Hour))
+			// the response is not released
+			require.NoError(t, s.Unlock(ctx, "k1", "b"))
+			rec, err = s.Lock(ctx, "k1", &Record{Fingerprint: "f1", Token: "c"}, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, saved, rec)
+		})
+	}
+
+	assert.Equal(t, time.Hour, mr.TTL("idem:k1"))
+}
@@ -0,0 +1,8 @@
+local rec = redis.call("get", KEYS[1])
+if rec
+then
+    return rec
+end
+
+redis.call("set", KEYS[1], ARGV[1], "px", ARGV[2])
+return false
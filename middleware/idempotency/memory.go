@@ -0,0 +1,68 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+var _ Store = (*MemStore)(nil)
+
+// MemStore stores the records in memory, which only works for a single instance.
+type MemStore struct {
+	mu sync.Mutex
+	c  *cache.Cache
+}
+
+func (s *MemStore) Lock(_ context.Context, key string, lock *Record, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if val, ok := s.c.Get(key); ok {
+		rec := *val.(*Record)
+		return &rec, nil
+	}
+
+	l := *lock
+	s.c.Set(key, &l, ttl)
+	return nil, nil
+}
+
+func (s *MemStore) Save(_ context.Context, key string, token string, rec *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.locked(key, token) {
+		return ErrLockLost
+	}
+	s.c.Set(key, rec, ttl)
+	return nil
+}
+
+func (s *MemStore) Unlock(_ context.Context, key string, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked(key, token) {
+		s.c.Delete(key)
+	}
+	return nil
+}
+
+// locked reports whether the key is locked by the token.
+func (s *MemStore) locked(key string, token string) bool {
+	val, ok := s.c.Get(key)
+	if !ok {
+		return false
+	}
+	rec := val.(*Record)
+	return !rec.Completed && rec.Token == token
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		c: cache.New(cache.NoExpiration, time.Minute),
+	}
+}
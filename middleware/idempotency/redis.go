@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed lock.lua
+var lockLua string
+
+//go:embed save.lua
+var saveLua string
+
+//go:embed unlock.lua
+var unlockLua string
+
+var _ Store = (*RStore)(nil)
+
+// RStore stores the records in redis, so that the duplicates are detected across the instances of the service.
+type RStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+func (s *RStore) Lock(ctx context.Context, key string, lock *Record, ttl time.Duration) (*Record, error) {
+	val, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Eval(ctx, lockLua, []string{s.key(key)}, val, ttl.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Record{}
+	if err = json.Unmarshal([]byte(res), rec); err != nil {
+		return nil, fmt.Errorf("[idempotency] invalid record of key %s: %w", key, err)
+	}
+	return rec, nil
+}
+
+func (s *RStore) Save(ctx context.Context, key string, token string, rec *Record, ttl time.Duration) error {
+	val, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	saved, err := s.client.Eval(ctx, saveLua, []string{s.key(key)}, token, val, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (s *RStore) Unlock(ctx context.Context, key string, token string) error {
+	return s.client.Eval(ctx, unlockLua, []string{s.key(key)}, token).Err()
+}
+
+func (s *RStore) key(key string) string {
+	return s.prefix + ":" + key
+}
+
+func NewRStore(client redis.Cmdable, opts ...RStoreOpt) *RStore {
+	s := &RStore{
+		client: client,
+		prefix: "idempotency",
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type RStoreOpt func(*RStore)
+
+// RStoreWithPrefix the prefix of the keys in redis.
+// defaults to "idempotency".
+func RStoreWithPrefix(prefix string) RStoreOpt {
+	return func(s *RStore) {
+		s.prefix = prefix
+	}
+}
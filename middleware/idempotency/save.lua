@@ -0,0 +1,11 @@
+local rec = redis.call("get", KEYS[1])
+if rec
+then
+    local lock = cjson.decode(rec)
+    if not lock.completed and lock.token == ARGV[1]
+    then
+        redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+        return 1
+    end
+end
+return 0
@@ -0,0 +1,10 @@
+local rec = redis.call("get", KEYS[1])
+if rec
+then
+    local lock = cjson.decode(rec)
+    if not lock.completed and lock.token == ARGV[1]
+    then
+        return redis.call("del", KEYS[1])
+    end
+end
+return 0
@@ -0,0 +1,65 @@
+package ipfilter
+
+import (
+	"net/http"
+	"net/netip"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MiddlewareBuilder rejects the clients not passing the List, e.g. to restrict a group of admin routes:
+//
+//	admin := svr.Group("/admin")
+//	admin.Use(ipfilter.NewMiddlewareBuilder(list).Build())
+//
+// The client ip is resolved by Context.ClientIP, so the proxies in front of the server must be trusted
+// by easyweb.ServerWithTrustedProxiesOpt. A client ip failing to be parsed is rejected unless the allow list is empty.
+type MiddlewareBuilder struct {
+	list       *List
+	statusCode int
+	errMsg     string
+}
+
+// WithStatusCode the code returns to the front end when rejected.
+// defaults to 403.
+func (b *MiddlewareBuilder) WithStatusCode(statusCode int) *MiddlewareBuilder {
+	b.statusCode = statusCode
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when rejected.
+// defaults to "Forbidden"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			if !b.allowed(ctx.ClientIP()) {
+				ctx.StatusCode = b.statusCode
+				ctx.Data = []byte(b.errMsg)
+				return
+			}
+
+			next(ctx)
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) allowed(clientIP string) bool {
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return len(b.list.rules.Load().allow) == 0
+	}
+	return b.list.Allowed(addr)
+}
+
+func NewMiddlewareBuilder(list *List) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		list:       list,
+		statusCode: http.StatusForbidden,
+		errMsg:     "Forbidden",
+	}
+}
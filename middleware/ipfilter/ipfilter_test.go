@@ -0,0 +1,151 @@
+package ipfilter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	list, err := NewList([]string{"203.0.113.0/24", "2001:db8::/32"}, []string{"203.0.113.13"})
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer(easyweb.ServerWithTrustedProxiesOpt("10.0.0.0/8"))
+	hdl := func(ctx *easyweb.Context) { _ = ctx.Ok() }
+	svr.Get("/public", hdl)
+
+	admin := svr.Group("/admin")
+	admin.Use(NewMiddlewareBuilder(list).Build())
+	admin.Get("/users", hdl)
+
+	tcs := []struct {
+		name         string
+		path         string
+		remoteAddr   string
+		forwardedFor string
+		wantCode     int
+	}{
+		{
+			name:       "allowed",
+			path:       "/admin/users",
+			remoteAddr: "203.0.113.1:1234",
+			wantCode:   http.StatusOK,
+		}, {
+			name:       "allowed ipv6",
+			path:       "/admin/users",
+			remoteAddr: "[2001:db8::1]:1234",
+			wantCode:   http.StatusOK,
+		}, {
+			name:       "denied",
+			path:       "/admin/users",
+			remoteAddr: "203.0.113.13:1234",
+			wantCode:   http.StatusForbidden,
+		}, {
+			name:       "not allowed",
+			path:       "/admin/users",
+			remoteAddr: "198.51.100.1:1234",
+			wantCode:   http.StatusForbidden,
+		}, {
+			name:         "behind trusted proxy",
+			path:         "/admin/users",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "203.0.113.1",
+			wantCode:     http.StatusOK,
+		}, {
+			name:         "proxy not trusted",
+			path:         "/admin/users",
+			remoteAddr:   "198.51.100.1:1234",
+			forwardedFor: "203.0.113.1",
+			wantCode:     http.StatusForbidden,
+		}, {
+			name:       "outside the group",
+			path:       "/public",
+			remoteAddr: "198.51.100.1:1234",
+			wantCode:   http.StatusOK,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode == http.StatusForbidden {
+				assert.Equal(t, "Forbidden", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	_, err := NewList([]string{"10.0.0.0/33"}, nil)
+	assert.Error(t, err)
+	_, err = NewList(nil, []string{"localhost"})
+	assert.Error(t, err)
+
+	// the zero value allows all
+	assert.True(t, (&List{}).Allowed(netip.MustParseAddr("10.0.0.1")))
+
+	// deny only
+	list, err := NewList(nil, []string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.True(t, list.Allowed(netip.MustParseAddr("192.0.2.1")))
+	assert.False(t, list.Allowed(netip.MustParseAddr("::ffff:10.0.0.1")))
+
+	// an invalid update keeps the lists
+	assert.Error(t, list.Set([]string{"192.0.2.0/24"}, []string{"bad"}))
+	assert.False(t, list.Allowed(netip.MustParseAddr("10.0.0.1")))
+	assert.True(t, list.Allowed(netip.MustParseAddr("198.51.100.1")))
+}
+
+func TestList_WatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ips.conf")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	write("# office\nallow 203.0.113.0/24\n\ndeny 203.0.113.13\n")
+	list, err := NewFileList(path)
+	require.NoError(t, err)
+	assert.True(t, list.Allowed(netip.MustParseAddr("203.0.113.1")))
+	assert.False(t, list.Allowed(netip.MustParseAddr("203.0.113.13")))
+	assert.False(t, list.Allowed(netip.MustParseAddr("198.51.100.1")))
+
+	errs := make(chan error, 10)
+	list.WatchFile(t.Context(), path, 10*time.Millisecond, func(err error) {
+		errs <- err
+	})
+
+	write("allow 198.51.100.0/24\n")
+	assert.Eventually(t, func() bool {
+		return list.Allowed(netip.MustParseAddr("198.51.100.1"))
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, list.Allowed(netip.MustParseAddr("203.0.113.1")))
+
+	// an invalid file keeps the lists
+	write("permit 192.0.2.0/24\n")
+	select {
+	case err = <-errs:
+		assert.ErrorContains(t, err, `invalid line 1`)
+	case <-time.After(time.Second):
+		t.Fatal("no reload error")
+	}
+	assert.True(t, list.Allowed(netip.MustParseAddr("198.51.100.1")))
+
+	_, err = NewFileList(filepath.Join(t.TempDir(), "absent.conf"))
+	assert.Error(t, err)
+}
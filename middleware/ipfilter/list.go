@@ -0,0 +1,177 @@
+package ipfilter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/JrMarcco/easy-web/internal/netprefix"
+)
+
+// List is the allow and deny lists of the CIDRs ( or single IPs, both IPv4 and IPv6 ),
+// which are able to be replaced at runtime while serving.
+//
+// A denied address is always rejected, an empty allow list allows all the addresses not denied.
+// The zero value has empty lists and allows all the addresses.
+type List struct {
+	rules atomic.Pointer[rules]
+}
+
+type rules struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// Allowed reports whether the address passes the lists.
+func (l *List) Allowed(addr netip.Addr) bool {
+	r := l.rules.Load()
+	if r == nil {
+		return true
+	}
+	addr = addr.Unmap().WithZone("")
+
+	if contains(r.deny, addr) {
+		return false
+	}
+	return len(r.allow) == 0 || contains(r.allow, addr)
+}
+
+// Set replaces the lists, the lists are left unchanged if any entry is invalid.
+func (l *List) Set(allow []string, deny []string) error {
+	r := &rules{}
+
+	var err error
+	if r.allow, err = parsePrefixes(allow); err != nil {
+		return err
+	}
+	if r.deny, err = parsePrefixes(deny); err != nil {
+		return err
+	}
+
+	l.rules.Store(r)
+	return nil
+}
+
+// LoadFile replaces the lists by the file, the lists are left unchanged if the file is invalid.
+//
+// Each line of the file is an "allow" or a "deny" followed by a CIDR or an IP,
+// the blank lines and the lines starting with "#" are ignored:
+//
+//	# office
+//	allow 203.0.113.0/24
+//	# vpn
+//	allow 2001:db8::/32
+//	deny 203.0.113.13
+func (l *List) LoadFile(path string) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("[ipfilter] load %s failed: %w", path, err)
+	}
+
+	var allow, deny []string
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action, entry, _ := strings.Cut(line, " ")
+		entry = strings.TrimSpace(entry)
+		switch {
+		case action == "allow" && entry != "":
+			allow = append(allow, entry)
+		case action == "deny" && entry != "":
+			deny = append(deny, entry)
+		default:
+			return fmt.Errorf("[ipfilter] invalid line %d of %s: %q", lineNo, path, line)
+		}
+	}
+
+	if err = l.Set(allow, deny); err != nil {
+		return fmt.Errorf("%w, in %s", err, path)
+	}
+	return nil
+}
+
+// WatchFile reloads the file by LoadFile when its modification time or size changes,
+// the file is checked every interval until the ctx is done.
+// The errors of the reloads are passed to the onErr, the last loaded lists are kept in this case.
+func (l *List) WatchFile(ctx context.Context, path string, interval time.Duration, onErr func(err error)) {
+	var lastMod time.Time
+	var lastSize int64 = -1
+	if fi, err := os.Stat(path); err == nil {
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				onErr(fmt.Errorf("[ipfilter] watch %s failed: %w", path, err))
+				continue
+			}
+			if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+				continue
+			}
+
+			lastMod, lastSize = fi.ModTime(), fi.Size()
+			if err = l.LoadFile(path); err != nil {
+				onErr(err)
+			}
+		}
+	}()
+}
+
+func NewList(allow []string, deny []string) (*List, error) {
+	l := &List{}
+	if err := l.Set(allow, deny); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewFileList loads the lists from the file, see LoadFile for the format.
+func NewFileList(path string) (*List, error) {
+	l := &List{}
+	if err := l.LoadFile(path); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		prefix, err := netprefix.Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("[ipfilter] invalid entry %s: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,214 @@
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Limiter = (*FixedLimiter)(nil)
+	_ Limiter = (*AdaptiveLimiter)(nil)
+)
+
+// Limiter limits the requests in flight.
+type Limiter interface {
+	// Acquire reserves a slot for a request, ok is false if the limit is reached.
+	// The release func must be called once when the request is done,
+	// with the latency and whether the request failed ( e.g. 5xx ).
+	Acquire() (release func(latency time.Duration, failed bool), ok bool)
+}
+
+// FixedLimiter limits the requests in flight to a fixed number.
+type FixedLimiter struct {
+	limit    int64
+	inflight atomic.Int64
+}
+
+func (l *FixedLimiter) Acquire() (func(time.Duration, bool), bool) {
+	if l.inflight.Add(1) > l.limit {
+		l.inflight.Add(-1)
+		return nil, false
+	}
+
+	var once sync.Once
+	return func(time.Duration, bool) {
+		once.Do(func() { l.inflight.Add(-1) })
+	}, true
+}
+
+// Inflight returns the number of the requests in flight.
+func (l *FixedLimiter) Inflight() int {
+	return int(l.inflight.Load())
+}
+
+func NewFixedLimiter(limit int) *FixedLimiter {
+	return &FixedLimiter{limit: int64(limit)}
+}
+
+// probeWindows is the number of windows after which the no-load latency is measured again,
+// so that the limiter adapts to a permanent change of the latency ( e.g. a slower dependency ).
+const probeWindows = 100
+
+// AdaptiveLimiter adjusts the limit by the observed latency, in the way of TCP Vegas:
+// the limit grows while the latency stays at the no-load latency ( the minimum observed ),
+// and shrinks by the ratio of the no-load latency to the latency once the requests queue up.
+// The limit shrinks by 10% in a window containing failed requests.
+type AdaptiveLimiter struct {
+	mu        sync.Mutex
+	limit     float64
+	minLimit  float64
+	maxLimit  float64
+	smoothing float64
+	window    time.Duration
+	inflight  int
+
+	windowStart time.Time
+	samples     int
+	sumLatency  time.Duration
+	failed      bool
+	maxInflight int
+	noLoad      time.Duration
+	windows     int
+
+	now func() time.Time
+}
+
+type AdaptiveOpt func(*AdaptiveLimiter)
+
+// AdaptiveWithInitialLimit the limit before any latency is observed.
+// defaults to 20.
+func AdaptiveWithInitialLimit(limit int) AdaptiveOpt {
+	return func(l *AdaptiveLimiter) {
+		l.limit = float64(limit)
+	}
+}
+
+// AdaptiveWithLimits the bounds of the limit.
+// defaults to 1 and 1000.
+func AdaptiveWithLimits(minLimit int, maxLimit int) AdaptiveOpt {
+	return func(l *AdaptiveLimiter) {
+		l.minLimit = float64(minLimit)
+		l.maxLimit = float64(maxLimit)
+	}
+}
+
+// AdaptiveWithWindow the interval between the adjustments of the limit.
+// defaults to 500ms.
+func AdaptiveWithWindow(window time.Duration) AdaptiveOpt {
+	return func(l *AdaptiveLimiter) {
+		l.window = window
+	}
+}
+
+// AdaptiveWithSmoothing the weight of a new limit between 0 and 1, the higher the faster the limit changes.
+// defaults to 0.2.
+func AdaptiveWithSmoothing(smoothing float64) AdaptiveOpt {
+	return func(l *AdaptiveLimiter) {
+		l.smoothing = smoothing
+	}
+}
+
+func (l *AdaptiveLimiter) Acquire() (func(time.Duration, bool), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= int(l.limit) {
+		return nil, false
+	}
+
+	l.inflight++
+	l.maxInflight = max(l.maxInflight, l.inflight)
+
+	var once sync.Once
+	return func(latency time.Duration, failed bool) {
+		once.Do(func() { l.release(latency, failed) })
+	}, true
+}
+
+func (l *AdaptiveLimiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.samples++
+	l.sumLatency += latency
+	l.failed = l.failed || failed
+
+	now := l.now()
+	if now.Sub(l.windowStart) < l.window {
+		return
+	}
+
+	l.adjust()
+
+	l.windowStart = now
+	l.samples = 0
+	l.sumLatency = 0
+	l.failed = false
+	l.maxInflight = l.inflight
+}
+
+func (l *AdaptiveLimiter) adjust() {
+	if l.failed {
+		// back off at once
+		l.limit = math.Max(l.minLimit, l.limit*0.9)
+		return
+	}
+
+	latency := l.sumLatency / time.Duration(l.samples)
+
+	l.windows++
+	if l.noLoad == 0 || latency < l.noLoad || l.windows >= probeWindows {
+		l.noLoad = latency
+		l.windows = 0
+	}
+
+	gradient := 1.0
+	if latency > 0 {
+		gradient = math.Max(0.5, math.Min(1, float64(l.noLoad)/float64(latency)))
+	}
+	// allow a queue of sqrt(limit) requests so that the limit is able to grow
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+
+	if float64(l.maxInflight) < l.limit/2 {
+		// the limit was not the bottleneck, there is no evidence to grow
+		newLimit = math.Min(newLimit, l.limit)
+	}
+
+	l.limit = l.limit*(1-l.smoothing) + newLimit*l.smoothing
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.limit))
+}
+
+// Limit returns the current limit.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Inflight returns the number of the requests in flight.
+func (l *AdaptiveLimiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+func NewAdaptiveLimiter(opts ...AdaptiveOpt) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{
+		limit:     20,
+		minLimit:  1,
+		maxLimit:  1000,
+		smoothing: 0.2,
+		window:    500 * time.Millisecond,
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	l.windowStart = l.now()
+	return l
+}
@@ -0,0 +1,120 @@
+package loadshed
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MetaKey is the route metadata key to limit a group's routes by their own limiter,
+// the value must be a Limiter shared by the routes of the group.
+const MetaKey = "loadshed"
+
+// MiddlewareBuilder sheds the requests beyond the limit of the requests in flight,
+// they are answered at once with 503 and Retry-After instead of piling up behind a degraded dependency.
+//
+// The limiter is looked up by the route ( see WithRouteLimiter ), the route metadata ( see MetaKey ),
+// and falls back to the global limiter.
+type MiddlewareBuilder struct {
+	limiter       Limiter
+	routeLimiters map[string]Limiter
+	failureFunc   func(ctx *easyweb.Context) bool
+	retryAfter    time.Duration
+	statusCode    int
+	errMsg        string
+}
+
+// WithRouteLimiter limits the route by its own limiter, the route is the registered pattern ( e.g. /order/:id ).
+func (b *MiddlewareBuilder) WithRouteLimiter(route string, limiter Limiter) *MiddlewareBuilder {
+	b.routeLimiters[route] = limiter
+	return b
+}
+
+// WithFailureFunc reports whether the request failed, the failures shrink the adaptive limit.
+// defaults to the 5xx responses.
+func (b *MiddlewareBuilder) WithFailureFunc(failureFunc func(ctx *easyweb.Context) bool) *MiddlewareBuilder {
+	b.failureFunc = failureFunc
+	return b
+}
+
+// WithRetryAfter the Retry-After returns to the front end when shed.
+// defaults to 1s.
+func (b *MiddlewareBuilder) WithRetryAfter(retryAfter time.Duration) *MiddlewareBuilder {
+	b.retryAfter = retryAfter
+	return b
+}
+
+// WithStatusCode the code returns to the front end when shed.
+// defaults to 503.
+func (b *MiddlewareBuilder) WithStatusCode(statusCode int) *MiddlewareBuilder {
+	b.statusCode = statusCode
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when shed.
+// defaults to "Service Unavailable"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			limiter := b.getLimiter(ctx)
+			if limiter == nil {
+				next(ctx)
+				return
+			}
+
+			release, ok := limiter.Acquire()
+			if !ok {
+				ctx.Resp.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(b.retryAfter.Seconds())), 10))
+				ctx.StatusCode = b.statusCode
+				ctx.Data = []byte(b.errMsg)
+				return
+			}
+
+			start := time.Now()
+			failed := true
+			// a panic is a failure and must not leak the slot
+			defer func() {
+				release(time.Since(start), failed)
+			}()
+
+			next(ctx)
+			failed = b.failureFunc(ctx)
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) getLimiter(ctx *easyweb.Context) Limiter {
+	if limiter, ok := b.routeLimiters[ctx.MatchedRoute]; ok && ctx.MatchedRoute != "" {
+		return limiter
+	}
+
+	if val, ok := ctx.RouteMeta(MetaKey); ok {
+		if limiter, ok := val.(Limiter); ok {
+			return limiter
+		}
+	}
+
+	return b.limiter
+}
+
+// NewMiddlewareBuilder sheds by the global limiter, which is nil to limit only the routes configured.
+func NewMiddlewareBuilder(limiter Limiter) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limiter:       limiter,
+		routeLimiters: make(map[string]Limiter),
+		failureFunc: func(ctx *easyweb.Context) bool {
+			return ctx.StatusCode >= http.StatusInternalServerError
+		},
+		retryAfter: time.Second,
+		statusCode: http.StatusServiceUnavailable,
+		errMsg:     "Service Unavailable",
+	}
+}
@@ -0,0 +1,160 @@
+package loadshed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	entered := make(chan struct{})
+	block := make(chan struct{})
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(NewFixedLimiter(1)).WithRetryAfter(1500 * time.Millisecond).Build())
+	svr.Get("/slow", func(ctx *easyweb.Context) {
+		entered <- struct{}{}
+		<-block
+		_ = ctx.Ok()
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}()
+	<-entered
+
+	// saturated
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, "Service Unavailable", recorder.Body.String())
+
+	close(block)
+	wg.Wait()
+
+	// the slot is released
+	go func() { <-entered }()
+	recorder = httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestMiddlewareBuilder_Build_limiters(t *testing.T) {
+	global, route, group := NewFixedLimiter(0), NewFixedLimiter(0), NewFixedLimiter(0)
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(global).WithRouteLimiter("/route", route).Build())
+
+	hdl := func(ctx *easyweb.Context) { _ = ctx.Ok() }
+	svr.Get("/global", hdl)
+	svr.Get("/route", hdl)
+	svr.Group("/group").WithMeta(MetaKey, group).Get("/x", hdl)
+
+	for target, limiter := range map[string]*FixedLimiter{
+		"/global":  global,
+		"/route":   route,
+		"/group/x": group,
+	} {
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code, target)
+
+		// the limit is raised, only the limiter of the route lets the request through
+		limiter.limit = 1
+		recorder = httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, target)
+		limiter.limit = 0
+	}
+}
+
+func TestMiddlewareBuilder_Build_panic(t *testing.T) {
+	limiter := NewFixedLimiter(1)
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder(limiter).Build())
+	svr.Get("/panic", func(ctx *easyweb.Context) { panic("boom") })
+
+	assert.Panics(t, func() {
+		svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+	assert.Equal(t, 0, limiter.Inflight())
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewAdaptiveLimiter(AdaptiveWithInitialLimit(10), AdaptiveWithLimits(2, 50))
+	l.now = func() time.Time { return now }
+	l.windowStart = now
+
+	// runs a window of n concurrent requests of the latency
+	window := func(n int, latency time.Duration, failed bool) {
+		releases := make([]func(time.Duration, bool), 0, n)
+		for range n {
+			release, ok := l.Acquire()
+			if !ok {
+				break
+			}
+			releases = append(releases, release)
+		}
+
+		now = now.Add(l.window)
+		for _, release := range releases {
+			release(latency, failed)
+		}
+	}
+
+	// saturated at the no-load latency, the limit grows
+	for range 10 {
+		window(l.Limit(), 10*time.Millisecond, false)
+	}
+	grown := l.Limit()
+	assert.Greater(t, grown, 10)
+
+	// the requests queue up, the limit shrinks
+	for range 10 {
+		window(l.Limit(), 40*time.Millisecond, false)
+	}
+	shrunk := l.Limit()
+	assert.Less(t, shrunk, grown)
+
+	// few requests are no evidence to grow
+	window(1, 10*time.Millisecond, false)
+	stable := l.Limit()
+	for range 10 {
+		window(1, 10*time.Millisecond, false)
+	}
+	assert.Equal(t, stable, l.Limit())
+
+	// the failures shrink the limit until the min limit
+	for range 50 {
+		window(l.Limit(), 10*time.Millisecond, true)
+	}
+	assert.Equal(t, 2, l.Limit())
+
+	// the limit is enforced
+	release, ok := l.Acquire()
+	require.True(t, ok)
+	_, ok = l.Acquire()
+	require.True(t, ok)
+	_, ok = l.Acquire()
+	assert.False(t, ok)
+	assert.Equal(t, 2, l.Inflight())
+
+	// releasing twice is a no-op
+	release(time.Millisecond, false)
+	release(time.Millisecond, false)
+	assert.Equal(t, 1, l.Inflight())
+}
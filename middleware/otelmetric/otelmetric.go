@@ -0,0 +1,174 @@
+package otelmetric
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/internal/httpmethod"
+	"github.com/JrMarcco/easy-web/internal/respwriter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const defaultInstrumentationName = "github.com/JrMarcco/easy-web/middleware/otelmetric"
+
+// defaultBuckets are the boundaries of the duration histogram advised by the semantic conventions.
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// MiddlewareBuilder records the OpenTelemetry HTTP server metrics, the companion of the trace middleware:
+//   - http.server.request.duration, histogram in seconds
+//   - http.server.active_requests, up down counter by method and scheme
+//   - http.server.request.body.size, histogram in bytes, as declared by Content-Length
+//   - http.server.response.body.size, histogram in bytes
+//
+// The http.route attribute is the registered pattern ( e.g. /order/:id ), absent if no route matches.
+type MiddlewareBuilder struct {
+	meter   metric.Meter
+	buckets []float64
+}
+
+// WithMeterProvider creates the meter by the provider.
+// defaults to the global meter provider.
+func (b *MiddlewareBuilder) WithMeterProvider(provider metric.MeterProvider) *MiddlewareBuilder {
+	b.meter = provider.Meter(defaultInstrumentationName)
+	return b
+}
+
+// WithBuckets the boundaries of the duration histogram in seconds.
+// defaults to the boundaries advised by the semantic conventions.
+func (b *MiddlewareBuilder) WithBuckets(buckets []float64) *MiddlewareBuilder {
+	b.buckets = buckets
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	meter := b.meter
+	if meter == nil {
+		meter = otel.GetMeterProvider().Meter(defaultInstrumentationName)
+	}
+
+	m, err := newMetrics(meter, b.buckets)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			start := time.Now()
+			method, scheme := methodAttrs(ctx.Req), schemeAttr(ctx)
+
+			active := metric.WithAttributes(append(method, scheme)...)
+			m.active.Add(ctx.TraceCtx, 1, active)
+			defer m.active.Add(ctx.TraceCtx, -1, active)
+
+			resp := ctx.Resp
+			cw := &respwriter.Counting{ResponseWriter: resp}
+			ctx.Resp = cw
+
+			next(ctx)
+			ctx.Resp = resp
+
+			status := ctx.StatusCode
+			if status == 0 {
+				status = cw.Code
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			attrs := append(method,
+				scheme,
+				semconv.HTTPResponseStatusCode(status),
+				semconv.NetworkProtocolVersion(fmt.Sprintf("%d.%d", ctx.Req.ProtoMajor, ctx.Req.ProtoMinor)),
+			)
+			if ctx.MatchedRoute != "" {
+				attrs = append(attrs, semconv.HTTPRoute(ctx.MatchedRoute))
+			}
+			if status >= http.StatusInternalServerError {
+				attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+			}
+			opt := metric.WithAttributes(attrs...)
+
+			// the trace context carries the span, so the exemplars are able to refer to the trace
+			m.duration.Record(ctx.TraceCtx, time.Since(start).Seconds(), opt)
+			m.reqSize.Record(ctx.TraceCtx, max(ctx.Req.ContentLength, 0), opt)
+			m.respSize.Record(ctx.TraceCtx, cw.Written+int64(len(ctx.Data)), opt)
+		}
+	}
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		buckets: defaultBuckets,
+	}
+}
+
+type metrics struct {
+	duration metric.Float64Histogram
+	active   metric.Int64UpDownCounter
+	reqSize  metric.Int64Histogram
+	respSize metric.Int64Histogram
+}
+
+func newMetrics(meter metric.Meter, buckets []float64) (*metrics, error) {
+	duration, err := meter.Float64Histogram(
+		semconv.HTTPServerRequestDurationName,
+		metric.WithUnit(semconv.HTTPServerRequestDurationUnit),
+		metric.WithDescription(semconv.HTTPServerRequestDurationDescription),
+		metric.WithExplicitBucketBoundaries(buckets...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[otelmetric] failed to create duration histogram: %w", err)
+	}
+
+	active, err := meter.Int64UpDownCounter(
+		semconv.HTTPServerActiveRequestsName,
+		metric.WithUnit(semconv.HTTPServerActiveRequestsUnit),
+		metric.WithDescription(semconv.HTTPServerActiveRequestsDescription),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[otelmetric] failed to create active requests counter: %w", err)
+	}
+
+	reqSize, err := meter.Int64Histogram(
+		semconv.HTTPServerRequestBodySizeName,
+		metric.WithUnit(semconv.HTTPServerRequestBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerRequestBodySizeDescription),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[otelmetric] failed to create request size histogram: %w", err)
+	}
+
+	respSize, err := meter.Int64Histogram(
+		semconv.HTTPServerResponseBodySizeName,
+		metric.WithUnit(semconv.HTTPServerResponseBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerResponseBodySizeDescription),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[otelmetric] failed to create response size histogram: %w", err)
+	}
+
+	return &metrics{
+		duration: duration,
+		active:   active,
+		reqSize:  reqSize,
+		respSize: respSize,
+	}, nil
+}
+
+// methodAttrs returns http.request.method, the unknown methods are reported as _OTHER to bound the cardinality.
+func methodAttrs(req *http.Request) []attribute.KeyValue {
+	if httpmethod.Known(req.Method) {
+		return []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(req.Method)}
+	}
+	return []attribute.KeyValue{semconv.HTTPRequestMethodOther}
+}
+
+func schemeAttr(ctx *easyweb.Context) attribute.KeyValue {
+	return semconv.URLScheme(ctx.Scheme())
+}
@@ -0,0 +1,146 @@
+package otelmetric
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(t.Context(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	assert.Equal(t, defaultInstrumentationName, rm.ScopeMetrics[0].Scope.Name)
+
+	metrics := make(map[string]metricdata.Metrics, len(rm.ScopeMetrics[0].Metrics))
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	return metrics
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().WithMeterProvider(provider).Build())
+	svr.Post("/order/:id", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusCreated, []byte("created"))
+	})
+	svr.Get("/error", func(ctx *easyweb.Context) {
+		ctx.Resp.WriteHeader(http.StatusBadGateway)
+	})
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/order/1", strings.NewReader("hello")))
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/order/2", strings.NewReader("hello")))
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/error", nil))
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/missing", nil))
+
+	metrics := collect(t, reader)
+
+	created := attribute.NewSet(
+		semconv.HTTPRequestMethodKey.String(http.MethodPost),
+		semconv.URLScheme("http"),
+		semconv.HTTPResponseStatusCode(http.StatusCreated),
+		semconv.NetworkProtocolVersion("1.1"),
+		semconv.HTTPRoute("/order/:id"),
+	)
+	badGateway := attribute.NewSet(
+		semconv.HTTPRequestMethodKey.String(http.MethodGet),
+		semconv.URLScheme("http"),
+		semconv.HTTPResponseStatusCode(http.StatusBadGateway),
+		semconv.NetworkProtocolVersion("1.1"),
+		semconv.HTTPRoute("/error"),
+		semconv.ErrorTypeKey.String("502"),
+	)
+	notFound := attribute.NewSet(
+		semconv.HTTPRequestMethodOther,
+		semconv.URLScheme("http"),
+		semconv.HTTPResponseStatusCode(http.StatusNotFound),
+		semconv.NetworkProtocolVersion("1.1"),
+	)
+
+	duration, ok := metrics[semconv.HTTPServerRequestDurationName].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Equal(t, "s", metrics[semconv.HTTPServerRequestDurationName].Unit)
+
+	counts := make(map[attribute.Distinct]uint64, len(duration.DataPoints))
+	for _, dp := range duration.DataPoints {
+		counts[dp.Attributes.Equivalent()] = dp.Count
+		assert.Equal(t, defaultBuckets, dp.Bounds)
+	}
+	assert.Equal(t, map[attribute.Distinct]uint64{
+		created.Equivalent():    2,
+		badGateway.Equivalent(): 1,
+		notFound.Equivalent():   1,
+	}, counts)
+
+	metricdatatest.AssertEqual(t, metricdata.Metrics{
+		Name:        semconv.HTTPServerResponseBodySizeName,
+		Description: semconv.HTTPServerResponseBodySizeDescription,
+		Unit:        semconv.HTTPServerResponseBodySizeUnit,
+		Data: metricdata.Histogram[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			DataPoints: []metricdata.HistogramDataPoint[int64]{
+				{Attributes: created, Count: 2, Sum: int64(2 * len("created"))},
+				{Attributes: badGateway, Count: 1, Sum: 0},
+				{Attributes: notFound, Count: 1, Sum: int64(len("Not Found"))},
+			},
+		},
+	}, metrics[semconv.HTTPServerResponseBodySizeName],
+		metricdatatest.IgnoreTimestamp(), metricdatatest.IgnoreValue())
+
+	reqSize, ok := metrics[semconv.HTTPServerRequestBodySizeName].Data.(metricdata.Histogram[int64])
+	require.True(t, ok)
+	for _, dp := range reqSize.DataPoints {
+		if dp.Attributes.Equivalent() == created.Equivalent() {
+			assert.Equal(t, int64(2*len("hello")), dp.Sum)
+		}
+	}
+
+	// the active requests are back to zero
+	metricdatatest.AssertEqual(t, metricdata.Metrics{
+		Name:        semconv.HTTPServerActiveRequestsName,
+		Description: semconv.HTTPServerActiveRequestsDescription,
+		Unit:        semconv.HTTPServerActiveRequestsUnit,
+		Data: metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{Attributes: attribute.NewSet(semconv.HTTPRequestMethodKey.String(http.MethodPost), semconv.URLScheme("http"))},
+				{Attributes: attribute.NewSet(semconv.HTTPRequestMethodKey.String(http.MethodGet), semconv.URLScheme("http"))},
+				{Attributes: attribute.NewSet(semconv.HTTPRequestMethodOther, semconv.URLScheme("http"))},
+			},
+		},
+	}, metrics[semconv.HTTPServerActiveRequestsName], metricdatatest.IgnoreTimestamp())
+}
+
+func TestMiddlewareBuilder_Build_active(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	var active int64
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().WithMeterProvider(provider).Build())
+	svr.Get("/", func(ctx *easyweb.Context) {
+		sum, ok := collect(t, reader)[semconv.HTTPServerActiveRequestsName].Data.(metricdata.Sum[int64])
+		require.True(t, ok)
+		require.Len(t, sum.DataPoints, 1)
+		active = sum.DataPoints[0].Value
+	})
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, int64(1), active)
+}
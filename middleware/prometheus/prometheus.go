@@ -1,69 +1,242 @@
 package prometheus
 
 import (
+	"errors"
+	"net/http"
 	"strconv"
 	"time"
 
 	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/internal/httpmethod"
+	"github.com/JrMarcco/easy-web/internal/respwriter"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// unmatchedRoute is the route label of the requests matching no route,
+// the path is never used as a label to bound the cardinality.
+const unmatchedRoute = "unmatched"
+
+// MiddlewareBuilder records the metrics of the requests:
+//   - http_requests_total, counter by method, route and status
+//   - http_request_duration_seconds, histogram by method, route and status
+//   - http_requests_in_flight, gauge
+//   - http_request_size_bytes, histogram by method and route, as declared by Content-Length
+//   - http_response_size_bytes, histogram by method, route and status
+//
+// The route label is the registered pattern ( e.g. /order/:id ).
+// The metrics are registered to a registry of the builder unless WithRegisterer is used, see Handler.
 type MiddlewareBuilder struct {
-	vec *prometheus.SummaryVec
+	registerer  prometheus.Registerer
+	gatherer    prometheus.Gatherer
+	namespace   string
+	subsystem   string
+	constLabels prometheus.Labels
+	buckets     []float64
+	sizeBuckets []float64
+	vec         *prometheus.SummaryVec
+}
+
+// WithRegisterer registers the metrics to the registerer, e.g. prometheus.DefaultRegisterer.
+// Handler exposes the registerer if it is a prometheus.Gatherer ( e.g. *prometheus.Registry ),
+// prometheus.DefaultGatherer otherwise.
+func (b *MiddlewareBuilder) WithRegisterer(registerer prometheus.Registerer) *MiddlewareBuilder {
+	b.registerer = registerer
+	if gatherer, ok := registerer.(prometheus.Gatherer); ok {
+		b.gatherer = gatherer
+	} else {
+		b.gatherer = prometheus.DefaultGatherer
+	}
+	return b
+}
+
+// WithNamespace the namespace of the metric names, e.g. "easy_web" for easy_web_http_requests_total.
+func (b *MiddlewareBuilder) WithNamespace(namespace string) *MiddlewareBuilder {
+	b.namespace = namespace
+	return b
+}
+
+// WithSubsystem the subsystem of the metric names, between the namespace and the name.
+func (b *MiddlewareBuilder) WithSubsystem(subsystem string) *MiddlewareBuilder {
+	b.subsystem = subsystem
+	return b
+}
+
+// WithConstLabels the labels added to all the metrics, e.g. the service name.
+func (b *MiddlewareBuilder) WithConstLabels(labels prometheus.Labels) *MiddlewareBuilder {
+	b.constLabels = labels
+	return b
+}
+
+// WithBuckets the buckets of the duration histogram in seconds.
+// defaults to prometheus.DefBuckets.
+func (b *MiddlewareBuilder) WithBuckets(buckets []float64) *MiddlewareBuilder {
+	b.buckets = buckets
+	return b
+}
+
+// WithSizeBuckets the buckets of the size histograms in bytes.
+// defaults to 100B to 100MB, by a factor of 10.
+func (b *MiddlewareBuilder) WithSizeBuckets(buckets []float64) *MiddlewareBuilder {
+	b.sizeBuckets = buckets
+	return b
 }
 
+// WithSummaryVec additionally observes the duration in microseconds by method, path and status_code,
+// the vec is registered to the registerer like the other metrics.
 func (b *MiddlewareBuilder) WithSummaryVec(vec *prometheus.SummaryVec) *MiddlewareBuilder {
 	b.vec = vec
 	return b
 }
 
 func (b *MiddlewareBuilder) Build() easyweb.Middleware {
-	if b.vec == nil {
-		b.vec = prometheus.NewSummaryVec(
-			prometheus.SummaryOpts{
-				Name:        "easy_web",
-				Subsystem:   "http_request_duration",
-				ConstLabels: map[string]string{},
-				Objectives: map[float64]float64{
-					0.5:   0.01,
-					0.75:  0.01,
-					0.90:  0.005,
-					0.98:  0.002,
-					0.99:  0.001,
-					0.999: 0.0001,
-				},
-				Help: "Duration of HTTP requests in microseconds.",
-			},
-			[]string{"method", "path", "status_code"},
-		)
-	}
-
-	prometheus.MustRegister(b.vec)
+	m := b.newMetrics()
 
 	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
 		return func(ctx *easyweb.Context) {
 			start := time.Now()
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+
+			resp := ctx.Resp
+			cw := &respwriter.Counting{ResponseWriter: resp}
+			ctx.Resp = cw
+
 			next(ctx)
-			end := time.Now()
+			ctx.Resp = resp
 
-			go b.report(ctx, end.Sub(start))
+			// observe in the serving goroutine, the context is reused after the request
+			b.observe(m, ctx, cw, time.Since(start))
 		}
 	}
 }
 
-func (b *MiddlewareBuilder) report(ctx *easyweb.Context, duration time.Duration) {
-	path := "unknown"
-	if ctx.MatchedRoute != "" {
-		path = ctx.MatchedRoute
+func (b *MiddlewareBuilder) observe(m *metrics, ctx *easyweb.Context, cw *respwriter.Counting, duration time.Duration) {
+	route := ctx.MatchedRoute
+	if route == "" {
+		route = unmatchedRoute
 	}
 
-	b.vec.WithLabelValues(
-		ctx.Req.Method,
-		path,
-		strconv.Itoa(ctx.StatusCode),
-	).Observe(float64(duration.Microseconds()))
+	status := ctx.StatusCode
+	if status == 0 {
+		status = cw.Code
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	code := strconv.Itoa(status)
+	// the unknown methods are reported as _OTHER to bound the cardinality
+	method := httpmethod.Normalize(ctx.Req.Method)
+
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.duration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+	m.respSize.WithLabelValues(method, route, code).Observe(float64(cw.Written + int64(len(ctx.Data))))
+	m.reqSize.WithLabelValues(method, route).Observe(float64(max(ctx.Req.ContentLength, 0)))
+
+	if m.summary != nil {
+		m.summary.WithLabelValues(method, route, code).Observe(float64(duration.Microseconds()))
+	}
+}
+
+// Handler exposes the metrics, e.g.
+//
+//	svr.Get("/metrics", b.Handler())
+func (b *MiddlewareBuilder) Handler() easyweb.HandleFunc {
+	h := promhttp.InstrumentMetricHandler(b.registerer, promhttp.HandlerFor(b.gatherer, promhttp.HandlerOpts{
+		Registry: b.registerer,
+	}))
+
+	return func(ctx *easyweb.Context) {
+		h.ServeHTTP(ctx.Resp, ctx.Req)
+	}
+}
+
+type metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+	reqSize  *prometheus.HistogramVec
+	respSize *prometheus.HistogramVec
+	summary  *prometheus.SummaryVec
+}
+
+// newMetrics registers the metrics, the registered ones are reused so that building twice does not panic.
+func (b *MiddlewareBuilder) newMetrics() *metrics {
+	labels := []string{"method", "route", "status"}
+
+	m := &metrics{
+		requests: register(b.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   b.namespace,
+			Subsystem:   b.subsystem,
+			Name:        "http_requests_total",
+			Help:        "Total number of HTTP requests.",
+			ConstLabels: b.constLabels,
+		}, labels)),
+		duration: register(b.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   b.namespace,
+			Subsystem:   b.subsystem,
+			Name:        "http_request_duration_seconds",
+			Help:        "Duration of HTTP requests in seconds.",
+			ConstLabels: b.constLabels,
+			Buckets:     b.buckets,
+		}, labels)),
+		inFlight: register(b.registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   b.namespace,
+			Subsystem:   b.subsystem,
+			Name:        "http_requests_in_flight",
+			Help:        "Number of HTTP requests being served.",
+			ConstLabels: b.constLabels,
+		})),
+		reqSize: register(b.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   b.namespace,
+			Subsystem:   b.subsystem,
+			Name:        "http_request_size_bytes",
+			Help:        "Size of HTTP request bodies in bytes.",
+			ConstLabels: b.constLabels,
+			Buckets:     b.sizeBuckets,
+		}, []string{"method", "route"})),
+		respSize: register(b.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   b.namespace,
+			Subsystem:   b.subsystem,
+			Name:        "http_response_size_bytes",
+			Help:        "Size of HTTP response bodies in bytes.",
+			ConstLabels: b.constLabels,
+			Buckets:     b.sizeBuckets,
+		}, labels)),
+	}
+
+	if b.vec != nil {
+		m.summary = register(b.registerer, b.vec)
+	}
+	return m
+}
+
+// register registers the collector, or returns the registered one if an equal collector exists.
+func register[T prometheus.Collector](registerer prometheus.Registerer, c T) T {
+	if err := registerer.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
 }
 
 func NewMiddlewareBuilder() *MiddlewareBuilder {
-	return &MiddlewareBuilder{}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return &MiddlewareBuilder{
+		registerer:  registry,
+		gatherer:    registry,
+		buckets:     prometheus.DefBuckets,
+		sizeBuckets: prometheus.ExponentialBuckets(100, 10, 7),
+	}
 }
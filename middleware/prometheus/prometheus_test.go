@@ -0,0 +1,128 @@
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	b := NewMiddlewareBuilder().
+		WithRegisterer(registry).
+		WithNamespace("easy_web").
+		WithConstLabels(prometheus.Labels{"service": "order"}).
+		WithBuckets([]float64{0.1, 1}).
+		WithSizeBuckets([]float64{10, 100})
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(b.Build())
+	svr.Post("/order/:id", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusCreated, []byte("created"))
+	})
+	svr.Get("/stream", func(ctx *easyweb.Context) {
+		_, _ = ctx.Resp.Write([]byte(strings.Repeat("a", 50)))
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/order/1", strings.NewReader("hello")),
+		httptest.NewRequest(http.MethodPost, "/order/2", strings.NewReader("hello")),
+		httptest.NewRequest(http.MethodGet, "/stream", nil),
+		httptest.NewRequest(http.MethodGet, "/missing/1", nil),
+		httptest.NewRequest(http.MethodGet, "/missing/2", nil),
+		// the unknown methods share a series
+		httptest.NewRequest("PROPFIND", "/missing/3", nil),
+		httptest.NewRequest("BREW", "/missing/4", nil),
+	} {
+		svr.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// building again on the same registry reuses the metrics instead of panicking
+	require.NotPanics(t, func() { b.Build() })
+
+	err := testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP easy_web_http_requests_total Total number of HTTP requests.
+# TYPE easy_web_http_requests_total counter
+easy_web_http_requests_total{method="GET",route="/stream",service="order",status="200"} 1
+easy_web_http_requests_total{method="GET",route="unmatched",service="order",status="404"} 2
+easy_web_http_requests_total{method="POST",route="/order/:id",service="order",status="201"} 2
+easy_web_http_requests_total{method="_OTHER",route="unmatched",service="order",status="404"} 2
+# HELP easy_web_http_requests_in_flight Number of HTTP requests being served.
+# TYPE easy_web_http_requests_in_flight gauge
+easy_web_http_requests_in_flight{service="order"} 0
+# HELP easy_web_http_response_size_bytes Size of HTTP response bodies in bytes.
+# TYPE easy_web_http_response_size_bytes histogram
+easy_web_http_response_size_bytes_bucket{method="GET",route="/stream",service="order",status="200",le="10"} 0
+easy_web_http_response_size_bytes_bucket{method="GET",route="/stream",service="order",status="200",le="100"} 1
+easy_web_http_response_size_bytes_bucket{method="GET",route="/stream",service="order",status="200",le="+Inf"} 1
+easy_web_http_response_size_bytes_sum{method="GET",route="/stream",service="order",status="200"} 50
+easy_web_http_response_size_bytes_count{method="GET",route="/stream",service="order",status="200"} 1
+easy_web_http_response_size_bytes_bucket{method="GET",route="unmatched",service="order",status="404",le="10"} 2
+easy_web_http_response_size_bytes_bucket{method="GET",route="unmatched",service="order",status="404",le="100"} 2
+easy_web_http_response_size_bytes_bucket{method="GET",route="unmatched",service="order",status="404",le="+Inf"} 2
+easy_web_http_response_size_bytes_sum{method="GET",route="unmatched",service="order",status="404"} 18
+easy_web_http_response_size_bytes_count{method="GET",route="unmatched",service="order",status="404"} 2
+easy_web_http_response_size_bytes_bucket{method="POST",route="/order/:id",service="order",status="201",le="10"} 2
+easy_web_http_response_size_bytes_bucket{method="POST",route="/order/:id",service="order",status="201",le="100"} 2
+easy_web_http_response_size_bytes_bucket{method="POST",route="/order/:id",service="order",status="201",le="+Inf"} 2
+easy_web_http_response_size_bytes_sum{method="POST",route="/order/:id",service="order",status="201"} 14
+easy_web_http_response_size_bytes_count{method="POST",route="/order/:id",service="order",status="201"} 2
+easy_web_http_response_size_bytes_bucket{method="_OTHER",route="unmatched",service="order",status="404",le="10"} 2
+easy_web_http_response_size_bytes_bucket{method="_OTHER",route="unmatched",service="order",status="404",le="100"} 2
+easy_web_http_response_size_bytes_bucket{method="_OTHER",route="unmatched",service="order",status="404",le="+Inf"} 2
+easy_web_http_response_size_bytes_sum{method="_OTHER",route="unmatched",service="order",status="404"} 18
+easy_web_http_response_size_bytes_count{method="_OTHER",route="unmatched",service="order",status="404"} 2
+`), "easy_web_http_requests_total", "easy_web_http_requests_in_flight", "easy_web_http_response_size_bytes")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, testutil.CollectAndCount(registry, "easy_web_http_request_duration_seconds"))
+	assert.Equal(t, 4, testutil.CollectAndCount(registry, "easy_web_http_request_size_bytes"))
+}
+
+func TestMiddlewareBuilder_Handler(t *testing.T) {
+	b := NewMiddlewareBuilder()
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(b.Build())
+	svr.Get("/metrics", b.Handler())
+	svr.Get("/user", func(ctx *easyweb.Context) { _ = ctx.Ok() })
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user", nil))
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/user",status="200"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+
+	// builders do not share the metrics unless they share the registerer
+	assert.NotPanics(t, func() { NewMiddlewareBuilder().Build() })
+}
+
+func TestMiddlewareBuilder_WithSummaryVec(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	vec := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "http_request_duration_microseconds",
+		Help: "Duration of HTTP requests in microseconds.",
+	}, []string{"method", "path", "status_code"})
+
+	b := NewMiddlewareBuilder().WithRegisterer(registry).WithSummaryVec(vec)
+	svr := easyweb.NewHttpServer()
+	svr.Use(b.Build())
+	svr.Get("/user", func(ctx *easyweb.Context) { _ = ctx.Ok() })
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, 1, testutil.CollectAndCount(registry, "http_request_duration_microseconds"))
+
+	// building again reuses the registered vec
+	assert.NotPanics(t, func() { b.Build() })
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucketResult builds the result from the tokens left after the request is counted ( if allowed ).
+// rate is the tokens refilled per nanosecond.
+func tokenBucketResult(allowed bool, burst int, rate float64, tokens float64) Result {
+	res := Result{
+		Allowed:    allowed,
+		Limit:      burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration(math.Ceil((float64(burst) - tokens) / rate)),
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration(math.Ceil((1 - tokens) / rate))
+	}
+	return res
+}
+
+// refill returns the tokens in the bucket after elapsed.
+func refill(burst int, rate float64, tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(burst), tokens+float64(elapsed)*rate)
+}
+
+// estimate is the weighted count of the requests in the last window,
+// the previous window is weighted by how much of it overlaps the last window.
+func estimate(window time.Duration, elapsed time.Duration, curr int, prev int) float64 {
+	return float64(prev)*float64(window-elapsed)/float64(window) + float64(curr)
+}
+
+// slidingWindowResult builds the result from the counters after the request is counted ( if allowed ).
+func slidingWindowResult(allowed bool, limit int, window time.Duration, elapsed time.Duration, curr int, prev int) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: max(limit-int(math.Ceil(estimate(window, elapsed, curr, prev))), 0),
+	}
+
+	switch {
+	case curr > 0:
+		// the current window is weighted until the end of the next window
+		res.ResetAfter = 2*window - elapsed
+	case prev > 0:
+		res.ResetAfter = window - elapsed
+	}
+
+	if !allowed {
+		res.RetryAfter = slidingWindowRetryAfter(limit, window, elapsed, curr, prev)
+	}
+	return res
+}
+
+func slidingWindowRetryAfter(limit int, window time.Duration, elapsed time.Duration, curr int, prev int) time.Duration {
+	w := float64(window)
+	if curr < limit && prev > 0 {
+		// wait in the current window until the previous window weighs little enough
+		t := w - float64(elapsed) - float64(limit-1-curr)*w/float64(prev)
+		return time.Duration(math.Ceil(math.Max(t, 0)))
+	}
+
+	// wait for the next window, where the current window becomes the previous one
+	t := float64(window-elapsed) + math.Max(w*(1-float64(limit-1)/float64(curr)), 0)
+	return time.Duration(math.Ceil(t))
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+var (
+	_ Limiter = (*MemTokenBucketLimiter)(nil)
+	_ Limiter = (*MemSlidingWindowLimiter)(nil)
+)
+
+// MemTokenBucketLimiter memory implementation for token bucket algorithm.
+// Each key owns a bucket of burst tokens refilled at rate tokens per interval,
+// a request takes a token.
+type MemTokenBucketLimiter struct {
+	mu    sync.Mutex
+	c     *cache.Cache
+	burst int
+	rate  float64
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *MemTokenBucketLimiter) Allow(_ context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	tokens := float64(l.burst)
+	if val, ok := l.c.Get(key); ok {
+		b := val.(*bucket)
+		tokens = refill(l.burst, l.rate, b.tokens, now.Sub(b.last))
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	res := tokenBucketResult(allowed, l.burst, l.rate, tokens)
+	// a bucket expires when it is full again, which is the same as a new one
+	l.c.Set(key, &bucket{tokens: tokens, last: now}, res.ResetAfter+time.Millisecond)
+	return res, nil
+}
+
+func NewMemTokenBucketLimiter(rate int, interval time.Duration, burst int) *MemTokenBucketLimiter {
+	return &MemTokenBucketLimiter{
+		c:     cache.New(cache.NoExpiration, time.Minute),
+		burst: burst,
+		rate:  float64(rate) / float64(interval),
+	}
+}
+
+// MemSlidingWindowLimiter memory implementation for sliding window algorithm.
+// Each key is allowed limit requests in any window, the requests of the previous fixed window
+// are weighted by how much of it overlaps the sliding window.
+type MemSlidingWindowLimiter struct {
+	mu     sync.Mutex
+	c      *cache.Cache
+	limit  int
+	window time.Duration
+}
+
+type counter struct {
+	idx  int64
+	curr int
+	prev int
+}
+
+func (l *MemSlidingWindowLimiter) Allow(_ context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	idx := now / int64(l.window)
+	elapsed := time.Duration(now - idx*int64(l.window))
+
+	cnt := &counter{idx: idx}
+	if val, ok := l.c.Get(key); ok {
+		cnt = val.(*counter)
+		switch cnt.idx {
+		case idx:
+		case idx - 1:
+			cnt.idx, cnt.prev, cnt.curr = idx, cnt.curr, 0
+		default:
+			cnt.idx, cnt.prev, cnt.curr = idx, 0, 0
+		}
+	}
+
+	allowed := estimate(l.window, elapsed, cnt.curr, cnt.prev)+1 <= float64(l.limit)
+	if allowed {
+		cnt.curr++
+	}
+
+	l.c.Set(key, cnt, 2*l.window-elapsed)
+	return slidingWindowResult(allowed, l.limit, l.window, elapsed, cnt.curr, cnt.prev), nil
+}
+
+func NewMemSlidingWindowLimiter(limit int, window time.Duration) *MemSlidingWindowLimiter {
+	return &MemSlidingWindowLimiter{
+		c:      cache.New(cache.NoExpiration, time.Minute),
+		limit:  limit,
+		window: window,
+	}
+}
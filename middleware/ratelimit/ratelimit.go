@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/session"
+)
+
+// Limiter decides whether a request identified by the key is allowed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Result is the decision of a Limiter.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed, zero if allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the quota is fully restored.
+	ResetAfter time.Duration
+}
+
+// KeyFunc returns the key to throttle the request by,
+// requests with an empty key are not throttled.
+type KeyFunc func(ctx *easyweb.Context) string
+
+// KeyByIP throttles by the client ip, see easyweb.ServerWithTrustedProxiesOpt for the clients behind proxies.
+func KeyByIP(ctx *easyweb.Context) string {
+	return ctx.ClientIP()
+}
+
+// KeyByRoute throttles by the matched route, all the clients share the quota.
+func KeyByRoute(ctx *easyweb.Context) string {
+	return ctx.Req.Method + " " + ctx.MatchedRoute
+}
+
+// KeyByHeader throttles by the header value, e.g. an api key.
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *easyweb.Context) string {
+		return ctx.Req.Header.Get(name)
+	}
+}
+
+// KeyBySession throttles by the session id, requests without a session are not throttled.
+func KeyBySession(m *session.Manager) KeyFunc {
+	return func(ctx *easyweb.Context) string {
+		s, err := m.GetSession(ctx)
+		if err != nil {
+			return ""
+		}
+		return s.Id()
+	}
+}
+
+// JoinKeys throttles by the combination of the keys, e.g. the route and the client ip.
+// The request is not throttled if any of the keys is empty.
+func JoinKeys(keyFuncs ...KeyFunc) KeyFunc {
+	return func(ctx *easyweb.Context) string {
+		keys := make([]string, 0, len(keyFuncs))
+		for _, keyFunc := range keyFuncs {
+			key := keyFunc(ctx)
+			if key == "" {
+				return ""
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, "|")
+	}
+}
+
+type MiddlewareBuilder struct {
+	limiter    Limiter
+	keyFunc    KeyFunc
+	statusCode int
+	errMsg     string
+	logFunc    func(ctx *easyweb.Context, err error)
+}
+
+// WithKeyFunc customizes what to throttle by.
+// defaults to KeyByIP.
+func (b *MiddlewareBuilder) WithKeyFunc(keyFunc KeyFunc) *MiddlewareBuilder {
+	b.keyFunc = keyFunc
+	return b
+}
+
+// WithStatusCode the code returns to the front end when throttled.
+// defaults to 429.
+func (b *MiddlewareBuilder) WithStatusCode(statusCode int) *MiddlewareBuilder {
+	b.statusCode = statusCode
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when throttled.
+// defaults to "Too Many Requests"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+// WithLogFunc is called when the limiter fails, the request is let through in this case.
+func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context, err error)) *MiddlewareBuilder {
+	b.logFunc = logFunc
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			key := b.keyFunc(ctx)
+			if key == "" {
+				next(ctx)
+				return
+			}
+
+			res, err := b.limiter.Allow(ctx.Req.Context(), key)
+			if err != nil {
+				b.logFunc(ctx, err)
+				next(ctx)
+				return
+			}
+
+			header := ctx.Resp.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", seconds(res.ResetAfter))
+
+			if !res.Allowed {
+				header.Set("Retry-After", seconds(res.RetryAfter))
+				ctx.StatusCode = b.statusCode
+				ctx.Data = []byte(b.errMsg)
+				return
+			}
+
+			next(ctx)
+		}
+	}
+}
+
+func NewMiddlewareBuilder(limiter Limiter) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limiter:    limiter,
+		keyFunc:    KeyByIP,
+		statusCode: http.StatusTooManyRequests,
+		errMsg:     "Too Many Requests",
+		logFunc: func(ctx *easyweb.Context, err error) {
+			log.Printf("rate limiter failed in path %s: %v", ctx.Req.URL.Path, err)
+		},
+	}
+}
+
+// seconds formats the duration as delta seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	mw := NewMiddlewareBuilder(NewMemTokenBucketLimiter(1, time.Hour, 2)).
+		WithKeyFunc(JoinKeys(KeyByRoute, KeyByHeader("X-Api-Key"))).
+		Build()
+	svr.Get("/order/:id", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	}, mw)
+
+	serve := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("a")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3600", recorder.Header().Get("RateLimit-Reset"))
+
+	recorder = serve("a")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "7200", recorder.Header().Get("RateLimit-Reset"))
+
+	recorder = serve("a")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "Too Many Requests", recorder.Body.String())
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3600", recorder.Header().Get("Retry-After"))
+
+	// another key owns another bucket
+	assert.Equal(t, http.StatusOK, serve("b").Code)
+
+	// requests without key are not throttled
+	for i := 0; i < 3; i++ {
+		recorder = serve("")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Empty(t, recorder.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestMiddlewareBuilder_Build_limiterErr(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	var logged error
+	svr.Get("/", func(ctx *easyweb.Context) {
+		_ = ctx.Ok()
+	}, NewMiddlewareBuilder(errLimiter{}).WithLogFunc(func(ctx *easyweb.Context, err error) {
+		logged = err
+	}).Build())
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Error(t, logged)
+}
+
+type errLimiter struct{}
+
+func (errLimiter) Allow(context.Context, string) (Result, error) {
+	return Result{}, errors.New("mock error")
+}
+
+func TestMemTokenBucketLimiter_Allow(t *testing.T) {
+	l := NewMemTokenBucketLimiter(1, 50*time.Millisecond, 2)
+	testTokenBucketLimiter(t, l)
+}
+
+func TestMemSlidingWindowLimiter_Allow(t *testing.T) {
+	l := NewMemSlidingWindowLimiter(3, 100*time.Millisecond)
+	testSlidingWindowLimiter(t, l)
+}
+
+func testTokenBucketLimiter(t *testing.T, l Limiter) {
+	for i := 0; i < 2; i++ {
+		res, err := l.Allow(context.Background(), "key")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 1-i, res.Remaining)
+	}
+
+	res, err := l.Allow(context.Background(), "key")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, res.RetryAfter, 50*time.Millisecond)
+
+	time.Sleep(res.RetryAfter + 5*time.Millisecond)
+
+	res, err = l.Allow(context.Background(), "key")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func testSlidingWindowLimiter(t *testing.T, l Limiter) {
+	allowed := 0
+	var res Result
+	for i := 0; i < 5; i++ {
+		var err error
+		res, err = l.Allow(context.Background(), "key")
+		require.NoError(t, err)
+		if res.Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 3, allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, res.RetryAfter, 200*time.Millisecond)
+
+	time.Sleep(res.RetryAfter + 5*time.Millisecond)
+
+	res, err := l.Allow(context.Background(), "key")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestSlidingWindowRetryAfter(t *testing.T) {
+	window := 100 * time.Millisecond
+
+	tcs := []struct {
+		name      string
+		elapsed   time.Duration
+		curr      int
+		prev      int
+		wantRetry time.Duration
+	}{
+		{
+			name:      "current window full",
+			elapsed:   40 * time.Millisecond,
+			curr:      4,
+			wantRetry: 60*time.Millisecond + 25*time.Millisecond,
+		}, {
+			name:      "previous window weighs too much",
+			elapsed:   20 * time.Millisecond,
+			curr:      1,
+			prev:      4,
+			wantRetry: 30 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			retry := slidingWindowRetryAfter(4, window, tc.elapsed, tc.curr, tc.prev)
+			assert.Equal(t, tc.wantRetry, retry)
+
+			// allowed right after waiting
+			elapsed, curr, prev := tc.elapsed+retry, tc.curr, tc.prev
+			if elapsed >= window {
+				elapsed, curr, prev = elapsed-window, 0, curr
+			}
+			assert.LessOrEqual(t, estimate(window, elapsed, curr, prev)+1, float64(4))
+		})
+	}
+}
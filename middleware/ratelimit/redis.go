@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed token_bucket.lua
+var tokenBucketLua string
+
+//go:embed sliding_window.lua
+var slidingWindowLua string
+
+var (
+	_ Limiter = (*RTokenBucketLimiter)(nil)
+	_ Limiter = (*RSlidingWindowLimiter)(nil)
+)
+
+// RTokenBucketLimiter redis implementation for token bucket algorithm,
+// see MemTokenBucketLimiter.
+type RTokenBucketLimiter struct {
+	client redis.Cmdable
+	prefix string
+	burst  int
+	rate   float64
+}
+
+func (l *RTokenBucketLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	// the script works in milliseconds
+	rate := l.rate * float64(time.Millisecond)
+	res, err := l.client.Eval(
+		ctx, tokenBucketLua, []string{fmt.Sprintf("%s:%s", l.prefix, key)},
+		l.burst, strconv.FormatFloat(rate, 'f', -1, 64), time.Now().UnixMilli(),
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(res) != 2 {
+		return Result{}, fmt.Errorf("[ratelimit] unexpected token bucket result: %v", res)
+	}
+
+	allowed, _ := res[0].(int64)
+	tokens, err := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return tokenBucketResult(allowed == 1, l.burst, l.rate, tokens), nil
+}
+
+func NewRTokenBucketLimiter(client redis.Cmdable, rate int, interval time.Duration, burst int, opts ...RLimiterOpt) *RTokenBucketLimiter {
+	o := newRLimiterOpts(opts)
+	return &RTokenBucketLimiter{
+		client: client,
+		prefix: o.prefix,
+		burst:  burst,
+		rate:   float64(rate) / float64(interval),
+	}
+}
+
+// RSlidingWindowLimiter redis implementation for sliding window algorithm,
+// see MemSlidingWindowLimiter.
+type RSlidingWindowLimiter struct {
+	client redis.Cmdable
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+func (l *RSlidingWindowLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now().UnixNano()
+	idx := now / int64(l.window)
+	elapsed := time.Duration(now - idx*int64(l.window))
+
+	// the hash tag keeps both windows in the same slot of a redis cluster
+	keys := []string{
+		fmt.Sprintf("{%s:%s}:%d", l.prefix, key, idx),
+		fmt.Sprintf("{%s:%s}:%d", l.prefix, key, idx-1),
+	}
+	res, err := l.client.Eval(
+		ctx, slidingWindowLua, keys, l.limit, l.window.Milliseconds(), elapsed.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(res) != 3 {
+		return Result{}, fmt.Errorf("[ratelimit] unexpected sliding window result: %v", res)
+	}
+
+	return slidingWindowResult(res[0] == 1, l.limit, l.window, elapsed, int(res[1]), int(res[2])), nil
+}
+
+func NewRSlidingWindowLimiter(client redis.Cmdable, limit int, window time.Duration, opts ...RLimiterOpt) *RSlidingWindowLimiter {
+	o := newRLimiterOpts(opts)
+	return &RSlidingWindowLimiter{
+		client: client,
+		prefix: o.prefix,
+		limit:  limit,
+		window: window,
+	}
+}
+
+type rLimiterOpts struct {
+	prefix string
+}
+
+type RLimiterOpt func(*rLimiterOpts)
+
+func RLimiterWithPrefix(prefix string) RLimiterOpt {
+	return func(o *rLimiterOpts) {
+		o.prefix = prefix
+	}
+}
+
+func newRLimiterOpts(opts []RLimiterOpt) *rLimiterOpts {
+	o := &rLimiterOpts{
+		prefix: "ratelimit",
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.Cmdable) {
+	mr := miniredis.RunT(t)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func TestRTokenBucketLimiter_Allow(t *testing.T) {
+	mr, client := newTestRedis(t)
+
+	l := NewRTokenBucketLimiter(client, 1, 50*time.Millisecond, 2, RLimiterWithPrefix("test"))
+	testTokenBucketLimiter(t, l)
+
+	assert.True(t, mr.Exists("test:key"))
+	assert.LessOrEqual(t, mr.TTL("test:key"), 100*time.Millisecond)
+}
+
+func TestRSlidingWindowLimiter_Allow(t *testing.T) {
+	mr, client := newTestRedis(t)
+
+	l := NewRSlidingWindowLimiter(client, 3, 100*time.Millisecond)
+	testSlidingWindowLimiter(t, l)
+
+	for _, key := range mr.Keys() {
+		assert.Greater(t, mr.TTL(key), time.Duration(0))
+		assert.LessOrEqual(t, mr.TTL(key), 200*time.Millisecond)
+	}
+}
+
+func TestRLimiter_Allow_err(t *testing.T) {
+	mr, client := newTestRedis(t)
+	mr.Close()
+
+	_, err := NewRTokenBucketLimiter(client, 1, time.Second, 1).Allow(context.Background(), "key")
+	require.Error(t, err)
+
+	_, err = NewRSlidingWindowLimiter(client, 1, time.Second).Allow(context.Background(), "key")
+	require.Error(t, err)
+}
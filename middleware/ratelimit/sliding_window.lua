@@ -0,0 +1,15 @@
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local curr = tonumber(redis.call("get", KEYS[1]) or "0")
+local prev = tonumber(redis.call("get", KEYS[2]) or "0")
+
+if prev * (window - elapsed) / window + curr + 1 > limit
+then
+    return { 0, curr, prev }
+end
+
+curr = redis.call("incr", KEYS[1])
+redis.call("pexpire", KEYS[1], window * 2 - elapsed)
+return { 1, curr, prev }
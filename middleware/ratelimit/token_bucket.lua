@@ -0,0 +1,25 @@
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("hmget", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil
+then
+    tokens = burst
+    last = now
+end
+
+tokens = math.min(burst, tokens + math.max(now - last, 0) * rate)
+
+local allowed = 0
+if tokens >= 1
+then
+    tokens = tokens - 1
+    allowed = 1
+end
+
+redis.call("hset", KEYS[1], "tokens", tostring(tokens), "last", now)
+redis.call("pexpire", KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+return { allowed, tostring(tokens) }
@@ -1,16 +1,71 @@
 package recovery
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"runtime/debug"
+	"syscall"
 
 	easyweb "github.com/JrMarcco/easy-web"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// userValueKey is the key of the recovered panic in Context.UserValues.
+const userValueKey = "_recovery_panic"
+
+// Panic is the panic recovered by the middleware.
+type Panic struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine when panicked.
+	Stack []byte
+	// BrokenPipe reports whether the panic is caused by the client going away,
+	// no response is sent in that case.
+	BrokenPipe bool
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *Panic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// stackPanic is a panic value carrying the value and the stack trace of the goroutine where it panicked,
+// e.g. timeout.PanicError.
+type stackPanic interface {
+	PanicValue() any
+	PanicStack() []byte
+}
+
+// Renderer writes the response of the recovered panic, see TextRenderer and JSONRenderer.
+type Renderer func(ctx *easyweb.Context, statusCode int, errMsg string)
+
+// TextRenderer responds the error message as plain text.
+func TextRenderer(ctx *easyweb.Context, statusCode int, errMsg string) {
+	ctx.Resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = ctx.RespBytes(statusCode, []byte(errMsg))
+}
+
+// JSONRenderer responds the error message as {"error": "..."}.
+func JSONRenderer(ctx *easyweb.Context, statusCode int, errMsg string) {
+	ctx.Resp.Header().Set("Content-Type", "application/json")
+	_ = ctx.RespJson(statusCode, map[string]string{"error": errMsg})
+}
+
 // MiddlewareBuilder should be the most outer in a middleware chain.
 type MiddlewareBuilder struct {
-	statusCode int
-	errMsg     string
-	logFunc    func(ctx *easyweb.Context)
+	statusCode   int
+	errMsg       string
+	renderer     Renderer
+	logFunc      func(ctx *easyweb.Context, p *Panic)
+	repanicAbort bool
 }
 
 // WithStatusCode the code returns to the front end when panicked.
@@ -27,21 +82,75 @@ func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
 	return b
 }
 
+// WithRenderer writes the response by the renderer, the panic is available by GetPanic.
+// defaults to TextRenderer.
+func (b *MiddlewareBuilder) WithRenderer(renderer Renderer) *MiddlewareBuilder {
+	b.renderer = renderer
+	return b
+}
+
+// WithLogFunc logs the recovered panic, which is available by GetPanic.
+// See WithPanicLogFunc, which receives the panic directly.
 func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context)) *MiddlewareBuilder {
+	b.logFunc = func(ctx *easyweb.Context, _ *Panic) {
+		logFunc(ctx)
+	}
+	return b
+}
+
+// WithPanicLogFunc logs the recovered panic with its stack trace.
+// defaults to log.Printf.
+func (b *MiddlewareBuilder) WithPanicLogFunc(logFunc func(ctx *easyweb.Context, p *Panic)) *MiddlewareBuilder {
 	b.logFunc = logFunc
 	return b
 }
 
+// WithRepanicAbort re-panics on http.ErrAbortHandler,
+// so that net/http aborts the response silently as the handler intends.
+// defaults to true.
+func (b *MiddlewareBuilder) WithRepanicAbort(repanic bool) *MiddlewareBuilder {
+	b.repanicAbort = repanic
+	return b
+}
+
 func (b *MiddlewareBuilder) Build() easyweb.Middleware {
 	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
 		return func(ctx *easyweb.Context) {
 			defer func() {
-				if err := recover(); err != nil {
-					ctx.StatusCode = b.statusCode
-					ctx.Data = []byte(b.errMsg)
+				val := recover()
+				if val == nil {
+					return
+				}
+
+				if b.repanicAbort && val == http.ErrAbortHandler {
+					panic(val)
+				}
+
+				p := &Panic{Value: val}
+				// re-panicked from another goroutine, e.g. by the timeout middleware
+				if sp, ok := val.(stackPanic); ok {
+					p.Value, p.Stack = sp.PanicValue(), sp.PanicStack()
+				} else {
+					p.Stack = debug.Stack()
+				}
+				p.BrokenPipe = isBrokenPipe(p.Value)
+				setPanic(ctx, p)
+
+				// the span of a trace middleware inside is ended already and not recording, so the panic is recorded once
+				if span := trace.SpanFromContext(ctx.TraceCtx); span.IsRecording() {
+					span.RecordError(p, trace.WithStackTrace(true))
+					span.SetStatus(codes.Error, "panic")
+				}
 
-					b.logFunc(ctx)
+				b.logFunc(ctx, p)
+
+				if p.BrokenPipe {
+					// the client is gone, nothing is able to be written
+					ctx.StatusCode = 0
+					ctx.Data = nil
+					return
 				}
+				b.renderer(ctx, b.statusCode, b.errMsg)
 			}()
 			next(ctx)
 		}
@@ -50,10 +159,40 @@ func (b *MiddlewareBuilder) Build() easyweb.Middleware {
 
 func NewMiddlewareBuilder() *MiddlewareBuilder {
 	return &MiddlewareBuilder{
-		statusCode: 500,
-		errMsg:     "Internal Error",
-		logFunc: func(ctx *easyweb.Context) {
-			log.Printf("panic in path: %s", ctx.Req.URL.Path)
+		statusCode:   500,
+		errMsg:       "Internal Error",
+		renderer:     TextRenderer,
+		repanicAbort: true,
+		logFunc: func(ctx *easyweb.Context, p *Panic) {
+			if p.BrokenPipe {
+				log.Printf("[recovery] connection broken in path: %s, %v", ctx.Req.URL.Path, p.Value)
+				return
+			}
+			log.Printf("[recovery] panic in path: %s, %v\n%s", ctx.Req.URL.Path, p.Value, p.Stack)
 		},
 	}
 }
+
+// GetPanic returns the panic recovered by the middleware, e.g. in a custom renderer.
+func GetPanic(ctx *easyweb.Context) (*Panic, bool) {
+	p, ok := ctx.UserValues[userValueKey].(*Panic)
+	return p, ok
+}
+
+func setPanic(ctx *easyweb.Context, p *Panic) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[userValueKey] = p
+}
+
+// isBrokenPipe reports whether the panic value is an error of writing to a connection closed by the client.
+func isBrokenPipe(val any) bool {
+	err, ok := val.(error)
+	if !ok {
+		return false
+	}
+
+	// *net.OpError and *os.SyscallError unwrap to the errno
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,208 @@
+package recovery
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/timeout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	errBroken := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+
+	testCases := []struct {
+		name       string
+		builder    func(b *MiddlewareBuilder) *MiddlewareBuilder
+		panicVal   any
+		wantCode   int
+		wantBody   string
+		wantType   string
+		wantBroken bool
+	}{
+		{
+			name:     "text",
+			panicVal: "boom",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Error",
+			wantType: "text/plain; charset=utf-8",
+		},
+		{
+			name: "json",
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.WithRenderer(JSONRenderer).WithStatusCode(http.StatusServiceUnavailable).WithErrMsg("try later")
+			},
+			panicVal: errors.New("boom"),
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `{"error":"try later"}`,
+			wantType: "application/json",
+		},
+		{
+			name: "custom renderer",
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.WithRenderer(func(ctx *easyweb.Context, statusCode int, errMsg string) {
+					p, _ := GetPanic(ctx)
+					_ = ctx.RespJson(statusCode, map[string]any{"panic": p.Value})
+				})
+			},
+			panicVal: "boom",
+			wantCode: http.StatusInternalServerError,
+			wantBody: `{"panic":"boom"}`,
+		},
+		{
+			name:       "broken pipe",
+			panicVal:   errBroken,
+			wantCode:   http.StatusOK,
+			wantBroken: true,
+		},
+		{
+			name: "abort handler recovered",
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.WithRepanicAbort(false)
+			},
+			panicVal: http.ErrAbortHandler,
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Error",
+			wantType: "text/plain; charset=utf-8",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logged *Panic
+			b := NewMiddlewareBuilder().WithPanicLogFunc(func(ctx *easyweb.Context, p *Panic) {
+				logged = p
+			})
+			if tc.builder != nil {
+				b = tc.builder(b)
+			}
+
+			svr := easyweb.NewHttpServer()
+			svr.Use(b.Build())
+			svr.Get("/", func(ctx *easyweb.Context) {
+				panic(tc.panicVal)
+			})
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantType, recorder.Header().Get("Content-Type"))
+
+			require.NotNil(t, logged)
+			assert.Equal(t, tc.panicVal, logged.Value)
+			assert.Equal(t, tc.wantBroken, logged.BrokenPipe)
+			assert.Contains(t, string(logged.Stack), "recovery.TestMiddlewareBuilder_Build")
+		})
+	}
+}
+
+func TestMiddlewareBuilder_WithLogFunc(t *testing.T) {
+	var logged *Panic
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().WithLogFunc(func(ctx *easyweb.Context) {
+		logged, _ = GetPanic(ctx)
+	}).Build())
+	svr.Get("/", func(ctx *easyweb.Context) {
+		panic("boom")
+	})
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.NotNil(t, logged)
+	assert.Equal(t, "boom", logged.Value)
+}
+
+func TestMiddlewareBuilder_Build_timeout(t *testing.T) {
+	var logged *Panic
+	svr := easyweb.NewHttpServer()
+	svr.Use(
+		NewMiddlewareBuilder().WithPanicLogFunc(func(ctx *easyweb.Context, p *Panic) {
+			logged = p
+		}).Build(),
+		timeout.NewMiddlewareBuilder().Build(),
+	)
+	svr.Get("/", func(ctx *easyweb.Context) {
+		panicInHandler()
+	})
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.NotNil(t, logged)
+	// the value and the stack of the handler's goroutine
+	assert.Equal(t, "boom", logged.Value)
+	assert.Contains(t, string(logged.Stack), "panicInHandler")
+}
+
+func panicInHandler() {
+	panic("boom")
+}
+
+func TestMiddlewareBuilder_Build_abort(t *testing.T) {
+	logged := false
+	svr := easyweb.NewHttpServer()
+	svr.Use(NewMiddlewareBuilder().WithPanicLogFunc(func(ctx *easyweb.Context, p *Panic) { logged = true }).Build())
+	svr.Get("/", func(ctx *easyweb.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.False(t, logged)
+}
+
+func TestMiddlewareBuilder_Build_span(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(
+		// a span started outside the recovery middleware
+		func(next easyweb.HandleFunc) easyweb.HandleFunc {
+			return func(ctx *easyweb.Context) {
+				var span trace.Span
+				ctx.TraceCtx, span = provider.Tracer("test").Start(ctx.TraceCtx, "outer")
+				defer span.End()
+				next(ctx)
+			}
+		},
+		NewMiddlewareBuilder().WithPanicLogFunc(func(ctx *easyweb.Context, p *Panic) {}).Build(),
+	)
+	svr.Get("/", func(ctx *easyweb.Context) {
+		panic("boom")
+	})
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "exception", spans[0].Events[0].Name)
+}
+
+func TestPanic_Unwrap(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	p := &Panic{Value: errBoom}
+	assert.ErrorIs(t, p, errBoom)
+	assert.Equal(t, "panic: boom", p.Error())
+
+	p = &Panic{Value: 1}
+	assert.Nil(t, p.Unwrap())
+}
@@ -0,0 +1,186 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/google/uuid"
+)
+
+// DefaultHeader is the default header carrying the request id.
+const DefaultHeader = "X-Request-ID"
+
+type ctxKey struct{}
+
+// Generator generates a request id.
+type Generator func() string
+
+// UUIDv4 generates a random uuid.
+func UUIDv4() string {
+	return uuid.NewString()
+}
+
+// UUIDv7 generates a time-ordered uuid.
+func UUIDv7() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// crockford is the base32 alphabet of ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates a lexicographically sortable id, 48 bits of milliseconds followed by 80 random bits.
+func ULID() string {
+	var bs [16]byte
+	binary.BigEndian.PutUint64(bs[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(bs[6:])
+
+	// 128 bits encoded into 26 chars of 5 bits, the first char holds the highest 3 bits
+	hi, lo := binary.BigEndian.Uint64(bs[:8]), binary.BigEndian.Uint64(bs[8:])
+	res := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		res[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(res)
+}
+
+// MiddlewareBuilder reads the request id from the request header or generates one.
+// The id is echoed in the response header and stored in ctx.TraceCtx and the request context,
+// so that Transport and the proxy package forward it, see Get, FromContext and Transport.
+type MiddlewareBuilder struct {
+	header        string
+	generator     Generator
+	trustIncoming bool
+}
+
+// WithHeader the header carrying the request id.
+// defaults to "X-Request-ID".
+func (b *MiddlewareBuilder) WithHeader(header string) *MiddlewareBuilder {
+	b.header = header
+	return b
+}
+
+// WithGenerator generates the id of the requests without one.
+// defaults to UUIDv4.
+func (b *MiddlewareBuilder) WithGenerator(generator Generator) *MiddlewareBuilder {
+	b.generator = generator
+	return b
+}
+
+// WithTrustIncoming uses the id from the request header, e.g. set by the gateway.
+// An incoming id longer than 128 bytes or with non-printable characters is replaced anyway.
+// defaults to true.
+func (b *MiddlewareBuilder) WithTrustIncoming(trustIncoming bool) *MiddlewareBuilder {
+	b.trustIncoming = trustIncoming
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			var id string
+			if b.trustIncoming {
+				id = ctx.Req.Header.Get(b.header)
+			}
+			if !valid(id) {
+				id = b.generator()
+			}
+
+			ctx.Resp.Header().Set(b.header, id)
+			ctx.TraceCtx = NewContext(ctx.TraceCtx, id)
+			ctx.Req = ctx.Req.WithContext(NewContext(ctx.Req.Context(), id))
+			// the replaced incoming id must not be forwarded as is
+			if ctx.Req.Header.Get(b.header) != id {
+				ctx.Req.Header.Set(b.header, id)
+			}
+			next(ctx)
+		}
+	}
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		header:        DefaultHeader,
+		generator:     UUIDv4,
+		trustIncoming: true,
+	}
+}
+
+// valid reports whether the incoming id is safe to log and echo.
+func valid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the request id of the request, empty if the middleware is not applied.
+func Get(ctx *easyweb.Context) string {
+	id, _ := FromContext(ctx.TraceCtx)
+	return id
+}
+
+// FromContext returns the request id carried by the context, e.g. ctx.TraceCtx.
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok
+}
+
+// NewContext returns a copy of the context carrying the request id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// Transport propagates the request id from the request context to the downstream, e.g.
+//
+//	client := &http.Client{Transport: &requestid.Transport{}}
+//	req, _ := http.NewRequestWithContext(ctx.TraceCtx, http.MethodGet, url, nil)
+type Transport struct {
+	// Base defaults to http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// Header defaults to DefaultHeader if empty.
+	Header string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	header := t.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+
+	id, ok := FromContext(req.Context())
+	if !ok || req.Header.Get(header) != "" {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(header, id)
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,180 @@
+package requestid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/accesslog"
+	"github.com/JrMarcco/easy-web/middleware/requestid"
+	"github.com/JrMarcco/easy-web/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	tcs := []struct {
+		name      string
+		builder   *requestid.MiddlewareBuilder
+		reqHeader map[string]string
+		header    string
+		wantID    func(t *testing.T, id string)
+	}{
+		{
+			name:    "generated",
+			builder: requestid.NewMiddlewareBuilder(),
+			wantID: func(t *testing.T, id string) {
+				assert.Regexp(t, uuidRegexp, id)
+			},
+		}, {
+			name:      "incoming",
+			builder:   requestid.NewMiddlewareBuilder(),
+			reqHeader: map[string]string{"X-Request-ID": "req-1"},
+			wantID: func(t *testing.T, id string) {
+				assert.Equal(t, "req-1", id)
+			},
+		}, {
+			name:      "invalid incoming",
+			builder:   requestid.NewMiddlewareBuilder(),
+			reqHeader: map[string]string{"X-Request-ID": "req 1\n"},
+			wantID: func(t *testing.T, id string) {
+				assert.Regexp(t, uuidRegexp, id)
+			},
+		}, {
+			name:      "untrusted incoming",
+			builder:   requestid.NewMiddlewareBuilder().WithTrustIncoming(false),
+			reqHeader: map[string]string{"X-Request-ID": "req-1"},
+			wantID: func(t *testing.T, id string) {
+				assert.Regexp(t, uuidRegexp, id)
+			},
+		}, {
+			name:      "custom header and generator",
+			builder:   requestid.NewMiddlewareBuilder().WithHeader("X-Trace-ID").WithGenerator(requestid.ULID),
+			reqHeader: map[string]string{"X-Request-ID": "req-1"},
+			header:    "X-Trace-ID",
+			wantID: func(t *testing.T, id string) {
+				assert.Len(t, id, 26)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var logged string
+			svr := easyweb.NewHttpServer()
+			svr.Use(
+				accesslog.NewMiddlewareBuilder().WithLogFunc(func(msg string) { logged = msg }).Build(),
+				tc.builder.Build(),
+			)
+
+			var gotID string
+			svr.Get("/", func(ctx *easyweb.Context) {
+				gotID = requestid.Get(ctx)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.reqHeader {
+				req.Header.Set(k, v)
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			tc.wantID(t, gotID)
+			header := tc.header
+			if header == "" {
+				header = requestid.DefaultHeader
+			}
+			assert.Equal(t, gotID, recorder.Header().Get(header))
+			assert.Contains(t, logged, `"request_id":"`+gotID+`"`)
+		})
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	assert.Regexp(t, uuidRegexp, requestid.UUIDv4())
+	assert.Regexp(t, uuidRegexp, requestid.UUIDv7())
+
+	ulidRegexp := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	prev := requestid.ULID()
+	for range 100 {
+		id := requestid.ULID()
+		assert.Regexp(t, ulidRegexp, id)
+		// the timestamp part is sortable
+		assert.LessOrEqual(t, prev[:10], id[:10])
+		prev = id
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var gotIDs []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIDs = append(gotIDs, r.Header.Get("X-Request-ID"))
+	}))
+	defer upstream.Close()
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(requestid.NewMiddlewareBuilder().Build())
+	svr.Get("/", func(ctx *easyweb.Context) {
+		client := &http.Client{Transport: &requestid.Transport{Base: upstream.Client().Transport}}
+
+		req, err := http.NewRequestWithContext(ctx.TraceCtx, http.MethodGet, upstream.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		// the header set by the caller wins
+		req, err = http.NewRequestWithContext(ctx.TraceCtx, http.MethodGet, upstream.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Request-ID", "explicit")
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	svr.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []string{"req-1", "explicit"}, gotIDs)
+}
+
+func TestMiddlewareBuilder_Build_propagation(t *testing.T) {
+	var gotIDs []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIDs = append(gotIDs, r.Header.Get("X-Request-ID"))
+	}))
+	defer upstream.Close()
+
+	p, err := proxy.NewProxy([]string{upstream.URL}, proxy.ProxyWithTransport(&requestid.Transport{}))
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(requestid.NewMiddlewareBuilder().
+		WithGenerator(func() string { return "generated" }).
+		WithTrustIncoming(false).
+		Build())
+	svr.Get("/proxy", p.Handle)
+	svr.Get("/client", func(ctx *easyweb.Context) {
+		// the request context carries the id as well as ctx.TraceCtx
+		req, err := http.NewRequestWithContext(ctx.Req.Context(), http.MethodGet, upstream.URL, nil)
+		require.NoError(t, err)
+		resp, err := (&http.Client{Transport: &requestid.Transport{}}).Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	// the untrusted incoming id is replaced
+	req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	req.Header.Set("X-Request-ID", "forged")
+	svr.ServeHTTP(httptest.NewRecorder(), req)
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/client", nil))
+
+	assert.Equal(t, []string{"generated", "generated", "generated"}, gotIDs)
+}
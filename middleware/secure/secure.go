@@ -0,0 +1,269 @@
+package secure
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+const (
+	// MetaKey is the route metadata key to override the headers of a group's routes,
+	// the value must be a map[string]string, see MiddlewareBuilder.WithRouteHeaders.
+	MetaKey = "secure"
+
+	// NoncePlaceholder in the Content-Security-Policy is replaced by a random nonce per request, e.g.
+	//
+	//	script-src 'self' 'nonce-{nonce}'
+	NoncePlaceholder = "{nonce}"
+)
+
+// userValueKey is the key of the nonce in Context.UserValues.
+const userValueKey = "_csp_nonce"
+
+// MiddlewareBuilder sets the security headers of the response.
+// The headers are set before the handler, so the handler is able to change them.
+// An empty value disables the header.
+type MiddlewareBuilder struct {
+	hstsMaxAge            time.Duration
+	hstsIncludeSubdomains bool
+	hstsPreload           bool
+	csp                   string
+	cspReportOnly         bool
+	frameOptions          string
+	contentTypeNosniff    bool
+	referrerPolicy        string
+	permissionsPolicy     string
+	coop                  string
+	coep                  string
+	httpsRedirect         bool
+	routeHeaders          map[string]map[string]string
+}
+
+// WithHSTS the Strict-Transport-Security header, only sent over https.
+// defaults to a max age of 1 year including the subdomains, a non-positive max age disables the header.
+func (b *MiddlewareBuilder) WithHSTS(maxAge time.Duration, includeSubdomains bool, preload bool) *MiddlewareBuilder {
+	b.hstsMaxAge = maxAge
+	b.hstsIncludeSubdomains = includeSubdomains
+	b.hstsPreload = preload
+	return b
+}
+
+// WithCSP the Content-Security-Policy header, see NoncePlaceholder.
+// defaults to none.
+func (b *MiddlewareBuilder) WithCSP(policy string) *MiddlewareBuilder {
+	b.csp = policy
+	return b
+}
+
+// WithCSPReportOnly sends the policy as Content-Security-Policy-Report-Only to try it out without enforcing.
+func (b *MiddlewareBuilder) WithCSPReportOnly(reportOnly bool) *MiddlewareBuilder {
+	b.cspReportOnly = reportOnly
+	return b
+}
+
+// WithFrameOptions the X-Frame-Options header.
+// defaults to "DENY".
+func (b *MiddlewareBuilder) WithFrameOptions(frameOptions string) *MiddlewareBuilder {
+	b.frameOptions = frameOptions
+	return b
+}
+
+// WithContentTypeNosniff sets X-Content-Type-Options to "nosniff".
+// defaults to true.
+func (b *MiddlewareBuilder) WithContentTypeNosniff(nosniff bool) *MiddlewareBuilder {
+	b.contentTypeNosniff = nosniff
+	return b
+}
+
+// WithReferrerPolicy the Referrer-Policy header.
+// defaults to "strict-origin-when-cross-origin".
+func (b *MiddlewareBuilder) WithReferrerPolicy(policy string) *MiddlewareBuilder {
+	b.referrerPolicy = policy
+	return b
+}
+
+// WithPermissionsPolicy the Permissions-Policy header, e.g. "camera=(), geolocation=()".
+// defaults to none.
+func (b *MiddlewareBuilder) WithPermissionsPolicy(policy string) *MiddlewareBuilder {
+	b.permissionsPolicy = policy
+	return b
+}
+
+// WithCrossOriginOpenerPolicy the Cross-Origin-Opener-Policy header.
+// defaults to "same-origin".
+func (b *MiddlewareBuilder) WithCrossOriginOpenerPolicy(policy string) *MiddlewareBuilder {
+	b.coop = policy
+	return b
+}
+
+// WithCrossOriginEmbedderPolicy the Cross-Origin-Embedder-Policy header, e.g. "require-corp".
+// defaults to none.
+func (b *MiddlewareBuilder) WithCrossOriginEmbedderPolicy(policy string) *MiddlewareBuilder {
+	b.coep = policy
+	return b
+}
+
+// WithHTTPSRedirect redirects the plain http requests to https with 308.
+// Behind a proxy terminating TLS, the proxy must be trusted by easyweb.ServerWithTrustedProxiesOpt.
+func (b *MiddlewareBuilder) WithHTTPSRedirect(redirect bool) *MiddlewareBuilder {
+	b.httpsRedirect = redirect
+	return b
+}
+
+// WithRouteHeaders overrides the headers of the route, the route is the registered pattern ( e.g. /widget/:id ).
+// An empty value removes the header, e.g. to allow framing a widget:
+//
+//	b.WithRouteHeaders("/widget/:id", map[string]string{"X-Frame-Options": ""})
+func (b *MiddlewareBuilder) WithRouteHeaders(route string, headers map[string]string) *MiddlewareBuilder {
+	b.routeHeaders[route] = headers
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	headers := b.headers()
+
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			isTLS := ctx.Scheme() == "https"
+			if b.httpsRedirect && !isTLS {
+				redirectToHTTPS(ctx)
+				return
+			}
+
+			dst := ctx.Resp.Header()
+			set := func(key string, val string) {
+				if val == "" {
+					dst.Del(key)
+					return
+				}
+
+				if strings.Contains(val, NoncePlaceholder) {
+					val = strings.ReplaceAll(val, NoncePlaceholder, nonce(ctx))
+				}
+				dst.Set(key, val)
+			}
+
+			for key, val := range headers {
+				if key == "Strict-Transport-Security" && !isTLS {
+					continue
+				}
+				set(key, val)
+			}
+			for key, val := range b.overrides(ctx) {
+				set(key, val)
+			}
+
+			next(ctx)
+		}
+	}
+}
+
+// headers returns the headers set on every response.
+func (b *MiddlewareBuilder) headers() map[string]string {
+	headers := map[string]string{
+		"X-Frame-Options":              b.frameOptions,
+		"Referrer-Policy":              b.referrerPolicy,
+		"Permissions-Policy":           b.permissionsPolicy,
+		"Cross-Origin-Opener-Policy":   b.coop,
+		"Cross-Origin-Embedder-Policy": b.coep,
+	}
+
+	if b.contentTypeNosniff {
+		headers["X-Content-Type-Options"] = "nosniff"
+	}
+
+	if b.cspReportOnly {
+		headers["Content-Security-Policy-Report-Only"] = b.csp
+	} else {
+		headers["Content-Security-Policy"] = b.csp
+	}
+
+	if b.hstsMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(b.hstsMaxAge.Seconds()), 10)
+		if b.hstsIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if b.hstsPreload {
+			hsts += "; preload"
+		}
+		headers["Strict-Transport-Security"] = hsts
+	}
+
+	for key, val := range headers {
+		if val == "" {
+			delete(headers, key)
+		}
+	}
+	return headers
+}
+
+func (b *MiddlewareBuilder) overrides(ctx *easyweb.Context) map[string]string {
+	if headers, ok := b.routeHeaders[ctx.MatchedRoute]; ok {
+		return headers
+	}
+
+	if val, ok := ctx.RouteMeta(MetaKey); ok {
+		if headers, ok := val.(map[string]string); ok {
+			return headers
+		}
+	}
+	return nil
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		hstsMaxAge:            365 * 24 * time.Hour,
+		hstsIncludeSubdomains: true,
+		frameOptions:          "DENY",
+		contentTypeNosniff:    true,
+		referrerPolicy:        "strict-origin-when-cross-origin",
+		coop:                  "same-origin",
+		routeHeaders:          make(map[string]map[string]string),
+	}
+}
+
+func redirectToHTTPS(ctx *easyweb.Context) {
+	target := "https://" + ctx.Host() + ctx.Req.URL.RequestURI()
+	ctx.Resp.Header().Set("Location", target)
+	ctx.StatusCode = http.StatusPermanentRedirect
+}
+
+// nonce returns the nonce of the request, generates one on the first call.
+func nonce(ctx *easyweb.Context) string {
+	if n := Nonce(ctx); n != "" {
+		return n
+	}
+
+	bs := make([]byte, 16)
+	_, _ = rand.Read(bs)
+	n := base64.StdEncoding.EncodeToString(bs)
+
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[userValueKey] = n
+	return n
+}
+
+// Nonce returns the nonce of the Content-Security-Policy of the request,
+// empty if the policy has no NoncePlaceholder.
+func Nonce(ctx *easyweb.Context) string {
+	n, _ := ctx.UserValues[userValueKey].(string)
+	return n
+}
+
+// NonceAttr returns the nonce attribute of the request,
+// pass it to the template data and put it in the tags, e.g. <script {{ .NonceAttr }}>.
+func NonceAttr(ctx *easyweb.Context) template.HTMLAttr {
+	n := Nonce(ctx)
+	if n == "" {
+		return ""
+	}
+	return template.HTMLAttr(`nonce="` + template.HTMLEscapeString(n) + `"`)
+}
@@ -0,0 +1,203 @@
+package secure
+
+import (
+	"crypto/tls"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	tcs := []struct {
+		name        string
+		builder     func() *MiddlewareBuilder
+		path        string
+		tls         bool
+		wantCode    int
+		wantHeaders map[string]string
+	}{
+		{
+			name:     "defaults over http",
+			builder:  NewMiddlewareBuilder,
+			path:     "/user",
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-Frame-Options":            "DENY",
+				"X-Content-Type-Options":     "nosniff",
+				"Referrer-Policy":            "strict-origin-when-cross-origin",
+				"Cross-Origin-Opener-Policy": "same-origin",
+				"Strict-Transport-Security":  "",
+				"Content-Security-Policy":    "",
+				"Permissions-Policy":         "",
+			},
+		}, {
+			name:     "defaults over https",
+			builder:  NewMiddlewareBuilder,
+			path:     "/user",
+			tls:      true,
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			},
+		}, {
+			name: "customized",
+			builder: func() *MiddlewareBuilder {
+				return NewMiddlewareBuilder().
+					WithHSTS(time.Hour, false, true).
+					WithCSP("default-src 'self'").
+					WithCSPReportOnly(true).
+					WithFrameOptions("SAMEORIGIN").
+					WithContentTypeNosniff(false).
+					WithReferrerPolicy("no-referrer").
+					WithPermissionsPolicy("camera=()").
+					WithCrossOriginOpenerPolicy("").
+					WithCrossOriginEmbedderPolicy("require-corp")
+			},
+			path:     "/user",
+			tls:      true,
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Strict-Transport-Security":           "max-age=3600; preload",
+				"Content-Security-Policy":             "",
+				"Content-Security-Policy-Report-Only": "default-src 'self'",
+				"X-Frame-Options":                     "SAMEORIGIN",
+				"X-Content-Type-Options":              "",
+				"Referrer-Policy":                     "no-referrer",
+				"Permissions-Policy":                  "camera=()",
+				"Cross-Origin-Opener-Policy":          "",
+				"Cross-Origin-Embedder-Policy":        "require-corp",
+			},
+		}, {
+			name: "route override",
+			builder: func() *MiddlewareBuilder {
+				return NewMiddlewareBuilder().WithRouteHeaders("/widget/:id", map[string]string{
+					"X-Frame-Options":         "",
+					"Content-Security-Policy": "frame-ancestors https://example.com",
+				})
+			},
+			path:     "/widget/1",
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-Frame-Options":         "",
+				"Content-Security-Policy": "frame-ancestors https://example.com",
+				"X-Content-Type-Options":  "nosniff",
+			},
+		}, {
+			name:     "group override",
+			builder:  NewMiddlewareBuilder,
+			path:     "/embed/user",
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-Frame-Options": "SAMEORIGIN",
+			},
+		}, {
+			name: "https redirect",
+			builder: func() *MiddlewareBuilder {
+				return NewMiddlewareBuilder().WithHTTPSRedirect(true)
+			},
+			path:     "/user?id=1",
+			wantCode: http.StatusPermanentRedirect,
+			wantHeaders: map[string]string{
+				"Location":        "https://example.com/user?id=1",
+				"X-Frame-Options": "",
+			},
+		}, {
+			name: "https no redirect",
+			builder: func() *MiddlewareBuilder {
+				return NewMiddlewareBuilder().WithHTTPSRedirect(true)
+			},
+			path:     "/user?id=1",
+			tls:      true,
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Location":        "",
+				"X-Frame-Options": "DENY",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := easyweb.NewHttpServer()
+			svr.Use(tc.builder().Build())
+
+			hdlFunc := func(ctx *easyweb.Context) { _ = ctx.Ok() }
+			svr.Get("/user", hdlFunc)
+			svr.Get("/widget/:id", hdlFunc)
+			svr.Group("/embed").WithMeta(MetaKey, map[string]string{"X-Frame-Options": "SAMEORIGIN"}).Get("/user", hdlFunc)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for key, val := range tc.wantHeaders {
+				assert.Equal(t, val, recorder.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_nonce(t *testing.T) {
+	tpl, err := template.New("page").Parse(`<script {{ .NonceAttr }}>alert(1)</script>`)
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer(easyweb.ServerWithTplEngineOpt(&easyweb.GoTemplateEngine{T: tpl}))
+	svr.Use(NewMiddlewareBuilder().WithCSP("script-src 'self' 'nonce-{nonce}'; style-src 'nonce-{nonce}'").Build())
+	svr.Get("/", func(ctx *easyweb.Context) {
+		_ = ctx.Render("page", map[string]any{"NonceAttr": NonceAttr(ctx)})
+	})
+
+	nonces := make(map[string]struct{})
+	for range 2 {
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		csp := recorder.Header().Get("Content-Security-Policy")
+		matches := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(csp)
+		require.Len(t, matches, 2)
+		n := matches[1]
+
+		assert.Equal(t, "script-src 'self' 'nonce-"+n+"'; style-src 'nonce-"+n+"'", csp)
+		assert.Equal(t, `<script nonce="`+n+`">alert(1)</script>`, recorder.Body.String())
+		nonces[n] = struct{}{}
+	}
+
+	// a fresh nonce for every request
+	assert.Len(t, nonces, 2)
+}
+
+func TestMiddlewareBuilder_Build_trustedProxy(t *testing.T) {
+	// the remote address of httptest
+	svr := easyweb.NewHttpServer(easyweb.ServerWithTrustedProxiesOpt("192.0.2.1"))
+	svr.Use(NewMiddlewareBuilder().WithHTTPSRedirect(true).Build())
+	svr.Get("/user", func(ctx *easyweb.Context) { _ = ctx.Ok() })
+
+	serve := func(proto string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user?id=1", nil)
+		req.Header.Set("X-Forwarded-Proto", proto)
+		req.Header.Set("X-Forwarded-Host", "api.example.com")
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("https")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Strict-Transport-Security"))
+
+	recorder = serve("http")
+	assert.Equal(t, http.StatusPermanentRedirect, recorder.Code)
+	assert.Equal(t, "https://api.example.com/user?id=1", recorder.Header().Get("Location"))
+}
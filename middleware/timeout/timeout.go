@@ -0,0 +1,252 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// MetaKey is the route metadata key to override the timeout of a group's routes,
+// the value must be a time.Duration.
+const MetaKey = "timeout"
+
+// PanicError is re-panicked in the serving goroutine when the handler panics,
+// so the stack trace of the handler's goroutine is not lost.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the handler's goroutine when panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", e.Value, e.Stack)
+}
+
+// PanicValue returns the value passed to panic, see the recovery middleware.
+func (e *PanicError) PanicValue() any {
+	return e.Value
+}
+
+// PanicStack returns the stack trace of the handler's goroutine, see the recovery middleware.
+func (e *PanicError) PanicStack() []byte {
+	return e.Stack
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// MiddlewareBuilder sets a deadline for the request.
+// The handler runs in its own goroutine, when the deadline is exceeded the request is answered at once
+// and anything the handler writes afterward is discarded.
+type MiddlewareBuilder struct {
+	timeout       time.Duration
+	routeTimeouts map[string]time.Duration
+	statusCode    int
+	errMsg        string
+	logFunc       func(ctx *easyweb.Context, err error)
+}
+
+// WithTimeout the default timeout of the requests.
+// defaults to 5s, a non-positive timeout disables the deadline.
+func (b *MiddlewareBuilder) WithTimeout(timeout time.Duration) *MiddlewareBuilder {
+	b.timeout = timeout
+	return b
+}
+
+// WithRouteTimeout overrides the timeout of the route, the route is the registered pattern ( e.g. /order/:id ).
+func (b *MiddlewareBuilder) WithRouteTimeout(route string, timeout time.Duration) *MiddlewareBuilder {
+	b.routeTimeouts[route] = timeout
+	return b
+}
+
+// WithStatusCode the code returns to the front end when timed out.
+// defaults to 503.
+func (b *MiddlewareBuilder) WithStatusCode(statusCode int) *MiddlewareBuilder {
+	b.statusCode = statusCode
+	return b
+}
+
+// WithErrMsg the error message returns to the front end when timed out.
+// defaults to "Service Unavailable"
+func (b *MiddlewareBuilder) WithErrMsg(errMsg string) *MiddlewareBuilder {
+	b.errMsg = errMsg
+	return b
+}
+
+// WithLogFunc logs the panic of a handler after the request timed out, which is not able to be re-panicked.
+// defaults to log.Printf.
+func (b *MiddlewareBuilder) WithLogFunc(logFunc func(ctx *easyweb.Context, err error)) *MiddlewareBuilder {
+	b.logFunc = logFunc
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() easyweb.Middleware {
+	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			timeout := b.getTimeout(ctx)
+			if timeout <= 0 {
+				next(ctx)
+				return
+			}
+
+			timeoutCtx, cancel := context.WithTimeout(ctx.TraceCtx, timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{
+				header: ctx.Resp.Header().Clone(),
+			}
+
+			hdlCtx := ctx.Clone()
+			hdlCtx.Resp = tw
+			hdlCtx.TraceCtx = timeoutCtx
+			hdlCtx.Req = ctx.Req.WithContext(timeoutCtx)
+
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+			go func() {
+				defer func() {
+					p := recover()
+					if p == nil {
+						return
+					}
+
+					if p != http.ErrAbortHandler {
+						p = &PanicError{Value: p, Stack: debug.Stack()}
+					}
+
+					tw.mu.Lock()
+					defer tw.mu.Unlock()
+
+					if tw.timedOut {
+						b.logFunc(hdlCtx, p.(error))
+						return
+					}
+					panicChan <- p
+				}()
+
+				next(hdlCtx)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// re-panic in the serving goroutine, so the recovery middleware is able to handle it
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				resp, traceCtx, req := ctx.Resp, ctx.TraceCtx, ctx.Req
+				*ctx = *hdlCtx
+				ctx.Resp, ctx.TraceCtx, ctx.Req = resp, traceCtx, req
+
+				tw.flush(resp)
+			case <-timeoutCtx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				tw.timedOut = true
+				ctx.StatusCode = b.statusCode
+				ctx.Data = []byte(b.errMsg)
+
+				// the handler panicked just as the request timed out
+				select {
+				case p := <-panicChan:
+					b.logFunc(hdlCtx, p.(error))
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) getTimeout(ctx *easyweb.Context) time.Duration {
+	if timeout, ok := b.routeTimeouts[ctx.MatchedRoute]; ok {
+		return timeout
+	}
+
+	if val, ok := ctx.RouteMeta(MetaKey); ok {
+		if timeout, ok := val.(time.Duration); ok {
+			return timeout
+		}
+	}
+
+	return b.timeout
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		timeout:       5 * time.Second,
+		routeTimeouts: make(map[string]time.Duration),
+		statusCode:    http.StatusServiceUnavailable,
+		errMsg:        "Service Unavailable",
+		logFunc: func(ctx *easyweb.Context, err error) {
+			log.Printf("timeout handler panicked after timed out in path %s: %v", ctx.Req.URL.Path, err)
+		},
+	}
+}
+
+var _ http.ResponseWriter = (*timeoutWriter)(nil)
+
+// timeoutWriter buffers what the handler writes to the response directly,
+// the buffered response is discarded if the handler times out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(bs []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.buf.Write(bs)
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = statusCode
+}
+
+// flush writes the buffered response to w, the caller must hold the lock.
+func (tw *timeoutWriter) flush(w http.ResponseWriter) {
+	dst := w.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	maps.Copy(dst, tw.header)
+
+	if tw.code != 0 {
+		w.WriteHeader(tw.code)
+	}
+
+	if tw.buf.Len() > 0 {
+		_, _ = w.Write(tw.buf.Bytes())
+	}
+}
@@ -0,0 +1,161 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	mw := NewMiddlewareBuilder().
+		WithTimeout(50*time.Millisecond).
+		WithRouteTimeout("/slow/:id", 200*time.Millisecond).
+		WithStatusCode(http.StatusGatewayTimeout).
+		WithErrMsg("timeout").
+		Build()
+
+	lateWrite := make(chan error, 1)
+	svr.Get("/sleep", func(ctx *easyweb.Context) {
+		<-ctx.TraceCtx.Done()
+		assert.ErrorIs(t, ctx.Req.Context().Err(), ctx.TraceCtx.Err())
+
+		time.Sleep(10 * time.Millisecond)
+		ctx.Resp.Header().Set("X-Late", "true")
+		_, err := ctx.Resp.Write([]byte("late"))
+		_ = ctx.RespBytes(http.StatusOK, []byte("late"))
+		lateWrite <- err
+	}, mw)
+
+	svr.Get("/slow/:id", func(ctx *easyweb.Context) {
+		time.Sleep(100 * time.Millisecond)
+		id, _ := ctx.PathParam("id").String()
+		ctx.Resp.Header().Set("X-Id", id)
+		_ = ctx.RespBytes(http.StatusOK, []byte("slow"))
+	}, mw)
+
+	svr.Get("/fast", func(ctx *easyweb.Context) {
+		_, ok := ctx.TraceCtx.Deadline()
+		assert.True(t, ok)
+
+		ctx.UserValues = map[string]any{"fast": true}
+		_ = ctx.RespBytes(http.StatusCreated, []byte("fast"))
+	}, mw, func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return next
+	})
+
+	svr.Get("/panic", func(ctx *easyweb.Context) {
+		panic("boom")
+	}, func(next easyweb.HandleFunc) easyweb.HandleFunc {
+		return func(ctx *easyweb.Context) {
+			defer func() {
+				if p := recover(); p != nil {
+					// the stack trace of the handler is kept
+					var panicErr *PanicError
+					if assert.ErrorAs(t, p.(error), &panicErr) {
+						assert.Equal(t, "boom", panicErr.Value)
+						assert.Contains(t, string(panicErr.Stack), "timeout.TestMiddlewareBuilder_Build.func")
+					}
+					_ = ctx.RespBytes(http.StatusInternalServerError, []byte("recovered"))
+				}
+			}()
+			next(ctx)
+		}
+	}, mw)
+
+	tcs := []struct {
+		name       string
+		path       string
+		wantCode   int
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name:     "timed out",
+			path:     "/sleep",
+			wantCode: http.StatusGatewayTimeout,
+			wantBody: "timeout",
+		}, {
+			name:       "route override",
+			path:       "/slow/1",
+			wantCode:   http.StatusOK,
+			wantBody:   "slow",
+			wantHeader: "1",
+		}, {
+			name:     "in time",
+			path:     "/fast",
+			wantCode: http.StatusCreated,
+			wantBody: "fast",
+		}, {
+			name:     "panic",
+			path:     "/panic",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "recovered",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantHeader, recorder.Header().Get("X-Id"))
+			assert.Empty(t, recorder.Header().Get("X-Late"))
+		})
+	}
+
+	assert.ErrorIs(t, <-lateWrite, http.ErrHandlerTimeout)
+}
+
+func TestMiddlewareBuilder_Build_latePanic(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	logged := make(chan error, 1)
+	mw := NewMiddlewareBuilder().
+		WithTimeout(20 * time.Millisecond).
+		WithLogFunc(func(ctx *easyweb.Context, err error) {
+			logged <- err
+		}).
+		Build()
+	svr.Get("/late", func(ctx *easyweb.Context) {
+		<-ctx.TraceCtx.Done()
+		panic("late boom")
+	}, mw)
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/late", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	select {
+	case err := <-logged:
+		var panicErr *PanicError
+		assert.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "late boom", panicErr.Value)
+	case <-time.After(time.Second):
+		t.Fatal("the late panic is not logged")
+	}
+}
+
+func TestMiddlewareBuilder_Build_meta(t *testing.T) {
+	svr := easyweb.NewHttpServer()
+
+	rg := svr.Group("/report", NewMiddlewareBuilder().Build()).WithMeta(MetaKey, 20*time.Millisecond)
+	rg.Get("/export", func(ctx *easyweb.Context) {
+		<-ctx.TraceCtx.Done()
+	})
+
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/report/export", nil))
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "Service Unavailable", recorder.Body.String())
+}
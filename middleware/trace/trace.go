@@ -1,25 +1,64 @@
 package trace
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
 	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/internal/httpmethod"
+	"github.com/JrMarcco/easy-web/internal/respwriter"
+	"github.com/JrMarcco/easy-web/middleware/requestid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const defaultInstrumentationName = "github.com/JrMarcco/easy-web/middleware/trace"
 
+// MiddlewareBuilder traces the requests by the OpenTelemetry HTTP server semantic conventions.
+// The span is named "{method} {route}" by the registered pattern ( e.g. GET /order/:id ),
+// 5xx responses and panics mark the span as error, and the panics are recorded as exception events.
 type MiddlewareBuilder struct {
 	Tracer trace.Tracer
+
+	propagator      propagation.TextMapPropagator
+	propagateToResp bool
 }
 
 // WithTracer customizes the tracer.
+// defaults to the tracer of the global tracer provider.
 func (b *MiddlewareBuilder) WithTracer(tracer trace.Tracer) *MiddlewareBuilder {
 	b.Tracer = tracer
 	return b
 }
 
+// WithTracerProvider creates the tracer by the provider.
+func (b *MiddlewareBuilder) WithTracerProvider(provider trace.TracerProvider) *MiddlewareBuilder {
+	b.Tracer = provider.Tracer(defaultInstrumentationName)
+	return b
+}
+
+// WithPropagator extracts the trace context from the request and injects it into the response.
+// defaults to the global propagator.
+func (b *MiddlewareBuilder) WithPropagator(propagator propagation.TextMapPropagator) *MiddlewareBuilder {
+	b.propagator = propagator
+	return b
+}
+
+// WithResponsePropagation injects the trace context into the response headers ( e.g. traceparent ),
+// so that the clients are able to refer to the trace.
+// defaults to true.
+func (b *MiddlewareBuilder) WithResponsePropagation(propagate bool) *MiddlewareBuilder {
+	b.propagateToResp = propagate
+	return b
+}
+
 func (b *MiddlewareBuilder) Build() easyweb.Middleware {
 	// if the user did not provide a tracer,
 	// build a default opentelemetry tracer
@@ -27,33 +66,151 @@ func (b *MiddlewareBuilder) Build() easyweb.Middleware {
 		b.Tracer = otel.GetTracerProvider().Tracer(defaultInstrumentationName)
 	}
 
+	propagator := b.propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
 	return func(next easyweb.HandleFunc) easyweb.HandleFunc {
 		return func(ctx *easyweb.Context) {
-			extractCtx := otel.GetTextMapPropagator().Extract(ctx.TraceCtx, propagation.HeaderCarrier(ctx.Req.Header))
-			extractCtx, span := b.Tracer.Start(extractCtx, "unknow", trace.WithAttributes())
+			extractCtx := propagator.Extract(ctx.TraceCtx, propagation.HeaderCarrier(ctx.Req.Header))
 
-			span.SetAttributes(
-				attribute.String("http.method", ctx.Req.Method),
-				attribute.String("http.proto", ctx.Req.Proto),
-				attribute.String("http.host", ctx.Req.Host),
-				attribute.String("http.scheme", ctx.Req.URL.Scheme),
-				attribute.String("http.path", ctx.Req.URL.Path),
+			// the route is matched before the middlewares run
+			spanCtx, span := b.Tracer.Start(
+				extractCtx, spanName(ctx.Req.Method, ctx.MatchedRoute),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(requestAttrs(ctx)...),
 			)
 
-			defer span.End()
+			if b.propagateToResp {
+				propagator.Inject(spanCtx, propagation.HeaderCarrier(ctx.Resp.Header()))
+			}
+
+			resp := ctx.Resp
+			cw := &respwriter.Counting{ResponseWriter: resp}
+			ctx.Resp = cw
+			ctx.TraceCtx = spanCtx
+
+			defer func() {
+				if p := recover(); p != nil {
+					span.RecordError(panicErr(p), trace.WithStackTrace(true))
+					span.SetStatus(codes.Error, "panic")
+					span.SetAttributes(semconv.ErrorTypeKey.String("panic"))
+					span.End()
+
+					// re-panic so that the recovery middleware is able to handle it
+					panic(p)
+				}
+				span.End()
+			}()
 
-			ctx.TraceCtx = extractCtx
 			next(ctx)
+			ctx.Resp = resp
+
+			status := ctx.StatusCode
+			if status == 0 {
+				status = cw.Code
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
 
-			if ctx.MatchedRoute != "" {
-				span.SetName(ctx.MatchedRoute)
+			span.SetAttributes(
+				semconv.HTTPResponseStatusCode(status),
+				semconv.HTTPResponseBodySize(int(cw.Written)+len(ctx.Data)),
+			)
+			if status >= http.StatusInternalServerError {
+				// only the 5xx responses are errors of the server span
+				span.SetStatus(codes.Error, http.StatusText(status))
+				span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(status)))
 			}
 
-			span.SetAttributes(attribute.Int("http.status_code", ctx.StatusCode))
+			// the request id middleware may run either before or after this one
+			if id, ok := requestid.FromContext(ctx.TraceCtx); ok {
+				span.SetAttributes(attribute.String("http.request_id", id))
+			}
 		}
 	}
 }
 
 func NewMiddlewareBuilder() *MiddlewareBuilder {
-	return &MiddlewareBuilder{}
+	return &MiddlewareBuilder{
+		propagateToResp: true,
+	}
+}
+
+func spanName(method string, route string) string {
+	if !httpmethod.Known(method) {
+		method = "HTTP"
+	}
+
+	if route == "" {
+		return method
+	}
+	return method + " " + route
+}
+
+func requestAttrs(ctx *easyweb.Context) []attribute.KeyValue {
+	req := ctx.Req
+	attrs := make([]attribute.KeyValue, 0, 12)
+
+	if httpmethod.Known(req.Method) {
+		attrs = append(attrs, semconv.HTTPRequestMethodKey.String(req.Method))
+	} else {
+		attrs = append(attrs, semconv.HTTPRequestMethodOther, semconv.HTTPRequestMethodOriginal(req.Method))
+	}
+
+	attrs = append(attrs,
+		semconv.URLScheme(ctx.Scheme()),
+		semconv.URLPath(req.URL.Path),
+		semconv.NetworkProtocolVersion(fmt.Sprintf("%d.%d", req.ProtoMajor, req.ProtoMinor)),
+	)
+
+	if ctx.MatchedRoute != "" {
+		attrs = append(attrs, semconv.HTTPRoute(ctx.MatchedRoute))
+	}
+
+	if host, port := splitHostPort(ctx.Host()); host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if port > 0 {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+
+	if clientIP := ctx.ClientIP(); clientIP != "" {
+		attrs = append(attrs, semconv.ClientAddress(clientIP))
+	}
+	if host, port := splitHostPort(req.RemoteAddr); host != "" {
+		attrs = append(attrs, semconv.NetworkPeerAddress(host))
+		if port > 0 {
+			attrs = append(attrs, semconv.NetworkPeerPort(port))
+		}
+	}
+
+	if ua := req.UserAgent(); ua != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(ua))
+	}
+
+	if req.ContentLength > 0 {
+		attrs = append(attrs, semconv.HTTPRequestBodySize(int(req.ContentLength)))
+	}
+	return attrs
+}
+
+// splitHostPort splits the address, the port is 0 if absent.
+func splitHostPort(addr string) (string, int) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return strings.Trim(addr, "[]"), 0
+	}
+
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func panicErr(p any) error {
+	if err, ok := p.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", p)
 }
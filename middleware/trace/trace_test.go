@@ -0,0 +1,196 @@
+package trace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/JrMarcco/easy-web/middleware/recovery"
+	"github.com/JrMarcco/easy-web/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newServer(t *testing.T) (*easyweb.HttpServer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	svr := easyweb.NewHttpServer()
+	svr.Use(
+		recovery.NewMiddlewareBuilder().WithPanicLogFunc(func(ctx *easyweb.Context, p *recovery.Panic) {}).Build(),
+		NewMiddlewareBuilder().
+			WithTracerProvider(provider).
+			WithPropagator(propagation.TraceContext{}).
+			Build(),
+		requestid.NewMiddlewareBuilder().Build(),
+	)
+
+	svr.Get("/order/:id", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("order"))
+	})
+	svr.Post("/order", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusBadRequest, nil)
+	})
+	svr.Get("/error", func(ctx *easyweb.Context) {
+		_ = ctx.RespBytes(http.StatusServiceUnavailable, nil)
+	})
+	svr.Get("/panic", func(ctx *easyweb.Context) {
+		panic("boom")
+	})
+	return svr, exporter
+}
+
+func attrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	svr, exporter := newServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/order/1?x=1", nil)
+	req.RemoteAddr = "10.0.0.1:5678"
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set(requestid.DefaultHeader, "req-1")
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+
+	assert.Equal(t, "GET /order/:id", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, codes.Unset, span.Status.Code)
+
+	got := attrs(span)
+	assert.Equal(t, "GET", got[semconv.HTTPRequestMethodKey].AsString())
+	assert.Equal(t, "/order/:id", got[semconv.HTTPRouteKey].AsString())
+	assert.Equal(t, "/order/1", got[semconv.URLPathKey].AsString())
+	assert.Equal(t, "http", got[semconv.URLSchemeKey].AsString())
+	assert.Equal(t, "example.com", got[semconv.ServerAddressKey].AsString())
+	assert.Equal(t, int64(8080), got[semconv.ServerPortKey].AsInt64())
+	assert.Equal(t, "10.0.0.1", got[semconv.ClientAddressKey].AsString())
+	assert.Equal(t, "curl/8.0", got[semconv.UserAgentOriginalKey].AsString())
+	assert.Equal(t, "1.1", got[semconv.NetworkProtocolVersionKey].AsString())
+	assert.Equal(t, int64(200), got[semconv.HTTPResponseStatusCodeKey].AsInt64())
+	assert.Equal(t, int64(len("order")), got[semconv.HTTPResponseBodySizeKey].AsInt64())
+	assert.Equal(t, "req-1", got["http.request_id"].AsString())
+
+	// the trace context is injected into the response
+	sc := propagation.TraceContext{}.Extract(t.Context(), propagation.HeaderCarrier(recorder.Header()))
+	assert.Equal(t, span.SpanContext.TraceID(), trace.SpanContextFromContext(sc).TraceID())
+	assert.Equal(t, span.SpanContext.SpanID(), trace.SpanContextFromContext(sc).SpanID())
+}
+
+func TestMiddlewareBuilder_Build_status(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		target     string
+		wantName   string
+		wantStatus int
+		wantCode   codes.Code
+		wantError  string
+		wantRoute  string
+	}{
+		{
+			name:       "client error",
+			method:     http.MethodPost,
+			target:     "/order",
+			wantName:   "POST /order",
+			wantRoute:  "/order",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   codes.Unset,
+		},
+		{
+			name:       "server error",
+			method:     http.MethodGet,
+			target:     "/error",
+			wantName:   "GET /error",
+			wantRoute:  "/error",
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   codes.Error,
+			wantError:  "503",
+		},
+		{
+			name:       "not found",
+			method:     http.MethodGet,
+			target:     "/missing",
+			wantName:   "GET",
+			wantStatus: http.StatusNotFound,
+			wantCode:   codes.Unset,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svr, exporter := newServer(t)
+			svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.target, nil))
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 1)
+
+			assert.Equal(t, tc.wantName, spans[0].Name)
+			assert.Equal(t, tc.wantCode, spans[0].Status.Code)
+
+			got := attrs(spans[0])
+			assert.Equal(t, int64(tc.wantStatus), got[semconv.HTTPResponseStatusCodeKey].AsInt64())
+			assert.Equal(t, tc.wantError, got[semconv.ErrorTypeKey].AsString())
+			assert.Equal(t, tc.wantRoute, got[semconv.HTTPRouteKey].AsString())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_panic(t *testing.T) {
+	svr, exporter := newServer(t)
+
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	// the recovery middleware still handles the panic
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "panic", attrs(spans[0])[semconv.ErrorTypeKey].AsString())
+
+	require.Len(t, spans[0].Events, 1)
+	event := spans[0].Events[0]
+	assert.Equal(t, semconv.ExceptionEventName, event.Name)
+
+	eventAttrs := make(map[attribute.Key]string, len(event.Attributes))
+	for _, kv := range event.Attributes {
+		eventAttrs[kv.Key] = kv.Value.AsString()
+	}
+	assert.Equal(t, "boom", eventAttrs[semconv.ExceptionMessageKey])
+	assert.True(t, strings.Contains(eventAttrs[semconv.ExceptionStacktraceKey], "trace.TestMiddlewareBuilder_Build_panic"))
+}
+
+func TestMiddlewareBuilder_Build_parent(t *testing.T) {
+	svr, exporter := newServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	svr.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.True(t, spans[0].Parent.IsRemote())
+}
@@ -0,0 +1,22 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiskSpaceChecker checks that the file system of the path has at least minFree bytes available,
+// e.g. the destination directory of easyweb.FileUploader.
+func DiskSpaceChecker(path string, minFree uint64) Checker {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+
+		if free < minFree {
+			return fmt.Errorf("[ops] %d bytes available on %s, less than %d", free, path, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package ops
+
+import (
+	"errors"
+)
+
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("[ops] disk space check is not supported on this platform")
+}
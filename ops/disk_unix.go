@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package ops
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskFree returns the bytes available to an unprivileged user.
+func diskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("[ops] failed to stat file system of %s: %w", path, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,258 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Router registers the routes, e.g. *easyweb.HttpServer or *easyweb.RouteGroup.
+type Router interface {
+	Route(method string, path string, hdl easyweb.HandleFunc, mws ...easyweb.Middleware)
+}
+
+var (
+	_ Router = (*easyweb.HttpServer)(nil)
+	_ Router = (*easyweb.RouteGroup)(nil)
+)
+
+// Checker checks a dependency of the service, a nil error means healthy.
+type Checker func(ctx context.Context) error
+
+// Pinger is a dependency able to be pinged, e.g. *redis.RStore.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingChecker checks the dependency by pinging it.
+func PingChecker(p Pinger) Checker {
+	return p.Ping
+}
+
+// Report is the aggregated status of the checks.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the result of a check.
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type namedChecker struct {
+	name    string
+	checker Checker
+}
+
+// Endpoints serves the operational endpoints:
+//   - /healthz, the liveness checks
+//   - /readyz, the readiness checks
+//   - /debug/pprof/*, the runtime profiles, if enabled by EndpointsWithPprof
+//
+// The checks run concurrently and are answered as a JSON Report, with 503 if any check fails.
+// The endpoints are better served by a separate listener ( see AdminServer ), so that they are not exposed publicly.
+type Endpoints struct {
+	liveness  []namedChecker
+	readiness []namedChecker
+	timeout   time.Duration
+	pprof     bool
+}
+
+type EndpointsOpt func(*Endpoints)
+
+// EndpointsWithLivenessChecker adds a check to /healthz,
+// a failed liveness check means the service should be restarted.
+func EndpointsWithLivenessChecker(name string, checker Checker) EndpointsOpt {
+	return func(e *Endpoints) {
+		e.liveness = append(e.liveness, namedChecker{name: name, checker: checker})
+	}
+}
+
+// EndpointsWithReadinessChecker adds a check to /readyz,
+// a failed readiness check means the service should not receive traffic, e.g. redis is unreachable.
+func EndpointsWithReadinessChecker(name string, checker Checker) EndpointsOpt {
+	return func(e *Endpoints) {
+		e.readiness = append(e.readiness, namedChecker{name: name, checker: checker})
+	}
+}
+
+// EndpointsWithTimeout the timeout of a round of checks.
+// defaults to 5s.
+func EndpointsWithTimeout(timeout time.Duration) EndpointsOpt {
+	return func(e *Endpoints) {
+		e.timeout = timeout
+	}
+}
+
+// EndpointsWithPprof serves /debug/pprof/*, which exposes the command line and the memory contents,
+// enable it only on a listener not exposed publicly ( see AdminServer ).
+// defaults to false.
+func EndpointsWithPprof(enabled bool) EndpointsOpt {
+	return func(e *Endpoints) {
+		e.pprof = enabled
+	}
+}
+
+func NewEndpoints(opts ...EndpointsOpt) *Endpoints {
+	e := &Endpoints{
+		timeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Register registers the endpoints to the router.
+func (e *Endpoints) Register(r Router) {
+	r.Route(http.MethodGet, "/healthz", e.handleChecks(e.liveness))
+	r.Route(http.MethodGet, "/readyz", e.handleChecks(e.readiness))
+
+	if e.pprof {
+		r.Route(http.MethodGet, "/debug/pprof", handlePprof)
+		r.Route(http.MethodGet, "/debug/pprof/*", handlePprof)
+		r.Route(http.MethodPost, "/debug/pprof/symbol", handlePprof)
+	}
+}
+
+// AdminServer returns a server serving only the endpoints, e.g. on an internal port:
+//
+//	go func() { _ = endpoints.AdminServer(":9090").Start() }()
+func (e *Endpoints) AdminServer(addr string) *easyweb.HttpServer {
+	svr := easyweb.NewHttpServer(easyweb.ServerWithAddrOpt(addr))
+	e.Register(svr)
+	return svr
+}
+
+// check runs the checks concurrently and aggregates the results.
+func check(ctx context.Context, checkers []namedChecker) Report {
+	report := Report{Status: StatusOK}
+	if len(checkers) == 0 {
+		return report
+	}
+
+	results := make([]CheckResult, len(checkers))
+
+	var wg sync.WaitGroup
+	for i, nc := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, nc.checker)
+		}()
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]CheckResult, len(checkers))
+	for i, nc := range checkers {
+		report.Checks[nc.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// runCheck runs the checker, a checker ignoring the context is abandoned when the context is done.
+func runCheck(ctx context.Context, checker Checker) CheckResult {
+	start := time.Now()
+
+	errChan := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errChan <- panicError{val: p}
+			}
+		}()
+		errChan <- checker(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (e *Endpoints) handleChecks(checkers []namedChecker) easyweb.HandleFunc {
+	return func(ctx *easyweb.Context) {
+		checkCtx, cancel := context.WithTimeout(ctx.Req.Context(), e.timeout)
+		defer cancel()
+
+		report := check(checkCtx, checkers)
+
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		bs, _ := json.Marshal(report)
+		ctx.Resp.Header().Set("Content-Type", "application/json")
+		ctx.Resp.Header().Set("Cache-Control", "no-store")
+		_ = ctx.RespBytes(code, bs)
+	}
+}
+
+// handlePprof serves the profiles by the last path segment,
+// so that the endpoints also work under the prefix of a route group.
+func handlePprof(ctx *easyweb.Context) {
+	urlPath := ctx.Req.URL.Path
+	if strings.HasSuffix(ctx.MatchedRoute, "/debug/pprof") {
+		if !strings.HasSuffix(urlPath, "/") {
+			// the links of the index are relative
+			http.Redirect(ctx.Resp, ctx.Req, urlPath+"/", http.StatusMovedPermanently)
+			return
+		}
+		pprof.Index(ctx.Resp, ctx.Req)
+		return
+	}
+
+	switch name := path.Base(urlPath); name {
+	case "cmdline":
+		pprof.Cmdline(ctx.Resp, ctx.Req)
+	case "profile":
+		pprof.Profile(ctx.Resp, ctx.Req)
+	case "symbol":
+		pprof.Symbol(ctx.Resp, ctx.Req)
+	case "trace":
+		pprof.Trace(ctx.Resp, ctx.Req)
+	default:
+		pprof.Handler(name).ServeHTTP(ctx.Resp, ctx.Req)
+	}
+}
+
+type panicError struct {
+	val any
+}
+
+func (p panicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.val)
+}
@@ -0,0 +1,140 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	rstore "github.com/JrMarcco/easy-web/session/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, svr *easyweb.HttpServer, method string, target string) (*httptest.ResponseRecorder, Report) {
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+
+	var report Report
+	if recorder.Header().Get("Content-Type") == "application/json" {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	}
+	return recorder, report
+}
+
+func TestEndpoints_checks(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := rstore.NewRStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	svr := NewEndpoints(
+		EndpointsWithTimeout(50*time.Millisecond),
+		EndpointsWithReadinessChecker("redis", PingChecker(store)),
+		EndpointsWithReadinessChecker("disk", DiskSpaceChecker(t.TempDir(), 0)),
+	).AdminServer(":0")
+
+	recorder, report := serve(t, svr, http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, Report{Status: StatusOK}, report)
+
+	recorder, report = serve(t, svr, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["redis"].Status)
+	assert.Equal(t, StatusOK, report.Checks["disk"].Status)
+
+	mr.Close()
+	recorder, report = serve(t, svr, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusFail, report.Checks["redis"].Status)
+	assert.NotEmpty(t, report.Checks["redis"].Error)
+	assert.Equal(t, StatusOK, report.Checks["disk"].Status)
+}
+
+func TestEndpoints_checkFailures(t *testing.T) {
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+
+	svr := NewEndpoints(
+		EndpointsWithTimeout(50*time.Millisecond),
+		EndpointsWithLivenessChecker("error", func(ctx context.Context) error {
+			return errors.New("deadlock detected")
+		}),
+		EndpointsWithLivenessChecker("panic", func(ctx context.Context) error {
+			panic("boom")
+		}),
+		EndpointsWithLivenessChecker("stuck", func(ctx context.Context) error {
+			// ignores the context
+			<-block
+			return nil
+		}),
+		EndpointsWithLivenessChecker("disk", DiskSpaceChecker(t.TempDir(), math.MaxUint64)),
+	).AdminServer(":0")
+
+	recorder, report := serve(t, svr, http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, "deadlock detected", report.Checks["error"].Error)
+	assert.Equal(t, "panic: boom", report.Checks["panic"].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["stuck"].Error)
+	assert.Contains(t, report.Checks["disk"].Error, "less than")
+}
+
+func TestEndpoints_pprof(t *testing.T) {
+	testCases := []struct {
+		name     string
+		register func(svr *easyweb.HttpServer, e *Endpoints)
+		prefix   string
+	}{
+		{
+			name:     "server",
+			register: func(svr *easyweb.HttpServer, e *Endpoints) { e.Register(svr) },
+		},
+		{
+			name:     "group",
+			register: func(svr *easyweb.HttpServer, e *Endpoints) { e.Register(svr.Group("/admin")) },
+			prefix:   "/admin",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := easyweb.NewHttpServer()
+			tc.register(svr, NewEndpoints(EndpointsWithPprof(true)))
+
+			recorder, _ := serve(t, svr, http.MethodGet, tc.prefix+"/debug/pprof")
+			assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+			assert.Equal(t, tc.prefix+"/debug/pprof/", recorder.Header().Get("Location"))
+
+			recorder, _ = serve(t, svr, http.MethodGet, tc.prefix+"/debug/pprof/")
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), "goroutine")
+
+			recorder, _ = serve(t, svr, http.MethodGet, tc.prefix+"/debug/pprof/goroutine?debug=1")
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), "goroutine profile")
+
+			recorder, _ = serve(t, svr, http.MethodGet, tc.prefix+"/debug/pprof/cmdline")
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			recorder, _ = serve(t, svr, http.MethodGet, tc.prefix+"/debug/pprof/unknown")
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+	}
+}
+
+func TestEndpoints_withoutPprof(t *testing.T) {
+	// disabled by default
+	svr := NewEndpoints().AdminServer(":0")
+
+	recorder, _ := serve(t, svr, http.MethodGet, "/debug/pprof/")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Balancer = (*RoundRobinBalancer)(nil)
+	_ Balancer = (*LeastConnBalancer)(nil)
+)
+
+// Upstream is a target of the proxy.
+type Upstream struct {
+	URL *url.URL
+
+	active atomic.Int64
+
+	mu        sync.Mutex
+	fails     int
+	downUntil time.Time
+}
+
+// Active returns the number of the requests in flight to the upstream, including the upgraded connections.
+func (u *Upstream) Active() int64 {
+	return u.active.Load()
+}
+
+// Healthy reports whether the upstream is not marked down by the passive health check.
+func (u *Upstream) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !time.Now().Before(u.downUntil)
+}
+
+// markFailed marks the upstream down for the failTimeout after maxFails consecutive failures.
+func (u *Upstream) markFailed(maxFails int, failTimeout time.Duration) {
+	if maxFails <= 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails++
+	if u.fails >= maxFails {
+		u.fails = 0
+		u.downUntil = time.Now().Add(failTimeout)
+	}
+}
+
+func (u *Upstream) markSucceeded() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails = 0
+}
+
+// Balancer picks the upstream of a request.
+type Balancer interface {
+	// Pick picks one of the upstreams, which are never empty.
+	Pick(upstreams []*Upstream) *Upstream
+}
+
+// RoundRobinBalancer picks the upstreams in turn.
+type RoundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *RoundRobinBalancer) Pick(upstreams []*Upstream) *Upstream {
+	n := b.next.Add(1) - 1
+	return upstreams[n%uint64(len(upstreams))]
+}
+
+func NewRoundRobinBalancer() *RoundRobinBalancer {
+	return &RoundRobinBalancer{}
+}
+
+// LeastConnBalancer picks the upstream with the fewest requests in flight,
+// the ties are broken in turn.
+type LeastConnBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *LeastConnBalancer) Pick(upstreams []*Upstream) *Upstream {
+	start := b.next.Add(1) - 1
+
+	var picked *Upstream
+	for i := range upstreams {
+		u := upstreams[(start+uint64(i))%uint64(len(upstreams))]
+		if picked == nil || u.Active() < picked.Active() {
+			picked = u
+		}
+	}
+	return picked
+}
+
+func NewLeastConnBalancer() *LeastConnBalancer {
+	return &LeastConnBalancer{}
+}
@@ -0,0 +1,460 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+)
+
+// Proxy is a reverse proxy handler forwarding the requests to the upstreams, e.g.
+//
+//	p, err := proxy.NewProxy([]string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+//		proxy.ProxyWithRewrite("/v2/users/:id"))
+//	svr.Get("/users/:id", p.Handle)
+//
+// The upgraded connections ( e.g. WebSocket ) and the streaming responses ( e.g. Server-Sent Events ) are passed through.
+// The response of the upstream is written to Context.Resp directly, the errors of the proxy are set to Context.Data.
+type Proxy struct {
+	rp        *httputil.ReverseProxy
+	upstreams []*Upstream
+	balancer  Balancer
+	transport http.RoundTripper
+
+	rewrite      string
+	preserveHost bool
+	reqHeaders   map[string]string
+	respHeaders  map[string]string
+	modifyResp   func(resp *http.Response) error
+
+	retries      int
+	maxFails     int
+	failTimeout  time.Duration
+	failStatuses []int
+
+	flushInterval time.Duration
+	logFunc       func(ctx *easyweb.Context, err error)
+}
+
+type ProxyOpt func(*Proxy)
+
+// ProxyWithBalancer the balancer picking the upstream of a request.
+// defaults to RoundRobinBalancer.
+func ProxyWithBalancer(balancer Balancer) ProxyOpt {
+	return func(p *Proxy) {
+		p.balancer = balancer
+	}
+}
+
+// ProxyWithTransport the transport to the upstreams.
+// defaults to http.DefaultTransport.
+func ProxyWithTransport(transport http.RoundTripper) ProxyOpt {
+	return func(p *Proxy) {
+		p.transport = transport
+	}
+}
+
+// ProxyWithRewrite the path template of the upstream requests, which is joined to the path of the upstream url.
+// A ":name" segment is replaced by the path param of the name,
+// a trailing "*" segment is replaced by the rest of the path matched by the wildcard of the route, e.g.
+//
+//	"/v2/users/:id" for the route /users/:id
+//	"/*" for the route /api/* to strip the /api prefix
+//
+// defaults to the path of the request.
+func ProxyWithRewrite(template string) ProxyOpt {
+	return func(p *Proxy) {
+		p.rewrite = template
+	}
+}
+
+// ProxyWithPreserveHost sends the Host header of the request to the upstreams instead of the host of the upstream url.
+// defaults to false.
+func ProxyWithPreserveHost(preserveHost bool) ProxyOpt {
+	return func(p *Proxy) {
+		p.preserveHost = preserveHost
+	}
+}
+
+// ProxyWithRequestHeaders sets the headers of the upstream requests, an empty value removes the header.
+func ProxyWithRequestHeaders(headers map[string]string) ProxyOpt {
+	return func(p *Proxy) {
+		p.reqHeaders = headers
+	}
+}
+
+// ProxyWithResponseHeaders sets the headers of the responses, an empty value removes the header.
+func ProxyWithResponseHeaders(headers map[string]string) ProxyOpt {
+	return func(p *Proxy) {
+		p.respHeaders = headers
+	}
+}
+
+// ProxyWithModifyResponse modifies the responses of the upstreams, an error is answered with 502.
+func ProxyWithModifyResponse(modifyResp func(resp *http.Response) error) ProxyOpt {
+	return func(p *Proxy) {
+		p.modifyResp = modifyResp
+	}
+}
+
+// ProxyWithRetries the times to retry a failed request with another upstream,
+// only the requests of the idempotent methods without a body are retried.
+// defaults to 1.
+func ProxyWithRetries(retries int) ProxyOpt {
+	return func(p *Proxy) {
+		p.retries = retries
+	}
+}
+
+// ProxyWithPassiveHealthCheck marks an upstream down for the failTimeout after maxFails consecutive failed requests,
+// the upstreams down are only picked if all of them are down. A non-positive maxFails disables the check.
+// defaults to 3 failures and 10s.
+func ProxyWithPassiveHealthCheck(maxFails int, failTimeout time.Duration) ProxyOpt {
+	return func(p *Proxy) {
+		p.maxFails = maxFails
+		p.failTimeout = failTimeout
+	}
+}
+
+// ProxyWithFailStatuses the statuses of the upstream responses counted as failures by the passive health check,
+// which are retried with another upstream like the connection errors.
+// defaults to 502, 503 and 504.
+func ProxyWithFailStatuses(statuses ...int) ProxyOpt {
+	return func(p *Proxy) {
+		p.failStatuses = statuses
+	}
+}
+
+// ProxyWithFlushInterval the interval to flush the responses to the client, a negative value flushes on every write.
+// defaults to 0, the streaming responses ( e.g. text/event-stream ) are still flushed on every write.
+func ProxyWithFlushInterval(flushInterval time.Duration) ProxyOpt {
+	return func(p *Proxy) {
+		p.flushInterval = flushInterval
+	}
+}
+
+// ProxyWithLogFunc is called when a request fails to be proxied.
+func ProxyWithLogFunc(logFunc func(ctx *easyweb.Context, err error)) ProxyOpt {
+	return func(p *Proxy) {
+		p.logFunc = logFunc
+	}
+}
+
+// Handle is the easyweb.HandleFunc proxying the request.
+func (p *Proxy) Handle(ctx *easyweb.Context) {
+	rewritten, ok := p.rewritePath(ctx)
+	if !ok {
+		ctx.StatusCode = http.StatusBadRequest
+		ctx.Data = []byte(http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	pc := &proxyCtx{ctx: ctx, path: rewritten}
+	req := ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), proxyCtxKey{}, pc))
+	p.rp.ServeHTTP(ctx.Resp, req)
+}
+
+// Upstreams returns the upstreams of the proxy.
+func (p *Proxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+type proxyCtxKey struct{}
+
+type proxyCtx struct {
+	ctx  *easyweb.Context
+	path string
+}
+
+func getProxyCtx(req *http.Request) *proxyCtx {
+	return req.Context().Value(proxyCtxKey{}).(*proxyCtx)
+}
+
+// rewritePath returns the path of the upstream request by the rewrite template,
+// it reports false if the decoded params climb out of the static prefix of the template, e.g. a %2e%2e segment.
+func (p *Proxy) rewritePath(ctx *easyweb.Context) (string, bool) {
+	if p.rewrite == "" {
+		return ctx.Req.URL.Path, true
+	}
+
+	segs := strings.Split(p.rewrite, "/")
+	static := len(segs)
+	for i, seg := range segs {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			val, _ := ctx.PathParam(seg[1:]).String()
+			if val == "." || val == ".." || strings.Contains(val, "/") {
+				return "", false
+			}
+			segs[i] = val
+		case seg == "*" && i == len(segs)-1:
+			segs[i] = wildcardRest(ctx.MatchedRoute, ctx.Req.URL.Path)
+		default:
+			continue
+		}
+		static = min(static, i)
+	}
+
+	prefix := path.Clean("/" + strings.Join(segs[:static], "/"))
+	rewritten := strings.Join(segs, "/")
+	cleaned := path.Clean("/" + rewritten)
+	if cleaned != prefix && !strings.HasPrefix(cleaned, strings.TrimSuffix(prefix, "/")+"/") {
+		return "", false
+	}
+
+	if !strings.HasPrefix(rewritten, "/") {
+		cleaned = cleaned[1:]
+	}
+	if strings.HasSuffix(rewritten, "/") && !strings.HasSuffix(cleaned, "/") {
+		cleaned += "/"
+	}
+	return cleaned, true
+}
+
+// wildcardRest returns the rest of the path from the trailing wildcard segment of the route.
+func wildcardRest(route string, path string) string {
+	routeSegs := strings.Split(strings.Trim(route, "/"), "/")
+	if len(routeSegs) == 0 || routeSegs[len(routeSegs)-1] != "*" {
+		return ""
+	}
+
+	pathSegs := strings.SplitN(strings.TrimLeft(path, "/"), "/", len(routeSegs))
+	if len(pathSegs) < len(routeSegs) {
+		return ""
+	}
+	return pathSegs[len(pathSegs)-1]
+}
+
+func (p *Proxy) rewriteReq(pr *httputil.ProxyRequest) {
+	pc := getProxyCtx(pr.In)
+
+	// the client resolved through the trusted proxies, see easyweb.ServerWithTrustedProxiesOpt
+	pr.Out.Header.Set("X-Forwarded-For", pc.ctx.ClientIP())
+	pr.Out.Header.Set("X-Forwarded-Host", pc.ctx.Host())
+	pr.Out.Header.Set("X-Forwarded-Proto", pc.ctx.Scheme())
+
+	// the upstream is picked by the transport
+	pr.Out.URL.Path = pc.path
+	pr.Out.URL.RawPath = ""
+	if !p.preserveHost {
+		pr.Out.Host = ""
+	}
+
+	setHeaders(pr.Out.Header, p.reqHeaders)
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	setHeaders(resp.Header, p.respHeaders)
+	if p.modifyResp != nil {
+		return p.modifyResp(resp)
+	}
+	return nil
+}
+
+func (p *Proxy) handleError(_ http.ResponseWriter, req *http.Request, err error) {
+	ctx := getProxyCtx(req).ctx
+	if errors.Is(req.Context().Err(), context.Canceled) {
+		// the client is gone
+		return
+	}
+
+	p.logFunc(ctx, err)
+
+	statusCode := http.StatusBadGateway
+	if errors.Is(err, context.DeadlineExceeded) {
+		statusCode = http.StatusGatewayTimeout
+	}
+	ctx.StatusCode = statusCode
+	ctx.Data = []byte(http.StatusText(statusCode))
+}
+
+// roundTrip sends the request to the picked upstream, retries with another one if it fails.
+func (p *Proxy) roundTrip(req *http.Request) (*http.Response, error) {
+	tried := make([]*Upstream, 0, p.retries+1)
+	var lastErr error
+	for {
+		// the first pick always succeeds, no more upstreams to retry otherwise
+		u := p.pick(tried)
+		if u == nil {
+			return nil, lastErr
+		}
+		tried = append(tried, u)
+
+		outreq := req.Clone(req.Context())
+		outreq.URL.Scheme = u.URL.Scheme
+		outreq.URL.Host = u.URL.Host
+		outreq.URL.Path = joinPath(u.URL.Path, req.URL.Path)
+
+		u.active.Add(1)
+		resp, err := p.transport.RoundTrip(outreq)
+		if err != nil {
+			u.active.Add(-1)
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+
+			u.markFailed(p.maxFails, p.failTimeout)
+			lastErr = fmt.Errorf("[proxy] request %s failed: %w", u.URL.Host, err)
+			if len(tried) <= p.retries && retryable(req) {
+				continue
+			}
+			return nil, lastErr
+		}
+
+		if !slices.Contains(p.failStatuses, resp.StatusCode) {
+			u.markSucceeded()
+		} else {
+			u.markFailed(p.maxFails, p.failTimeout)
+			if len(tried) <= p.retries && len(tried) < len(p.upstreams) && retryable(req) {
+				_ = resp.Body.Close()
+				u.active.Add(-1)
+				continue
+			}
+		}
+
+		resp.Body = newUpstreamBody(resp.Body, func() { u.active.Add(-1) })
+		return resp, nil
+	}
+}
+
+// pick picks an upstream not tried, the healthy ones first.
+func (p *Proxy) pick(tried []*Upstream) *Upstream {
+	candidates := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if !slices.Contains(tried, u) && u.Healthy() {
+			candidates = append(candidates, u)
+		}
+	}
+
+	if len(candidates) == 0 {
+		for _, u := range p.upstreams {
+			if !slices.Contains(tried, u) {
+				candidates = append(candidates, u)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	return p.balancer.Pick(candidates)
+}
+
+// NewProxy proxies the requests to the upstream urls, e.g. http://10.0.0.1:8080/base.
+func NewProxy(targets []string, opts ...ProxyOpt) (*Proxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("[proxy] no upstream")
+	}
+
+	upstreams := make([]*Upstream, 0, len(targets))
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("[proxy] invalid upstream %s: %w", target, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("[proxy] invalid upstream %s: scheme and host required", target)
+		}
+		upstreams = append(upstreams, &Upstream{URL: u})
+	}
+
+	p := &Proxy{
+		upstreams:    upstreams,
+		balancer:     NewRoundRobinBalancer(),
+		transport:    http.DefaultTransport,
+		retries:      1,
+		maxFails:     3,
+		failTimeout:  10 * time.Second,
+		failStatuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		logFunc: func(ctx *easyweb.Context, err error) {
+			log.Printf("proxy failed in path %s: %v", ctx.Req.URL.Path, err)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.rp = &httputil.ReverseProxy{
+		Rewrite:        p.rewriteReq,
+		Transport:      roundTripperFunc(p.roundTrip),
+		FlushInterval:  p.flushInterval,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+	}
+	return p, nil
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// retryable reports whether the request is safe to be sent again.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+func setHeaders(header http.Header, headers map[string]string) {
+	for key, val := range headers {
+		if val == "" {
+			header.Del(key)
+			continue
+		}
+		header.Set(key, val)
+	}
+}
+
+func joinPath(base string, path string) string {
+	if base == "" || base == "/" {
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// newUpstreamBody calls the done once the body is closed,
+// the body of an upgraded connection stays writable.
+func newUpstreamBody(body io.ReadCloser, done func()) io.ReadCloser {
+	ub := &upstreamBody{ReadCloser: body, done: done}
+	if rwc, ok := body.(io.ReadWriteCloser); ok {
+		return &upgradedBody{upstreamBody: ub, w: rwc}
+	}
+	return ub
+}
+
+type upstreamBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *upstreamBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
+type upgradedBody struct {
+	*upstreamBody
+	w io.Writer
+}
+
+func (b *upgradedBody) Write(bs []byte) (int, error) {
+	return b.w.Write(bs)
+}
@@ -0,0 +1,415 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	easyweb "github.com/JrMarcco/easy-web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type echo struct {
+	Name   string      `json:"name"`
+	Host   string      `json:"host"`
+	URI    string      `json:"uri"`
+	Header http.Header `json:"header"`
+}
+
+func newEchoUpstream(t *testing.T, name string) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("Server", "upstream")
+		_ = json.NewEncoder(w).Encode(echo{Name: name, Host: r.Host, URI: r.RequestURI, Header: r.Header})
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func get(t *testing.T, svr http.Handler, target string) (*httptest.ResponseRecorder, echo) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+
+	var e echo
+	if recorder.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &e))
+	}
+	return recorder, e
+}
+
+func TestProxy_Handle(t *testing.T) {
+	upstream := newEchoUpstream(t, "a")
+
+	users, err := NewProxy([]string{upstream.URL + "/base"},
+		ProxyWithRewrite("/v2/accounts/:id"),
+		ProxyWithRequestHeaders(map[string]string{"X-Gateway": "easy-web", "Cookie": ""}),
+		ProxyWithResponseHeaders(map[string]string{"Server": ""}),
+	)
+	require.NoError(t, err)
+
+	api, err := NewProxy([]string{upstream.URL}, ProxyWithRewrite("/*"), ProxyWithPreserveHost(true))
+	require.NoError(t, err)
+
+	plain, err := NewProxy([]string{upstream.URL})
+	require.NoError(t, err)
+
+	// the remote address of httptest
+	svr := easyweb.NewHttpServer(easyweb.ServerWithTrustedProxiesOpt("192.0.2.1"))
+	svr.Get("/users/:id", users.Handle)
+	svr.Get("/api/*", api.Handle)
+	svr.Get("/plain/*", plain.Handle)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/users/1?detail=true", nil)
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var e echo
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &e))
+	assert.Equal(t, "/base/v2/accounts/1?detail=true", e.URI)
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), e.Host)
+	assert.Equal(t, "easy-web", e.Header.Get("X-Gateway"))
+	assert.Empty(t, e.Header.Get("Cookie"))
+	assert.Equal(t, "1.1.1.1", e.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "example.com", e.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "https", e.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "a", recorder.Header().Get("X-Upstream"))
+	assert.Empty(t, recorder.Header().Get("Server"))
+
+	_, e = get(t, svr, "http://example.com/api/orders/1/items?page=2")
+	assert.Equal(t, "/orders/1/items?page=2", e.URI)
+	assert.Equal(t, "example.com", e.Host)
+
+	_, e = get(t, svr, "/plain/orders")
+	assert.Equal(t, "/plain/orders", e.URI)
+}
+
+func TestProxy_traversal(t *testing.T) {
+	upstream := newEchoUpstream(t, "a")
+
+	users, err := NewProxy([]string{upstream.URL + "/base"}, ProxyWithRewrite("/users/:id"))
+	require.NoError(t, err)
+	files, err := NewProxy([]string{upstream.URL}, ProxyWithRewrite("/static/*"))
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/users/:id/profile", users.Handle)
+	svr.Get("/files/*", files.Handle)
+
+	tcs := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantURI  string
+	}{
+		{
+			name:     "param",
+			target:   "/users/%2e%2e/profile",
+			wantCode: http.StatusBadRequest,
+		}, {
+			name:     "wildcard",
+			target:   "/files/%2e%2e/admin",
+			wantCode: http.StatusBadRequest,
+		}, {
+			name:     "wildcard inside the prefix",
+			target:   "/files/css/%2e%2e/js/app.js",
+			wantCode: http.StatusOK,
+			wantURI:  "/static/js/app.js",
+		}, {
+			name:     "trailing slash",
+			target:   "/files/css/",
+			wantCode: http.StatusOK,
+			wantURI:  "/static/css/",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			require.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantURI == "" {
+				return
+			}
+
+			var e echo
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &e))
+			assert.Equal(t, tc.wantURI, e.URI)
+		})
+	}
+}
+
+func TestProxy_balance(t *testing.T) {
+	a, b := newEchoUpstream(t, "a"), newEchoUpstream(t, "b")
+
+	p, err := NewProxy([]string{a.URL, b.URL})
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/", p.Handle)
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		_, e := get(t, svr, "/")
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, names)
+	for _, u := range p.Upstreams() {
+		assert.Zero(t, u.Active())
+	}
+
+	// the least connections
+	lb := NewLeastConnBalancer()
+	upstreams := p.Upstreams()
+	upstreams[0].active.Add(1)
+	for i := 0; i < 4; i++ {
+		assert.Same(t, upstreams[1], lb.Pick(upstreams))
+	}
+	upstreams[0].active.Add(-1)
+	assert.NotSame(t, lb.Pick(upstreams), lb.Pick(upstreams))
+}
+
+func TestProxy_retry(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := newEchoUpstream(t, "up")
+
+	var errs []error
+	p, err := NewProxy([]string{down.URL, up.URL},
+		ProxyWithPassiveHealthCheck(2, time.Minute),
+		ProxyWithLogFunc(func(ctx *easyweb.Context, err error) {
+			errs = append(errs, err)
+		}),
+	)
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/", p.Handle)
+	svr.Post("/", p.Handle)
+
+	post := func() int {
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+		return recorder.Code
+	}
+
+	// retried with the other upstream
+	recorder, e := get(t, svr, "/")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "up", e.Name)
+	assert.True(t, p.Upstreams()[0].Healthy())
+
+	// not retried, the down upstream is marked down after 2 failures
+	assert.Equal(t, http.StatusBadGateway, post())
+	assert.Len(t, errs, 1)
+	assert.False(t, p.Upstreams()[0].Healthy())
+
+	// the down upstream is skipped
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusOK, post())
+	}
+
+	// all down
+	all, err := NewProxy([]string{down.URL}, ProxyWithLogFunc(func(ctx *easyweb.Context, err error) {}))
+	require.NoError(t, err)
+	svr.Get("/all", all.Handle)
+	recorder, _ = get(t, svr, "/all")
+	assert.Equal(t, http.StatusBadGateway, recorder.Code)
+	assert.Equal(t, "Bad Gateway", recorder.Body.String())
+}
+
+func TestProxy_failStatus(t *testing.T) {
+	var hits atomic.Int32
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(unavailable.Close)
+	up := newEchoUpstream(t, "up")
+
+	p, err := NewProxy([]string{unavailable.URL, up.URL}, ProxyWithPassiveHealthCheck(2, time.Minute))
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/", p.Handle)
+
+	// retried with the other upstream, the unavailable upstream is marked down after 2 failures
+	for i := 0; i < 4; i++ {
+		recorder, e := get(t, svr, "/")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "up", e.Name)
+	}
+	assert.Equal(t, int32(2), hits.Load())
+	assert.False(t, p.Upstreams()[0].Healthy())
+	assert.True(t, p.Upstreams()[1].Healthy())
+
+	// the response is passed through without another upstream to retry with
+	single, err := NewProxy([]string{unavailable.URL}, ProxyWithPassiveHealthCheck(5, time.Minute))
+	require.NoError(t, err)
+	svr.Get("/single", single.Handle)
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/single", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "overloaded\n", recorder.Body.String())
+
+	// the statuses are configurable
+	none, err := NewProxy([]string{unavailable.URL}, ProxyWithPassiveHealthCheck(1, time.Minute), ProxyWithFailStatuses())
+	require.NoError(t, err)
+	svr.Get("/none", none.Handle)
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/none", nil))
+	assert.True(t, none.Upstreams()[0].Healthy())
+}
+
+func TestProxy_modifyResponse(t *testing.T) {
+	upstream := newEchoUpstream(t, "a")
+
+	p, err := NewProxy([]string{upstream.URL},
+		ProxyWithModifyResponse(func(resp *http.Response) error {
+			return errors.New("rejected")
+		}),
+		ProxyWithLogFunc(func(ctx *easyweb.Context, err error) {}),
+	)
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/", p.Handle)
+
+	recorder, _ := get(t, svr, "/")
+	assert.Equal(t, http.StatusBadGateway, recorder.Code)
+	assert.Zero(t, p.Upstreams()[0].Active())
+}
+
+func TestProxy_streaming(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy([]string{upstream.URL})
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/events", p.Handle)
+	front := httptest.NewServer(svr)
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/events")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	// the first event arrives before the upstream finishes
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n", line)
+
+	close(release)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "\ndata: 2\n\n", string(rest))
+}
+
+func TestProxy_upgrade(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = brw.Flush()
+
+		line, _ := brw.ReadString('\n')
+		_, _ = brw.WriteString("echo: " + line)
+		_ = brw.Flush()
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy([]string{upstream.URL})
+	require.NoError(t, err)
+
+	svr := easyweb.NewHttpServer()
+	svr.Get("/ws", p.Handle)
+	front := httptest.NewServer(svr)
+	defer front.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, 1, int(p.Upstreams()[0].Active()))
+
+	_, err = conn.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line)
+
+	// the connection is released once closed
+	_ = conn.Close()
+	assert.Eventually(t, func() bool {
+		return p.Upstreams()[0].Active() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewProxy(t *testing.T) {
+	_, err := NewProxy(nil)
+	assert.Error(t, err)
+	_, err = NewProxy([]string{"10.0.0.1:8080"})
+	assert.Error(t, err)
+	_, err = NewProxy([]string{"http://10.0.0.1:8080/%zz"})
+	assert.Error(t, err)
+}
+
+func TestLeastConnBalancer_concurrent(t *testing.T) {
+	upstreams := []*Upstream{{}, {}, {}}
+	lb := NewLeastConnBalancer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lb.Pick(upstreams).active.Add(1)
+		}()
+	}
+	wg.Wait()
+
+	total := int64(0)
+	for _, u := range upstreams {
+		total += u.Active()
+	}
+	assert.Equal(t, int64(30), total)
+}
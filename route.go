@@ -2,7 +2,10 @@ package easyweb
 
 import (
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -25,13 +28,21 @@ func newRouteTree() *routeTree {
 	}
 }
 
-func (t *routeTree) addRoute(method string, path string, hdlFunc HandleFunc, mws ...Middleware) {
-	if path == "" {
-		panic("[easy_web] path is empty")
+// addRoute registers the handler and returns the node it is bound to.
+// It panics if the route can not be registered, see tryAddRoute.
+func (t *routeTree) addRoute(method string, path string, hdlFunc HandleFunc, mws ...Middleware) *node {
+	n, err := t.tryAddRoute(method, path, hdlFunc, mws...)
+	if err != nil {
+		panic(err)
 	}
+	return n
+}
 
-	if path[0] != '/' {
-		panic("[easy_web] path must start with '/'")
+// tryAddRoute registers the handler and returns the node it is bound to.
+// The tree is left untouched if the route can not be registered.
+func (t *routeTree) tryAddRoute(method string, path string, hdlFunc HandleFunc, mws ...Middleware) (*node, error) {
+	if err := t.checkAdd(method, path, hdlFunc); err != nil {
+		return nil, err
 	}
 
 	root, ok := t.m[method]
@@ -41,32 +52,165 @@ func (t *routeTree) addRoute(method string, path string, hdlFunc HandleFunc, mws
 	}
 
 	if path == "/" {
-		if root.handleFunc != nil {
-			panic(fmt.Sprintf("[easy_web] route %s already exists", path))
-		}
-
 		root.fullRoute = path
 		root.handleFunc = hdlFunc
 		root.middlewareChain = append(root.middlewareChain, mws...)
-		return
+		return root, nil
 	}
 
 	segments := strings.SplitSeq(strings.Trim(path, "/"), "/")
 	for seg := range segments {
-		if seg == "" {
-			panic("[easy_web] path contains consecutive '/'")
-		}
-
 		root = root.addChild(seg)
 	}
 
-	if root.handleFunc != nil {
-		panic(fmt.Sprintf("[easy_web] route %s already exists", path))
-	}
-
 	root.fullRoute = strings.TrimRight(path, "/")
 	root.handleFunc = hdlFunc
 	root.middlewareChain = append(root.middlewareChain, mws...)
+	return root, nil
+}
+
+// checkAdd reports why the handler can not be registered without modifying the tree.
+func (t *routeTree) checkAdd(method string, path string, hdlFunc HandleFunc) error {
+	if hdlFunc == nil {
+		return &RouteError{Method: method, Pattern: path, Reason: "handler is nil"}
+	}
+
+	return t.check(method, path)
+}
+
+// check walks the tree without modifying it and reports why the route can not be registered.
+func (t *routeTree) check(method string, path string) error {
+	if !validMethod(method) {
+		return &RouteError{Method: method, Pattern: path, Reason: "invalid method"}
+	}
+
+	if path == "" {
+		return &RouteError{Method: method, Pattern: path, Reason: "path is empty"}
+	}
+
+	if path[0] != '/' {
+		return &RouteError{Method: method, Pattern: path, Reason: "path must start with '/'"}
+	}
+
+	root := t.m[method]
+	if path != "/" {
+		segments := strings.SplitSeq(strings.Trim(path, "/"), "/")
+		for seg := range segments {
+			if seg == "" {
+				return &RouteError{Method: method, Pattern: path, Reason: "path contains consecutive '/'"}
+			}
+
+			child, err := root.checkChild(seg)
+			if err != nil {
+				err.Method = method
+				err.Pattern = path
+				return err
+			}
+			root = child
+		}
+	}
+
+	if root != nil && root.handleFunc != nil {
+		return &RouteError{Method: method, Pattern: path, Existing: root.fullRoute, Reason: "route already exists"}
+	}
+	return nil
+}
+
+// validMethod reports whether method is a valid http method token ( RFC 9110 ),
+// so custom methods like PROPFIND or MKCOL can be registered as well.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// removeRoute unregisters the route registered with exactly the same pattern,
+// nodes left without any route are removed as well.
+func (t *routeTree) removeRoute(method string, path string) error {
+	root, ok := t.m[method]
+	if !ok || !root.removeRoute(patternSegments(path)) {
+		return &RouteError{Method: method, Pattern: path, Reason: "route not found"}
+	}
+
+	if root.isEmpty() {
+		delete(t.m, method)
+	}
+	return nil
+}
+
+// replaceRoute replaces the handler and middlewares of the route registered with exactly the same pattern.
+func (t *routeTree) replaceRoute(method string, path string, hdlFunc HandleFunc, mws ...Middleware) error {
+	if hdlFunc == nil {
+		return &RouteError{Method: method, Pattern: path, Reason: "handler is nil"}
+	}
+
+	n := t.m[method]
+	for _, seg := range patternSegments(path) {
+		if n == nil {
+			break
+		}
+		n = n.patternChild(seg)
+	}
+
+	if n == nil || n.handleFunc == nil {
+		return &RouteError{Method: method, Pattern: path, Reason: "route not found"}
+	}
+
+	n.handleFunc = hdlFunc
+	n.middlewareChain = mws
+	return nil
+}
+
+func patternSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// clone returns a deep copy of the tree nodes,
+// handlers and middlewares are shared with the original tree.
+func (t *routeTree) clone() *routeTree {
+	ct := newRouteTree()
+	for method, root := range t.m {
+		ct.m[method] = root.clone()
+	}
+	return ct
+}
+
+// routes returns the registered routes sorted by path and method.
+func (t *routeTree) routes() []RouteInfo {
+	var res []RouteInfo
+	for method, root := range t.m {
+		root.walk(func(n *node) {
+			res = append(res, RouteInfo{
+				Method:      method,
+				Path:        n.fullRoute,
+				Meta:        maps.Clone(n.meta),
+				Middlewares: slices.Clone(n.middlewareChain),
+			})
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
 }
 
 func (t *routeTree) getRoute(method string, path string) *matched {
@@ -140,6 +284,7 @@ type node struct {
 	re              *regexp.Regexp
 	handleFunc      HandleFunc
 	middlewareChain MiddlewareChain
+	meta            map[string]any
 }
 
 func (n *node) addChild(path string) *node {
@@ -228,6 +373,189 @@ func (n *node) addRegexpN(path string) *node {
 	return n.regexpN
 }
 
+func (n *node) clone() *node {
+	if n == nil {
+		return nil
+	}
+
+	cn := *n
+	cn.wildcardN = n.wildcardN.clone()
+	cn.paramN = n.paramN.clone()
+	cn.regexpN = n.regexpN.clone()
+	cn.middlewareChain = slices.Clone(n.middlewareChain)
+
+	if n.children != nil {
+		cn.children = make(map[string]*node, len(n.children))
+		for path, child := range n.children {
+			cn.children[path] = child.clone()
+		}
+	}
+	return &cn
+}
+
+// patternChild returns the child registered with exactly the segment.
+func (n *node) patternChild(seg string) *node {
+	switch {
+	case seg == "":
+		return nil
+	case seg == "*":
+		return n.wildcardN
+	case seg[0] == ':':
+		if n.paramN != nil && n.paramN.baseRoute == seg {
+			return n.paramN
+		}
+		return nil
+	case strings.HasPrefix(seg, "re:"):
+		if n.regexpN != nil && n.regexpN.baseRoute == seg {
+			return n.regexpN
+		}
+		return nil
+	default:
+		return n.children[seg]
+	}
+}
+
+func (n *node) removeRoute(segs []string) bool {
+	if len(segs) == 0 {
+		if n.handleFunc == nil {
+			return false
+		}
+
+		n.fullRoute = ""
+		n.handleFunc = nil
+		n.middlewareChain = nil
+		n.meta = nil
+		return true
+	}
+
+	child := n.patternChild(segs[0])
+	if child == nil || !child.removeRoute(segs[1:]) {
+		return false
+	}
+
+	if child.isEmpty() {
+		switch child {
+		case n.wildcardN:
+			n.wildcardN = nil
+		case n.paramN:
+			n.paramN = nil
+		case n.regexpN:
+			n.regexpN = nil
+		default:
+			delete(n.children, child.baseRoute)
+		}
+	}
+	return true
+}
+
+// isEmpty reports whether there is no route on or under the node.
+func (n *node) isEmpty() bool {
+	return n.handleFunc == nil && len(n.children) == 0 &&
+		n.wildcardN == nil && n.paramN == nil && n.regexpN == nil
+}
+
+// checkChild returns the existing child which the segment would be registered as,
+// or an error if the segment conflicts with the existing children.
+// A nil node without error means the child does not exist yet.
+func (n *node) checkChild(seg string) (*node, *RouteError) {
+	var re *regexp.Regexp
+	if strings.HasPrefix(seg, "re:") {
+		var err error
+		if re, err = regexp.Compile(seg[3:]); err != nil {
+			return nil, &RouteError{Segment: seg, Reason: fmt.Sprintf("invalid regexp: %v", err)}
+		}
+	}
+
+	if n == nil {
+		return nil, nil
+	}
+
+	conflictErr := func(existing *node, reason string) *RouteError {
+		return &RouteError{Segment: seg, Existing: existing.anyRoute(), Reason: reason}
+	}
+
+	switch {
+	case seg == "*":
+		if n.paramN != nil {
+			return nil, conflictErr(n.paramN, "can not register wildcard/param/regexp node at the same time")
+		}
+		if n.regexpN != nil {
+			return nil, conflictErr(n.regexpN, "can not register wildcard/param/regexp node at the same time")
+		}
+		return n.wildcardN, nil
+	case seg[0] == ':':
+		if n.wildcardN != nil {
+			return nil, conflictErr(n.wildcardN, "can not register wildcard/param/regexp node at the same time")
+		}
+		if n.regexpN != nil {
+			return nil, conflictErr(n.regexpN, "can not register wildcard/param/regexp node at the same time")
+		}
+		if n.paramN != nil && n.paramN.baseRoute != seg {
+			return nil, conflictErr(n.paramN, "duplicate registered param node")
+		}
+		return n.paramN, nil
+	case re != nil:
+		if n.wildcardN != nil {
+			return nil, conflictErr(n.wildcardN, "can not register wildcard/param/regexp node at the same time")
+		}
+		if n.paramN != nil {
+			return nil, conflictErr(n.paramN, "can not register wildcard/param/regexp node at the same time")
+		}
+		if n.regexpN != nil && n.regexpN.re.String() != re.String() {
+			return nil, conflictErr(n.regexpN, "duplicate registered regexp node")
+		}
+		return n.regexpN, nil
+	default:
+		return n.children[seg], nil
+	}
+}
+
+// walk calls fn on every node with a handler on or under the node.
+func (n *node) walk(fn func(n *node)) {
+	if n.handleFunc != nil {
+		fn(n)
+	}
+
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+	for _, child := range []*node{n.wildcardN, n.paramN, n.regexpN} {
+		if child != nil {
+			child.walk(fn)
+		}
+	}
+}
+
+// anyRoute returns a registered route under the node,
+// used to tell which existing route a new one conflicts with.
+func (n *node) anyRoute() string {
+	if n.handleFunc != nil {
+		return n.fullRoute
+	}
+
+	for _, child := range []*node{n.wildcardN, n.paramN, n.regexpN} {
+		if child == nil {
+			continue
+		}
+		if route := child.anyRoute(); route != "" {
+			return route
+		}
+	}
+
+	keys := make([]string, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if route := n.children[key].anyRoute(); route != "" {
+			return route
+		}
+	}
+	return ""
+}
+
 func (n *node) getChild(path string) (*node, bool) {
 	// check the regexp node first
 	if n.regexpN != nil && n.regexpN.re.MatchString(path) {
@@ -254,6 +582,38 @@ func (n *node) getWildcardOrParamN() (*node, bool) {
 	return nil, false
 }
 
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method string
+	Path   string
+	// Meta is the metadata attached by the route's groups.
+	Meta map[string]any
+	// Middlewares is the middleware chain of the route, including the ones added by HttpServer.Use.
+	Middlewares MiddlewareChain
+}
+
+// RouteError describes why a route can not be registered.
+type RouteError struct {
+	Method  string
+	Pattern string
+	// Segment is the offending segment of the pattern, if any.
+	Segment string
+	// Existing is the registered route the pattern conflicts with, if any.
+	Existing string
+	Reason   string
+}
+
+func (e *RouteError) Error() string {
+	msg := fmt.Sprintf("[easy_web] route %s %s: %s", e.Method, e.Pattern, e.Reason)
+	if e.Segment != "" {
+		msg += fmt.Sprintf(" at segment %q", e.Segment)
+	}
+	if e.Existing != "" {
+		msg += fmt.Sprintf(", conflicts with %q", e.Existing)
+	}
+	return msg
+}
+
 type matched struct {
 	node   *node
 	params map[string]string
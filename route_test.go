@@ -327,6 +327,178 @@ func TestRouteTree_addRoute_panic(t *testing.T) {
 	})
 }
 
+func TestRouteTree_tryAddRoute(t *testing.T) {
+	mockHdlFunc := func(ctx *Context) {}
+
+	tree := newRouteTree()
+	tree.addRoute(http.MethodGet, "/", mockHdlFunc)
+	tree.addRoute(http.MethodGet, "/user/test", mockHdlFunc)
+	tree.addRoute(http.MethodGet, "/mall/order/*", mockHdlFunc)
+	tree.addRoute(http.MethodGet, "/mall/goods/:id/info", mockHdlFunc)
+	tree.addRoute(http.MethodGet, "/mall/items/re:^\\d+$", mockHdlFunc)
+
+	tcs := []struct {
+		name    string
+		method  string
+		path    string
+		hdlFunc HandleFunc
+		wantErr *RouteError
+	}{
+		{
+			name:    "invalid method",
+			method:  "GET POST",
+			path:    "/user",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{Method: "GET POST", Pattern: "/user", Reason: "invalid method"},
+		}, {
+			name:    "nil handler",
+			method:  http.MethodGet,
+			path:    "/user",
+			wantErr: &RouteError{Method: http.MethodGet, Pattern: "/user", Reason: "handler is nil"},
+		}, {
+			name:    "path not start with '/'",
+			method:  http.MethodGet,
+			path:    "user",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{Method: http.MethodGet, Pattern: "user", Reason: "path must start with '/'"},
+		}, {
+			name:    "duplicate root",
+			method:  http.MethodGet,
+			path:    "/",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{Method: http.MethodGet, Pattern: "/", Existing: "/", Reason: "route already exists"},
+		}, {
+			name:    "duplicate route",
+			method:  http.MethodGet,
+			path:    "/user/test/",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{Method: http.MethodGet, Pattern: "/user/test/", Existing: "/user/test", Reason: "route already exists"},
+		}, {
+			name:    "param conflicts with wildcard",
+			method:  http.MethodGet,
+			path:    "/mall/order/:id",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{
+				Method:   http.MethodGet,
+				Pattern:  "/mall/order/:id",
+				Segment:  ":id",
+				Existing: "/mall/order/*",
+				Reason:   "can not register wildcard/param/regexp node at the same time",
+			},
+		}, {
+			name:    "param name conflicts",
+			method:  http.MethodGet,
+			path:    "/mall/goods/:name",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{
+				Method:   http.MethodGet,
+				Pattern:  "/mall/goods/:name",
+				Segment:  ":name",
+				Existing: "/mall/goods/:id/info",
+				Reason:   "duplicate registered param node",
+			},
+		}, {
+			name:    "regexp conflicts",
+			method:  http.MethodGet,
+			path:    "/mall/items/re:^\\w+$",
+			hdlFunc: mockHdlFunc,
+			wantErr: &RouteError{
+				Method:   http.MethodGet,
+				Pattern:  "/mall/items/re:^\\w+$",
+				Segment:  "re:^\\w+$",
+				Existing: "/mall/items/re:^\\d+$",
+				Reason:   "duplicate registered regexp node",
+			},
+		}, {
+			name:    "valid",
+			method:  http.MethodGet,
+			path:    "/mall/goods/:id",
+			hdlFunc: mockHdlFunc,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tree.tryAddRoute(tc.method, tc.path, tc.hdlFunc)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+
+	// bad regexp is reported without modifying the tree
+	_, err := tree.tryAddRoute(http.MethodGet, "/mall/orders/re:^(\\d+$", mockHdlFunc)
+	var routeErr *RouteError
+	assert.ErrorAs(t, err, &routeErr)
+	assert.Equal(t, "re:^(\\d+$", routeErr.Segment)
+
+	// failed registration leaves the tree untouched
+	tree.addRoute(http.MethodPost, "/mall/*", mockHdlFunc)
+	_, err = tree.tryAddRoute(http.MethodPost, "/mall/order/re:^(\\d+$", mockHdlFunc)
+	assert.Error(t, err)
+	m := tree.getRoute(http.MethodPost, "/mall/order/123")
+	assert.NotNil(t, m.node)
+	assert.Equal(t, "/mall/*", m.node.fullRoute)
+	tree.putMatchInfo(m)
+}
+
+func TestRouteTree_removeRoute(t *testing.T) {
+	mockHdlFunc := func(ctx *Context) {}
+
+	tree := newRouteTree()
+	tree.addRoute(http.MethodGet, "/mall/order", mockHdlFunc)
+	tree.addRoute(http.MethodGet, "/mall/order/:id/transfer", mockHdlFunc)
+	tree.addRoute(http.MethodGet, "/mall/goods/*", mockHdlFunc)
+	tree.addRoute(http.MethodPost, "/", mockHdlFunc)
+
+	// only exactly the same pattern is removed
+	assert.Error(t, tree.removeRoute(http.MethodGet, "/mall/order/123/transfer"))
+	assert.Error(t, tree.removeRoute(http.MethodGet, "/mall/order/:name/transfer"))
+	assert.Error(t, tree.removeRoute(http.MethodGet, "/mall"))
+	assert.Error(t, tree.removeRoute(http.MethodPut, "/mall/order"))
+
+	assert.NoError(t, tree.removeRoute(http.MethodGet, "/mall/order/:id/transfer"))
+	assert.NoError(t, tree.removeRoute(http.MethodGet, "/mall/goods/*"))
+	assert.NoError(t, tree.removeRoute(http.MethodPost, "/"))
+
+	wantTrees := &routeTree{
+		m: map[string]*node{
+			http.MethodGet: {
+				typ: static,
+				children: map[string]*node{
+					"mall": {
+						typ:       static,
+						baseRoute: "mall",
+						children: map[string]*node{
+							"order": {
+								typ:        static,
+								baseRoute:  "order",
+								fullRoute:  "/mall/order",
+								handleFunc: mockHdlFunc,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	msg, ok := tree.equal(wantTrees)
+	if !ok {
+		t.Log(msg)
+	}
+	assert.True(t, ok)
+	assert.Nil(t, tree.m[http.MethodGet].children["mall"].children["order"].paramN)
+	assert.NotContains(t, tree.m, http.MethodPost)
+
+	// the removed route can be registered again
+	assert.NotPanics(t, func() {
+		tree.addRoute(http.MethodGet, "/mall/order/:name", mockHdlFunc)
+	})
+}
+
 func TestRouteTree_addRoute_middleware(t *testing.T) {
 	mockHdlFunc := func(ctx *Context) {}
 	firstMockMwFunc := func(next HandleFunc) HandleFunc {
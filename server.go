@@ -1,8 +1,14 @@
 package easyweb
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // HandleFunc is a handler function for a route
@@ -25,10 +31,23 @@ type Server interface {
 }
 
 type HttpServer struct {
-	*routeTree
+	// routes is changed in place until the first request is served,
+	// after that it is replaced as a whole on every change (copy-on-write),
+	// so requests in flight keep serving with the tree they loaded.
+	routes atomic.Pointer[routeTree]
+	// serving is set by the first request.
+	serving atomic.Bool
+	// mu serializes the changes of routes and serving.
+	mu sync.Mutex
 
 	addr      string
 	tplEngine TemplateEngine
+
+	trustedProxies []netip.Prefix
+
+	mwChain        MiddlewareChain
+	notFoundHdl    HandleFunc
+	notFoundGroups []*RouteGroup
 }
 
 type ServerOpt func(*HttpServer)
@@ -47,10 +66,14 @@ func ServerWithTplEngineOpt(tplEngine TemplateEngine) ServerOpt {
 
 func NewHttpServer(opts ...ServerOpt) *HttpServer {
 	svr := &HttpServer{
-		routeTree: newRouteTree(),
-		addr:      ":8080",
+		addr: ":8080",
+		notFoundHdl: func(ctx *Context) {
+			_ = ctx.RespBytes(http.StatusNotFound, []byte("Not Found"))
+		},
 	}
 
+	svr.routes.Store(newRouteTree())
+
 	for _, opt := range opts {
 		opt(svr)
 	}
@@ -59,34 +82,79 @@ func NewHttpServer(opts ...ServerOpt) *HttpServer {
 }
 
 func (s *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.serving.Load() {
+		s.markServing()
+	}
+
 	ctx := &Context{
 		Req:       r,
 		Resp:      w,
 		TraceCtx:  r.Context(),
 		tplEngine: s.tplEngine,
+
+		trustedProxies: s.trustedProxies,
 	}
 
 	s.serve(ctx)
 }
 
+// markServing switches the route changes to copy-on-write.
+func (s *HttpServer) markServing() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serving.Store(true)
+}
+
 // serve is the main function to serve the request
 func (s *HttpServer) serve(ctx *Context) {
-	matched := s.getRoute(ctx.Req.Method, ctx.Req.URL.Path)
-	defer s.putMatchInfo(matched)
+	routes := s.routes.Load()
+	matched := routes.getRoute(ctx.Req.Method, ctx.Req.URL.Path)
+	defer routes.putMatchInfo(matched)
 
 	if matched.node == nil || matched.node.handleFunc == nil {
-		_ = ctx.RespBytes(http.StatusNotFound, []byte("Not Found"))
-		s.flushResp(ctx)
+		s.serveNotFound(ctx)
 		return
 	}
 
-	handleFunc := matched.node.handleFunc
-	// middleware execution
-	middlewareChain := matched.node.middlewareChain
+	ctx.MatchedRoute = matched.node.fullRoute
+	ctx.pathParams = matched.params
+	ctx.routeMeta = matched.node.meta
+	s.execute(ctx, matched.node.handleFunc, matched.node.middlewareChain)
+}
+
+// serveNotFound uses the not found handler of the most specific group containing the path,
+// falls back to the server's not found handler.
+func (s *HttpServer) serveNotFound(ctx *Context) {
+	var rg *RouteGroup
+	for _, g := range s.notFoundGroups {
+		if !hasPathPrefix(ctx.Req.URL.Path, g.getAbsPath()) {
+			continue
+		}
+
+		if rg == nil || len(g.getAbsPath()) > len(rg.getAbsPath()) {
+			rg = g
+		}
+	}
+
+	if rg == nil {
+		s.execute(ctx, s.notFoundHdl, nil)
+		return
+	}
+
+	ctx.routeMeta = rg.getMeta()
+	s.execute(ctx, rg.notFoundHdl, rg.getMwChain())
+}
+
+// execute runs the handler wrapped by the middleware chain and the server's middlewares,
+// then flushes the response.
+func (s *HttpServer) execute(ctx *Context, handleFunc HandleFunc, middlewareChain MiddlewareChain) {
 	// reverse the middleware chain
 	for i := len(middlewareChain) - 1; i >= 0; i-- {
 		handleFunc = middlewareChain[i](handleFunc)
 	}
+	for i := len(s.mwChain) - 1; i >= 0; i-- {
+		handleFunc = s.mwChain[i](handleFunc)
+	}
 
 	// wrap the handler function
 	// flush the response after the handler function is executed
@@ -97,8 +165,6 @@ func (s *HttpServer) serve(ctx *Context) {
 		}
 	}(handleFunc)
 
-	ctx.MatchedRoute = matched.node.fullRoute
-	ctx.pathParams = matched.params
 	handleFunc(ctx)
 }
 
@@ -107,19 +173,274 @@ func (s *HttpServer) flushResp(ctx *Context) {
 		ctx.Resp.WriteHeader(ctx.StatusCode)
 	}
 
+	// responses like 204 and 304 do not allow a body
+	if len(ctx.Data) == 0 {
+		return
+	}
+
+	// the client may be gone, e.g. broken pipe, which must not stop the server
 	if _, err := ctx.Resp.Write(ctx.Data); err != nil {
-		log.Fatalln("[easy_web] flush response failed", err)
+		log.Println("[easy_web] flush response failed", err)
 	}
 }
 
+// Use adds middlewares running for every request before the route's middlewares,
+// including the requests that match no route ( e.g. CORS preflight requests ).
+// It should be called before the server starts.
+func (s *HttpServer) Use(mws ...Middleware) {
+	s.mwChain = append(s.mwChain, mws...)
+}
+
 func (s *HttpServer) Start() error {
 	return http.ListenAndServe(s.addr, s)
 }
 
 func (s *HttpServer) Route(method string, path string, hdl HandleFunc, mws ...Middleware) {
-	s.addRoute(method, path, hdl, mws...)
+	s.route(method, path, hdl, nil, mws...)
+}
+
+// TryRoute registers the route like Route, but returns a *RouteError instead of panicking.
+func (s *HttpServer) TryRoute(method string, path string, hdl HandleFunc, mws ...Middleware) error {
+	return s.tryRoute(method, path, hdl, nil, mws...)
+}
+
+func (s *HttpServer) route(method string, path string, hdl HandleFunc, meta map[string]any, mws ...Middleware) {
+	if err := s.tryRoute(method, path, hdl, meta, mws...); err != nil {
+		panic(err)
+	}
+}
+
+func (s *HttpServer) tryRoute(method string, path string, hdl HandleFunc, meta map[string]any, mws ...Middleware) error {
+	return s.tryMatch([]string{method}, path, hdl, meta, mws...)
+}
+
+// tryMatch registers the route for all the methods, or none of them if any can not be registered.
+func (s *HttpServer) tryMatch(methods []string, path string, hdl HandleFunc, meta map[string]any, mws ...Middleware) error {
+	return s.updateRoutes(func(tree *routeTree) error {
+		for _, method := range methods {
+			if err := tree.checkAdd(method, path, hdl); err != nil {
+				return err
+			}
+		}
+
+		for _, method := range methods {
+			n, err := tree.tryAddRoute(method, path, hdl, mws...)
+			if err != nil {
+				return err
+			}
+
+			n.meta = meta
+		}
+		return nil
+	})
+}
+
+// RemoveRoute unregisters the route registered with exactly the same pattern.
+// It is safe to call while the server is serving.
+func (s *HttpServer) RemoveRoute(method string, path string) error {
+	return s.updateRoutes(func(tree *routeTree) error {
+		return tree.removeRoute(method, path)
+	})
+}
+
+// ReplaceRoute replaces the handler and middlewares of the route registered with exactly the same pattern.
+// It is safe to call while the server is serving.
+func (s *HttpServer) ReplaceRoute(method string, path string, hdl HandleFunc, mws ...Middleware) error {
+	return s.updateRoutes(func(tree *routeTree) error {
+		return tree.replaceRoute(method, path, hdl, mws...)
+	})
+}
+
+// updateRoutes applies fn to the route tree, or to a copy of it once the server is serving,
+// and publishes the tree if fn succeeds.
+// fn must leave the tree untouched if it fails.
+func (s *HttpServer) updateRoutes(fn func(tree *routeTree) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tree := s.routes.Load()
+	if s.serving.Load() {
+		tree = tree.clone()
+	}
+
+	if err := fn(tree); err != nil {
+		return err
+	}
+
+	s.routes.Store(tree)
+	return nil
+}
+
+// Routes returns the registered routes sorted by path and method,
+// e.g. to assert every route is protected in tests.
+func (s *HttpServer) Routes() []RouteInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := s.routes.Load().routes()
+	if len(s.mwChain) > 0 {
+		for i := range res {
+			res[i].Middlewares = append(slices.Clone(s.mwChain), res[i].Middlewares...)
+		}
+	}
+	return res
+}
+
+// RouteDef describes a route to register, e.g. one generated from configuration.
+type RouteDef struct {
+	Method      string
+	Path        string
+	Handler     HandleFunc
+	Middlewares []Middleware
+}
+
+// Validate checks the routes against the registered routes and against each other
+// without registering any of them.
+// The returned error joins every *RouteError found.
+func (s *HttpServer) Validate(defs ...RouteDef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return checkRouteDefs(s.routes.Load(), defs)
+}
+
+// Register registers all the routes, or none of them if any can not be registered.
+// The returned error joins every *RouteError found.
+func (s *HttpServer) Register(defs ...RouteDef) error {
+	return s.updateRoutes(func(tree *routeTree) error {
+		return addRouteDefs(tree, defs)
+	})
+}
+
+// addRouteDefs adds all the routes to the tree, or none of them if any can not be added.
+func addRouteDefs(tree *routeTree, defs []RouteDef) error {
+	if err := checkRouteDefs(tree, defs); err != nil {
+		return err
+	}
+
+	for _, def := range defs {
+		if _, err := tree.tryAddRoute(def.Method, def.Path, def.Handler, def.Middlewares...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRouteDefs checks the routes against the tree and against each other without modifying the tree.
+func checkRouteDefs(tree *routeTree, defs []RouteDef) error {
+	var errs []error
+	added := newRouteTree()
+	for _, def := range defs {
+		if err := tree.checkAdd(def.Method, def.Path, def.Handler); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err := added.tryAddRoute(def.Method, def.Path, def.Handler); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *HttpServer) Get(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodGet, path, hdl, mws...)
+}
+
+func (s *HttpServer) Post(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodPost, path, hdl, mws...)
+}
+
+func (s *HttpServer) Put(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodPut, path, hdl, mws...)
+}
+
+func (s *HttpServer) Delete(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodDelete, path, hdl, mws...)
+}
+
+func (s *HttpServer) Patch(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodPatch, path, hdl, mws...)
 }
 
-func (s *HttpServer) Group(path string) *RouteGroup {
-	return newRouteGroup(s, path)
+func (s *HttpServer) Head(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodHead, path, hdl, mws...)
+}
+
+func (s *HttpServer) Options(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Route(http.MethodOptions, path, hdl, mws...)
+}
+
+// Any registers the handler for all standard http methods.
+func (s *HttpServer) Any(path string, hdl HandleFunc, mws ...Middleware) {
+	s.Match(anyMethods, path, hdl, mws...)
+}
+
+// Match registers the handler for each of the given methods.
+// Custom methods ( e.g. PROPFIND ) are supported, duplicated methods are registered once.
+// It panics without registering any of the methods if one of them can not be registered.
+func (s *HttpServer) Match(methods []string, path string, hdl HandleFunc, mws ...Middleware) {
+	if err := s.tryMatch(uniqMethods(methods), path, hdl, nil, mws...); err != nil {
+		panic(err)
+	}
+}
+
+func (s *HttpServer) Group(path string, mws ...Middleware) *RouteGroup {
+	return newRouteGroup(s, path, mws...)
+}
+
+// TryGroup creates a group like Group, but returns an error instead of panicking.
+func (s *HttpServer) TryGroup(path string, mws ...Middleware) (*RouteGroup, error) {
+	return tryNewRouteGroup(s, path, mws...)
+}
+
+// NotFound replaces the default handler for requests that match no route.
+func (s *HttpServer) NotFound(hdl HandleFunc) {
+	s.notFoundHdl = hdl
+}
+
+func (s *HttpServer) addGroupNotFound(rg *RouteGroup) {
+	for _, g := range s.notFoundGroups {
+		if g == rg {
+			return
+		}
+	}
+
+	s.notFoundGroups = append(s.notFoundGroups, rg)
+}
+
+// anyMethods are the standard http methods registered by Any.
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+func uniqMethods(methods []string) []string {
+	res := make([]string, 0, len(methods))
+	seen := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		if _, ok := seen[method]; ok {
+			continue
+		}
+
+		seen[method] = struct{}{}
+		res = append(res, method)
+	}
+	return res
+}
+
+// hasPathPrefix reports whether path is prefix itself or lies under it.
+func hasPathPrefix(path string, prefix string) bool {
+	prefix = strings.TrimRight(prefix, "/")
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
 }
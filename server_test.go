@@ -0,0 +1,290 @@
+package easyweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpServer_Shortcuts(t *testing.T) {
+	svr := NewHttpServer()
+
+	mockHdlFunc := func(ctx *Context) {}
+	svr.Get("/user", mockHdlFunc)
+	svr.Post("/user", mockHdlFunc)
+	svr.Put("/user", mockHdlFunc)
+	svr.Patch("/user", mockHdlFunc)
+	svr.Delete("/user", mockHdlFunc)
+	svr.Head("/user", mockHdlFunc)
+	svr.Options("/user", mockHdlFunc)
+
+	for _, method := range []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions,
+	} {
+		mi := svr.routes.Load().getRoute(method, "/user")
+		assert.NotNil(t, mi.node, method)
+		svr.routes.Load().putMatchInfo(mi)
+	}
+}
+
+func TestHttpServer_Any(t *testing.T) {
+	svr := NewHttpServer()
+	svr.Any("/user/:id", func(ctx *Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte(ctx.Req.Method))
+	})
+
+	for _, method := range anyMethods {
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(method, "/user/1", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, method)
+	}
+
+	// the same path can still be registered for a custom method
+	assert.NotPanics(t, func() {
+		svr.Route("PROPFIND", "/user/:id", func(ctx *Context) {})
+	})
+}
+
+func TestHttpServer_Match(t *testing.T) {
+	svr := NewHttpServer()
+
+	assert.NotPanics(t, func() {
+		svr.Match([]string{http.MethodGet, "PROPFIND", http.MethodGet, "MKCOL"}, "/dav/*", func(ctx *Context) {
+			_ = ctx.Ok()
+		})
+	})
+
+	tcs := []struct {
+		name     string
+		method   string
+		wantCode int
+	}{
+		{
+			name:     "standard method",
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+		}, {
+			name:     "custom method",
+			method:   "PROPFIND",
+			wantCode: http.StatusOK,
+		}, {
+			name:     "another custom method",
+			method:   "MKCOL",
+			wantCode: http.StatusOK,
+		}, {
+			name:     "not registered",
+			method:   http.MethodPost,
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			svr.ServeHTTP(recorder, httptest.NewRequest(tc.method, "/dav/a/b", nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+
+	assert.Panics(t, func() {
+		svr.Match([]string{"BAD METHOD"}, "/dav", func(ctx *Context) {})
+	})
+	assert.Panics(t, func() {
+		svr.Match([]string{""}, "/dav", func(ctx *Context) {})
+	})
+
+	// none of the methods is registered if any conflicts
+	assert.Panics(t, func() {
+		svr.Match([]string{http.MethodPost, http.MethodPut, "PROPFIND"}, "/dav/*", func(ctx *Context) {})
+	})
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/dav/a", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHttpServer_Register(t *testing.T) {
+	mockHdlFunc := func(ctx *Context) {}
+
+	svr := NewHttpServer()
+	svr.Get("/mall/order/*", mockHdlFunc)
+
+	defs := []RouteDef{
+		{Method: http.MethodGet, Path: "/user", Handler: mockHdlFunc},
+		{Method: http.MethodGet, Path: "/mall/order/:id", Handler: mockHdlFunc},
+		{Method: http.MethodGet, Path: "/user", Handler: mockHdlFunc},
+		{Method: http.MethodPost, Path: "/user", Handler: mockHdlFunc},
+	}
+
+	err := svr.Validate(defs...)
+	assert.Error(t, err)
+
+	err = svr.Register(defs...)
+	var routeErr *RouteError
+	assert.ErrorAs(t, err, &routeErr)
+	assert.Equal(t, "/mall/order/*", routeErr.Existing)
+	assert.Contains(t, err.Error(), `route GET /user: route already exists, conflicts with "/user"`)
+
+	// nothing is registered if any route fails
+	mi := svr.routes.Load().getRoute(http.MethodPost, "/user")
+	assert.Nil(t, mi.node)
+	svr.routes.Load().putMatchInfo(mi)
+
+	err = svr.Register(defs[0], defs[3])
+	assert.NoError(t, err)
+	mi = svr.routes.Load().getRoute(http.MethodPost, "/user")
+	assert.NotNil(t, mi.node)
+	svr.routes.Load().putMatchInfo(mi)
+}
+
+func TestHttpServer_TryRoute(t *testing.T) {
+	svr := NewHttpServer()
+
+	assert.NoError(t, svr.TryRoute(http.MethodGet, "/user/:id", func(ctx *Context) {}))
+	assert.Error(t, svr.TryRoute(http.MethodGet, "/user/:name", func(ctx *Context) {}))
+
+	_, err := svr.TryGroup("api")
+	assert.Error(t, err)
+
+	rg, err := svr.TryGroup("/api")
+	assert.NoError(t, err)
+	assert.NoError(t, rg.TryRoute(http.MethodGet, "/user", func(ctx *Context) {}))
+	assert.Error(t, rg.TryRoute(http.MethodGet, "user//info", func(ctx *Context) {}))
+}
+
+func TestHttpServer_HotSwap(t *testing.T) {
+	svr := NewHttpServer()
+	svr.Get("/feature", func(ctx *Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("v1"))
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	// requests in flight finish with the tree they started with
+	started, release := make(chan struct{}), make(chan struct{})
+	svr.Get("/slow", func(ctx *Context) {
+		close(started)
+		<-release
+		_ = ctx.RespBytes(http.StatusOK, []byte("slow"))
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve("/slow")
+	}()
+	<-started
+
+	assert.NoError(t, svr.RemoveRoute(http.MethodGet, "/slow"))
+	assert.Equal(t, http.StatusNotFound, serve("/slow").Code)
+
+	close(release)
+	assert.Equal(t, "slow", (<-done).Body.String())
+
+	assert.NoError(t, svr.ReplaceRoute(http.MethodGet, "/feature", func(ctx *Context) {
+		_ = ctx.RespBytes(http.StatusOK, []byte("v2"))
+	}))
+	assert.Equal(t, "v2", serve("/feature").Body.String())
+
+	var routeErr *RouteError
+	assert.ErrorAs(t, svr.RemoveRoute(http.MethodGet, "/slow"), &routeErr)
+	assert.ErrorAs(t, svr.ReplaceRoute(http.MethodGet, "/slow", func(ctx *Context) {}), &routeErr)
+
+	// routes added while serving concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			svr.Get(fmt.Sprintf("/plugin/%d", i), func(ctx *Context) { _ = ctx.Ok() })
+		}(i)
+		go func() {
+			defer wg.Done()
+			serve("/feature")
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, http.StatusOK, serve(fmt.Sprintf("/plugin/%d", i)).Code)
+	}
+}
+
+func TestHttpServer_copyOnWrite(t *testing.T) {
+	svr := NewHttpServer()
+
+	// the tree is changed in place before serving
+	tree := svr.routes.Load()
+	for i := 0; i < 8; i++ {
+		svr.Get(fmt.Sprintf("/user/%d", i), func(ctx *Context) {})
+	}
+	assert.Error(t, svr.Register(
+		RouteDef{Method: http.MethodGet, Path: "/order", Handler: func(ctx *Context) {}},
+		RouteDef{Method: http.MethodGet, Path: "/user/1", Handler: func(ctx *Context) {}},
+	))
+	assert.Same(t, tree, svr.routes.Load())
+	assert.Len(t, svr.Routes(), 8)
+
+	// and copied on every change after that
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	svr.Get("/order", func(ctx *Context) {})
+	assert.NotSame(t, tree, svr.routes.Load())
+	assert.Len(t, tree.routes(), 8)
+	assert.Len(t, svr.Routes(), 9)
+}
+
+func TestHttpServer_Use(t *testing.T) {
+	svr := NewHttpServer()
+
+	var trace []string
+	svr.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			trace = append(trace, "server")
+			next(ctx)
+		}
+	})
+	svr.Get("/user", func(ctx *Context) {
+		trace = append(trace, "hdl")
+	}, func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			trace = append(trace, "route")
+			next(ctx)
+		}
+	})
+
+	svr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, []string{"server", "route", "hdl"}, trace)
+
+	// runs for the requests matching no route as well
+	trace = nil
+	recorder := httptest.NewRecorder()
+	svr.ServeHTTP(recorder, httptest.NewRequest(http.MethodOptions, "/user", nil))
+	assert.Equal(t, []string{"server"}, trace)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHttpServer_Routes(t *testing.T) {
+	svr := NewHttpServer()
+	mockHdlFunc := func(ctx *Context) {}
+
+	svr.Get("/", mockHdlFunc)
+	svr.Post("/user/:id", mockHdlFunc)
+	svr.Get("/user/:id", mockHdlFunc)
+	svr.Get("/static/*", mockHdlFunc)
+	svr.Group("/admin").WithMeta("role", "admin").Delete(`/order/re:^\d+$`, mockHdlFunc)
+
+	assert.Equal(t, []RouteInfo{
+		{Method: http.MethodGet, Path: "/"},
+		{Method: http.MethodDelete, Path: `/admin/order/re:^\d+$`, Meta: map[string]any{"role": "admin"}},
+		{Method: http.MethodGet, Path: "/static/*"},
+		{Method: http.MethodGet, Path: "/user/:id"},
+		{Method: http.MethodPost, Path: "/user/:id"},
+	}, svr.Routes())
+}
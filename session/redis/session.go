@@ -80,6 +80,11 @@ func (r *RStore) Get(ctx context.Context, id string) (session.Session, error) {
 	}, nil
 }
 
+// Ping checks the connection to redis, e.g. for a readiness check.
+func (r *RStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *RStore) key(id string) string {
 	return fmt.Sprintf("%s:%s", r.prefix, id)
 }